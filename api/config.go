@@ -18,11 +18,127 @@ package api
 
 // DevicePluginConfig holds the configuration parsed from the ConfigMap
 type DevicePluginConfig struct {
-	NxGzip              bool     `json:"nx-gzip"`
-	Permissions         string   `json:"permissions"`               // Accepts: R, RW, RWM, RM, W, WM, M
-	IncludeDevices      []string `json:"include-devices,omitempty"` // e.g., "/dev/dm-0", "/dev/dm-*"
-	ExcludeDevices      []string `json:"exclude-devices,omitempty"` // e.g., "/dev/dm-3", "/dev/dm-*"
-	DiscoveryStrategy   string   `json:"discovery-strategy"`        // "default" or "time"
-	ScanInterval        string   `json:"scan-interval"`             // e.g., "60m", min 1m
-	UpperLimitPerDevice int      `json:"upper-limit,omitempty"`
+	NxGzip              bool                `json:"nx-gzip"`
+	Permissions         string              `json:"permissions"`                 // Accepts: R, RW, RWM, RM, W, WM, M
+	IncludeDevices      []string            `json:"include-devices,omitempty"`   // e.g., "/dev/dm-0", "/dev/dm-*"
+	ExcludeDevices      []string            `json:"exclude-devices,omitempty"`   // e.g., "/dev/dm-3", "/dev/dm-*"
+	DiscoveryStrategy   string              `json:"discovery-strategy"`          // "default" or "time"
+	ScanInterval        string              `json:"scan-interval"`               // e.g., "60m", min 1m
+	ScanTimeout         string              `json:"scan-timeout,omitempty"`      // how long callers wait for a scan before using the last result, default "30s"
+	ProbeTimeout        string              `json:"probe-timeout,omitempty"`     // how long a single device may take to answer a probe, default "5s"
+	DiscoveryBackend    string              `json:"discovery-backend,omitempty"` // "ghw" (default), "sysfs", "lsblk" or "static"
+	StaticDevices       []string            `json:"static-devices,omitempty"`    // the devices the static backend advertises, e.g. "/dev/dm-3"
+	DiscoveryHook       *DiscoveryHook      `json:"discovery-hook,omitempty"`
+	DeviceClasses       []DeviceClass       `json:"device-classes,omitempty"` // character devices advertised beside the block devices
+	UpperLimitPerDevice int                 `json:"upper-limit,omitempty"`
+	NodeFeatures        bool                `json:"node-features,omitempty"`         // writes the NFD local feature file after each scan
+	AuditLog            string              `json:"audit-log,omitempty"`             // JSON-lines allocation audit log, disabled when empty
+	AuditLogMaxSize     int                 `json:"audit-log-max-size,omitempty"`    // in MiB, default 10
+	AuditLogMaxBackups  int                 `json:"audit-log-max-backups,omitempty"` // rotated files to keep, default 3
+	MultipathMode       string              `json:"multipath-mode,omitempty"`        // "dm", "dm-and-paths" or "mapper", disabled when empty
+	AllowSystemDevices  []string            `json:"allow-system-devices,omitempty"`  // host system devices to advertise anyway, e.g. "/dev/sdb"
+	IncludeSelectors    []DeviceSelector    `json:"include-selectors,omitempty"`
+	ExcludeSelectors    []DeviceSelector    `json:"exclude-selectors,omitempty"`
+	DeviceRules         []DeviceRule        `json:"device-rules,omitempty"` // replaces the include/exclude fields when set
+	PermissionRules     []PermissionRule    `json:"permission-rules,omitempty"`
+	ContainerPath       string              `json:"container-path,omitempty"` // template, e.g. "/dev/power/{mapper-name}", host path when empty
+	ContainerPathRules  []ContainerPathRule `json:"container-path-rules,omitempty"`
+	Replicas            int                 `json:"replicas,omitempty"` // shareable IDs per device, e.g. dm-3::0..dm-3::3; sharing is off when <= 1
+	ReplicaRules        []ReplicaRule       `json:"replica-rules,omitempty"`
+	UpperLimitRules     []UpperLimitRule    `json:"upper-limit-rules,omitempty"`
+	ReservedDevices     int                 `json:"reserved-devices,omitempty"`  // block devices held back for the node, neither advertised nor allocated
+	AllocationPolicy    string              `json:"allocation-policy,omitempty"` // "grant-all" (default), "upper-limit-shared", "requested-ids" or "exclusive"
+}
+
+// DiscoveryHook runs an external command at each scan to accept and annotate the devices the rules
+// allowed. The command reads the candidates as JSON on stdin and prints the accepted ones on stdout;
+// when it fails or times out, the scan keeps the devices the rules allowed.
+type DiscoveryHook struct {
+	Command []string `json:"command"`           // executable and arguments, e.g. ["/opt/hooks/cmdb-filter", "/etc/cmdb/luns.csv"]
+	Timeout string   `json:"timeout,omitempty"` // default "10s"
+}
+
+// DeviceClass advertises the character devices of the host it matches, e.g. /dev/tpmrm0 or /dev/hvcs*.
+// Every matcher that is set must match, at least one is required unless kind is vfio. Its permissions,
+// replicas and upper-limit apply to the devices it discovered ahead of the rules; the rules apply to what
+// is left unset. Device rules, deny rules included, do not apply to class devices.
+type DeviceClass struct {
+	Name        string `json:"name"`                  // e.g. "tpm"
+	Kind        string `json:"kind,omitempty"`        // "char" (default), or "vfio" for the IOMMU groups of the devices bound to vfio-pci
+	Glob        string `json:"glob,omitempty"`        // matched against the /dev path, e.g. "/dev/hvcs*"
+	SysfsClass  string `json:"sysfs-class,omitempty"` // the devices listed in /sys/class/<sysfs-class>, e.g. "tpmrm"
+	Major       int    `json:"major,omitempty"`       // the major number, e.g. 10 for misc devices
+	Permissions string `json:"permissions,omitempty"` // e.g. "rw"
+	Replicas    int    `json:"replicas,omitempty"`    // shareable IDs per device
+	UpperLimit  int    `json:"upper-limit,omitempty"` // allocations a device can hold at once
+}
+
+// DeviceRule allows or denies the devices it matches. Rules are evaluated in order and the first
+// matching rule decides. Every matcher that is set must match; a rule without matchers matches all devices.
+type DeviceRule struct {
+	Comment  string          `json:"comment,omitempty"`
+	Action   string          `json:"action"`             // "allow" or "deny"
+	Glob     string          `json:"glob,omitempty"`     // matched against /dev/<name> and its aliases, e.g. "/dev/mapper/oradata_*"
+	Regex    string          `json:"regex,omitempty"`    // must match a whole name, e.g. "/dev/dm-[0-9]+"
+	Selector *DeviceSelector `json:"selector,omitempty"` // device attributes
+}
+
+// DeviceSelector matches devices on their attributes. Every field that is set must match;
+// string fields are case-insensitive glob patterns.
+type DeviceSelector struct {
+	Vendor     string `json:"vendor,omitempty"` // e.g. "IBM"
+	Model      string `json:"model,omitempty"`  // e.g. "2145"
+	Serial     string `json:"serial,omitempty"`
+	WWN        string `json:"wwn,omitempty"`         // e.g. "0x6005076*"
+	FSType     string `json:"fstype,omitempty"`      // "none" matches devices without a filesystem
+	Label      string `json:"label,omitempty"`       // filesystem or partition label
+	DMName     string `json:"dm-name,omitempty"`     // e.g. "oradata_*"
+	DMUUID     string `json:"dm-uuid,omitempty"`     // e.g. "mpath-*"
+	Transport  string `json:"transport,omitempty"`   // "fc", "iscsi", "vscsi", "nvme", "virtio", "sas", "sata", "scsi"
+	Type       string `json:"type,omitempty"`        // "disk", "partition" or "char"
+	SysfsClass string `json:"sysfs-class,omitempty"` // of a character device, e.g. "tpmrm"
+	Major      int    `json:"major,omitempty"`       // of a character device
+	MinSize    string `json:"min-size,omitempty"`    // Kubernetes quantity, e.g. "100Gi"
+	MaxSize    string `json:"max-size,omitempty"`
+	Rotational *bool  `json:"rotational,omitempty"`
+}
+
+// PermissionRule sets the cgroup permissions of the devices it matches, overriding permissions.
+// The first matching rule applies; matchers work like those of DeviceRule.
+type PermissionRule struct {
+	Comment     string          `json:"comment,omitempty"`
+	Glob        string          `json:"glob,omitempty"`
+	Regex       string          `json:"regex,omitempty"`
+	Selector    *DeviceSelector `json:"selector,omitempty"`
+	Permissions string          `json:"permissions"` // e.g. "r" for backup LUNs, "rwm" for nx-gzip
+}
+
+// ContainerPathRule sets the container path template of the devices it matches, overriding container-path.
+// The first matching rule applies; matchers work like those of DeviceRule.
+type ContainerPathRule struct {
+	Comment  string          `json:"comment,omitempty"`
+	Glob     string          `json:"glob,omitempty"`
+	Regex    string          `json:"regex,omitempty"`
+	Selector *DeviceSelector `json:"selector,omitempty"`
+	Template string          `json:"template"` // e.g. "/dev/xvd{letter}"
+}
+
+// ReplicaRule sets the number of shareable IDs of the devices it matches, overriding replicas.
+// The first matching rule applies; matchers work like those of DeviceRule.
+type ReplicaRule struct {
+	Comment  string          `json:"comment,omitempty"`
+	Glob     string          `json:"glob,omitempty"`
+	Regex    string          `json:"regex,omitempty"`
+	Selector *DeviceSelector `json:"selector,omitempty"`
+	Replicas int             `json:"replicas"` // 1 advertises the device unshared
+}
+
+// UpperLimitRule sets how many allocations the devices it matches can hold at once, overriding upper-limit.
+// The first matching rule applies; matchers work like those of DeviceRule.
+type UpperLimitRule struct {
+	Comment    string          `json:"comment,omitempty"`
+	Glob       string          `json:"glob,omitempty"`
+	Regex      string          `json:"regex,omitempty"`
+	Selector   *DeviceSelector `json:"selector,omitempty"`
+	UpperLimit int             `json:"upper-limit"` // 0 for no limit
 }
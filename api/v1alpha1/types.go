@@ -0,0 +1,89 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// PowerDeviceInventory is the per-node inventory of devices discovered by the plugin.
+// The object is cluster-scoped and named after the node.
+type PowerDeviceInventory struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PowerDeviceInventorySpec   `json:"spec"`
+	Status PowerDeviceInventoryStatus `json:"status,omitempty"`
+}
+
+// PowerDeviceInventorySpec identifies the node the inventory belongs to
+type PowerDeviceInventorySpec struct {
+	NodeName string `json:"nodeName"`
+}
+
+// PowerDeviceInventoryStatus is maintained by the plugin instance running on the node
+type PowerDeviceInventoryStatus struct {
+	// Devices is the discovered device list, sorted by name
+	Devices []DeviceStatus `json:"devices,omitempty"`
+	// DeviceCount is the number of advertised devices
+	DeviceCount int `json:"deviceCount"`
+	// AllocatedCount is the number of devices with at least one allocation
+	AllocatedCount int `json:"allocatedCount"`
+	// LastScanTime is the time of the last fresh device scan
+	LastScanTime metav1.Time `json:"lastScanTime,omitempty"`
+	// LastUpdateTime is the time the plugin last wrote this status
+	LastUpdateTime metav1.Time `json:"lastUpdateTime,omitempty"`
+	// ScanTimeouts counts the scans that did not finish within the scan timeout since the plugin started
+	ScanTimeouts int `json:"scanTimeouts,omitempty"`
+	// ProbeTimeouts counts the devices left out of a scan because their probe timed out
+	ProbeTimeouts int `json:"probeTimeouts,omitempty"`
+}
+
+// DeviceStatus is the state of a single device
+type DeviceStatus struct {
+	// Name is the device name without /dev/, e.g. dm-3
+	Name string `json:"name"`
+	// Path is the host path of the device
+	Path string `json:"path"`
+	// Health is Healthy or Unhealthy, as reported to the kubelet
+	Health string `json:"health"`
+	// Degraded is set for a multipath map with some paths down, which stays Healthy while a path is left
+	Degraded bool `json:"degraded,omitempty"`
+	// Pool is the extended resource the device is advertised under, or reserved for a device
+	// reserved-devices keeps for the node
+	Pool string `json:"pool"`
+	// Allocations is the number of containers the device is granted to
+	Allocations int `json:"allocations"`
+	// Class is the device class of a character device
+	Class string `json:"class,omitempty"`
+	// Annotations are set by the discovery hook, e.g. the CMDB record of a LUN
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// PowerDeviceInventoryList is a list of PowerDeviceInventory
+type PowerDeviceInventoryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []PowerDeviceInventory `json:"items"`
+}
@@ -2,11 +2,21 @@
 
 # This script builds the container-device-interface spec per https://github.com/cncf-tags/container-device-interface/blob/main/SPEC.md
 
+# HOST_ROOT is where the host filesystem is mounted, like the plugin's --host-root. Devices are read
+# below it and written to the spec as host paths, so the container's own /dev does not matter.
+HOST_ROOT="${HOST_ROOT:-/}"
+HOST_ROOT="${HOST_ROOT%/}"
+LSBLK=(lsblk)
+if [ -n "${HOST_ROOT}" ]
+then
+  LSBLK=(lsblk --sysroot "${HOST_ROOT}")
+fi
+
 #echo "Discovering Target Devices to load into cdi.json"
 TARGET_DEVICES=()
-for BLOCK_DEVICE in $(lsblk --json -s -f --paths --include 253 | jq -r '.blockdevices[] | select(.fstype != "xfs" and select(.label == null or .label != "boot") and select(.name | startswith("/dev/nvme") | not)) | select(.name | startswith("/dev/mapper/")) | .name')
+for BLOCK_DEVICE in $("${LSBLK[@]}" --json -s -f --paths --include 253 | jq -r '.blockdevices[] | select(.fstype != "xfs" and select(.label == null or .label != "boot") and select(.name | startswith("/dev/nvme") | not)) | select(.name | startswith("/dev/mapper/")) | .name')
 do
-    BLOCK_DETAIL=$(lsblk "${BLOCK_DEVICE}" --include 253 --noheadings --json -s -f --paths)
+    BLOCK_DETAIL=$("${LSBLK[@]}" "${BLOCK_DEVICE}" --include 253 --noheadings --json -s -f --paths)
     if [ ! -z "${BLOCK_DETAIL}" ]
     then
         # Block, Children (mapper,device)
@@ -46,14 +56,14 @@ do
 
   # symbolic link... and it exists
   SAVED_DEVICE=${DEVICE}
-  if [ -h "${DEVICE}" ]
+  if [ -h "${HOST_ROOT}${DEVICE}" ]
   then
-    TMP_DEVICE=$(readlink -f ${DEVICE})
-    DEVICE=${TMP_DEVICE}
+    TMP_DEVICE=$(readlink -f "${HOST_ROOT}${DEVICE}")
+    DEVICE=${TMP_DEVICE#"${HOST_ROOT}"}
   fi
 
   # Grab the raw "ls -l" line
-  line=$(ls -l "$DEVICE")
+  line=$(ls -l "${HOST_ROOT}${DEVICE}")
 
   # Example ls -l output for a device might be:
   # crw-rw---- 1 root tty 4, 1 Jan 16 10:00 /dev/tty1
@@ -62,7 +72,7 @@ do
   # We want the 5th field, which contains "<major>,<minor>"
   major=$(echo "$line" | awk '{print $5}' | cut -d, -f1)
 
-  minor=$(lsblk $DEVICE --noheadings --paths | sed 's|:| |g' | grep $DEVICE | awk '{print $3}')
+  minor=$("${LSBLK[@]}" $DEVICE --noheadings --paths | sed 's|:| |g' | grep $DEVICE | awk '{print $3}')
 
   if [ -z "${minor}" ]
   then
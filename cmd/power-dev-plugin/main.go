@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"flag"
 	"os"
 
 	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
@@ -25,6 +26,19 @@ import (
 
 // Launch the Plugin
 func main() {
+	hostRoot := flag.String("host-root", plugin.HostRoot(), "where the host filesystem is mounted; discovery, filtering and health checks read /dev, /sys and /run/udev below it")
+	metricsAddress := flag.String("metrics-address", "", "serve the scan and probe timeout counters in JSON at /debug/vars on this address, e.g. :9100; disabled when empty")
+	klog.InitFlags(nil)
+	flag.Parse()
+	plugin.SetHostRoot(*hostRoot)
+	klog.Infof("Reading the host filesystem under %s", plugin.HostRoot())
+
+	if *metricsAddress != "" {
+		go func() {
+			klog.Errorf("Serving metrics on %s failed: %v", *metricsAddress, plugin.ServeMetrics(*metricsAddress))
+		}()
+	}
+
 	devicePlugin, err := plugin.New()
 	if err != nil {
 		klog.V(2).Infof("Could not create new plugin, aborting")
@@ -1,41 +1,73 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"strings"
 
-	"github.com/jaypipes/ghw"
+	"github.com/ocp-power-demos/power-dev-plugin/api"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
 )
 
 // Launch the scanner
 func main() {
-	devices, err := ScanRootForDevices()
+	hostRoot := flag.String("host-root", plugin.HostRoot(), "where the host filesystem is mounted")
+	backend := flag.String("discovery-backend", "", "overrides the discovery-backend of the config: ghw, sysfs, lsblk or static")
+	flag.Parse()
+	plugin.SetHostRoot(*hostRoot)
+
+	config, err := plugin.LoadDevicePluginConfig()
+	if err != nil {
+		fmt.Printf("Could not load config, showing default permissions: %s\n", err)
+	}
+	if *backend != "" {
+		if config == nil {
+			config = &api.DevicePluginConfig{}
+		}
+		config.DiscoveryBackend = *backend
+	}
+
+	devices, err := ScanRootForDevices(config)
 	if err != nil {
 		fmt.Printf("Could not scan devices, aborting %s", err)
 		os.Exit(2)
 	}
+
+	protected, err := plugin.NewSystemDeviceGuard().ProtectedDevices()
+	if err != nil {
+		fmt.Printf("Could not determine host system devices, the plugin would advertise none of them: %s\n", err)
+		protected = map[string]string{}
+		for _, device := range devices {
+			protected[strings.TrimPrefix(device, "/dev/")] = "host system devices unknown"
+		}
+	}
+	devices, excluded := plugin.ApplySystemDeviceGuard(devices, protected, nil)
+
+	perms, sources := plugin.NewPermissionPolicy(config, nil).ResolveAll(plugin.NewDeviceScanner(), devices)
 	for idx, device := range devices {
-		fmt.Printf("%d - %s", idx, device)
+		fmt.Printf("%d - %s %s (%s)\n", idx, device, perms[device], sources[device])
+	}
+	for device, reason := range excluded {
+		fmt.Printf("excluded for safety - %s (%s)\n", device, reason)
 	}
 }
 
-// scans the local disk using ghw to find the blockdevices
-func ScanRootForDevices() ([]string, error) {
-	// relies on GHW_CHROOT=/host/dev
-	// lsblk -f --json --paths -s | jq -r '.blockdevices[] | select(.fstype != "xfs")' | grep mpath | grep -v fstype | sort -u | wc -l
-	// This may be the best way to get the devices.
-	block, err := ghw.Block()
+// scans the host mounted at --host-root with the configured discovery backend to find the partitions
+func ScanRootForDevices(config *api.DevicePluginConfig) ([]string, error) {
+	backend := plugin.NewDiscoveryBackend(plugin.HostFS{Root: plugin.HostRoot()}, config)
+	found, err := backend.Discover()
 	if err != nil {
 		fmt.Printf("Error getting block storage info: %v", err)
 		return nil, err
 	}
 	devices := []string{}
-	fmt.Printf("DEVICE: %v\n", block)
-	for _, disk := range block.Disks {
-		fmt.Printf("    - DISK: %v\n", disk.Name)
-		for _, part := range disk.Partitions {
-			fmt.Printf("        - PART: %v\n", part.Disk.Name)
-			devices = append(devices, part.Name)
+	fmt.Printf("DEVICES (%s backend): %d\n", backend.Name(), len(found))
+	for _, dev := range found {
+		fmt.Printf("    - %s %s (%s, %d bytes) parents: %v children: %v\n",
+			strings.ToUpper(dev.Type), dev.Name, dev.MajMin, dev.SizeBytes, dev.Parents, dev.Children)
+		if dev.Type == plugin.DeviceTypePartition {
+			devices = append(devices, dev.Name)
 		}
 	}
 	return devices, nil
@@ -0,0 +1,27 @@
+#!/usr/bin/env bash
+
+# Regenerates the deepcopy functions and the typed clientset for api/v1alpha1.
+# Requires deepcopy-gen and client-gen from k8s.io/code-generator on the PATH:
+#   go install k8s.io/code-generator/cmd/{deepcopy-gen,client-gen}@v0.36.4
+
+set -o errexit
+set -o nounset
+set -o pipefail
+
+MODULE=github.com/ocp-power-demos/power-dev-plugin
+ROOT=$(dirname "${BASH_SOURCE[0]}")/..
+cd "${ROOT}"
+
+deepcopy-gen \
+    --output-file zz_generated.deepcopy.go \
+    --go-header-file hack/boilerplate.go.txt \
+    ./api/v1alpha1
+
+rm -rf pkg/client/clientset
+client-gen \
+    --clientset-name versioned \
+    --input-base "${MODULE}" \
+    --input api/v1alpha1 \
+    --output-pkg "${MODULE}/pkg/client/clientset" \
+    --output-dir pkg/client/clientset \
+    --go-header-file hack/boilerplate.go.txt
@@ -0,0 +1,136 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/klog"
+)
+
+// aliasDirs are the udev symlink directories under /dev that name block devices stably
+var aliasDirs = []string{
+	"disk/by-id",
+	"disk/by-path",
+	"disk/by-uuid",
+	"disk/by-label",
+	"disk/by-partuuid",
+	"disk/by-partlabel",
+	"mapper",
+}
+
+// DeviceAliases maps a kernel name (dm-3) to the stable /dev paths pointing at it
+// (/dev/disk/by-id/wwn-0x6005076..., /dev/mapper/mpatha)
+type DeviceAliases map[string][]string
+
+// AliasScanner is implemented by scanners that can resolve the stable names of devices.
+// Without it, include and exclude patterns only match the /dev/<name> path.
+type AliasScanner interface {
+	DeviceAliases() (DeviceAliases, error)
+}
+
+// ReadDeviceAliases resolves the symlinks of the alias directories under devRoot.
+// The aliases are returned as /dev paths, sorted, whatever devRoot is.
+func ReadDeviceAliases(devRoot string) (DeviceAliases, error) {
+	if _, err := os.Stat(devRoot); err != nil {
+		return nil, err
+	}
+	aliases := DeviceAliases{}
+	for _, dir := range aliasDirs {
+		for _, entry := range readSysfsDir(filepath.Join(devRoot, dir)) {
+			// by-id and friends link relatively, e.g. ../../dm-3; mapper/control is not a link
+			target, err := os.Readlink(filepath.Join(devRoot, dir, entry))
+			if err != nil {
+				continue
+			}
+			name := filepath.Base(target)
+			aliases[name] = append(aliases[name], "/dev/"+dir+"/"+entry)
+		}
+	}
+	for name := range aliases {
+		sort.Strings(aliases[name])
+	}
+	return aliases, nil
+}
+
+// Names returns every path a device can be matched by: as given, /dev/<name> and its aliases
+func (a DeviceAliases) Names(dev string) []string {
+	name := strings.TrimPrefix(dev, "/dev/")
+	names := []string{dev}
+	if canonical := "/dev/" + name; canonical != dev {
+		names = append(names, canonical)
+	}
+	return append(names, a[name]...)
+}
+
+// deviceAliases reads the aliases when the scanner supports it
+func deviceAliases(scanner DeviceScanner) DeviceAliases {
+	aliasScanner, ok := scanner.(AliasScanner)
+	if !ok {
+		return nil
+	}
+	aliases, err := aliasScanner.DeviceAliases()
+	if err != nil {
+		klog.Warningf("Unable to resolve device aliases, matching /dev/<name> only: %v", err)
+		return nil
+	}
+	return aliases
+}
+
+// MatchPattern is filepath.Match where a ** path element matches any number of elements,
+// e.g. /dev/disk/**/wwn-0x6005076*
+func MatchPattern(pattern, path string) (bool, error) {
+	if !strings.Contains(pattern, "**") {
+		return filepath.Match(pattern, path)
+	}
+	return matchElements(strings.Split(pattern, "/"), strings.Split(path, "/"))
+}
+
+func matchElements(pattern, path []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matched, err := matchElements(pattern[1:], path[i:]); err != nil || matched {
+					return matched, err
+				}
+			}
+			return false, nil
+		}
+		if len(path) == 0 {
+			return false, nil
+		}
+		matched, err := filepath.Match(pattern[0], path[0])
+		if err != nil || !matched {
+			return false, err
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0, nil
+}
+
+// MatchesAnyName reports whether any of the names of a device matches any of the patterns
+func MatchesAnyName(names []string, patterns []string) bool {
+	for _, name := range names {
+		if MatchesAny(name, patterns) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// allocation is everything an Allocate call resolves once and shares between its containers
+type allocation struct {
+	devices       []string
+	reserved      []string
+	policy        AllocationPolicy
+	multipathMode string
+	maps          map[string]*MultipathMap
+	permPolicy    *PermissionPolicy
+	pathPolicy    *ContainerPathPolicy
+	limitPolicy   *UpperLimitPolicy
+	aliases       DeviceAliases
+	attrs         map[string]*DeviceAttributes
+	// classes are the device classes of the character devices, by device name
+	classes map[string]string
+	// grants are the containers served so far, they replace nothing until the whole request is served
+	grants []grant
+}
+
+// allocateContainer computes the response of one container against usage, which it updates with
+// the devices it grants. The audit record is returned whether the container is served or rejected.
+func (p *PowerPlugin) allocateContainer(a *allocation, i int, req *pluginapi.ContainerAllocateRequest, usage map[string]int) (*pluginapi.ContainerAllocateResponse, AuditRecord, error) {
+	klog.Infof("Handling container request %d: %+v", i, req)
+
+	audit := AuditRecord{
+		ContainerIndex: i,
+		RequestedIDs:   req.DevicesIds,
+		UpperLimit:     auditLimit(a.limitPolicy.Default()),
+	}
+
+	decision, err := a.Select(AllocationRequest{
+		ContainerIndex: i,
+		RequestedIDs:   req.DevicesIds,
+		Devices:        a.devices,
+		Reserved:       a.reserved,
+		Usage:          usage,
+		Limit: func(dev string) int {
+			return a.limitPolicy.Limit(dev, a.aliases, a.attrs[strings.TrimPrefix(dev, "/dev/")])
+		},
+	})
+	audit.LimitSkipped = decision.LimitSkipped
+	if err == nil && len(decision.Devices) == 0 {
+		err = status.Errorf(codes.ResourceExhausted, "allocation policy %s selected no devices for container %d", a.policy.Name(), i)
+	}
+	if err != nil {
+		klog.Errorf("Allocation policy %s rejected container %d: %v", a.policy.Name(), i, err)
+		audit.Result, audit.Error = AuditResultRejected, err.Error()
+		return nil, audit, err
+	}
+
+	ds := []*pluginapi.DeviceSpec{}
+	vfioContainer := false
+	for allocated, dev := range decision.Devices {
+		devPath := devicePath(dev)
+		name := strings.TrimPrefix(devPath, "/dev/")
+		perm, permSource := a.permPolicy.Resolve(dev, a.aliases, a.attrs[name])
+		m := a.maps[name]
+
+		// the template names the device itself, the extra paths of a multipath map keep their host path
+		containerPath := devPath
+		hostPaths := []string{devPath}
+		if m != nil {
+			hostPaths = MultipathDevicePaths(m, a.multipathMode)
+			containerPath = hostPaths[0]
+		}
+		// an IOMMU group is opened through the VFIO container node, which a container gets once
+		if isVFIOGroup(devPath) && !vfioContainer {
+			hostPaths = append(hostPaths, VFIOContainerDevice)
+			vfioContainer = true
+		}
+		if template := a.pathPolicy.Template(dev, a.aliases, a.attrs[name]); template != "" {
+			rendered, err := RenderContainerPath(template, NewContainerPathVars(devPath, allocated, a.aliases, m))
+			if err != nil {
+				return p.rejectPaths(audit, i, err)
+			}
+			containerPath = rendered
+		}
+
+		usage[devPath]++
+		klog.Infof("Allocating device %s to container at %s with permissions %s from %s. New usage: %d", dev, containerPath, perm, permSource, usage[devPath])
+
+		for j, hostPath := range hostPaths {
+			devContainerPath := hostPath
+			if j == 0 {
+				devContainerPath = containerPath
+			}
+			ds = append(ds, &pluginapi.DeviceSpec{
+				HostPath:      hostPath,
+				ContainerPath: devContainerPath,
+				// Per DeviceSpec:
+				// Cgroups permissions of the device, candidates are one or more of
+				// * r - allows container to read from the specified device.
+				// * w - allows container to write to the specified device.
+				// * m - allows container to create device files that do not yet exist.
+				// We don't need `m`, unless a permission rule grants it
+				Permissions: perm,
+			})
+			audit.Devices = append(audit.Devices, AuditDevice{
+				HostPath:         hostPath,
+				ContainerPath:    devContainerPath,
+				Permissions:      perm,
+				PermissionSource: permSource,
+			})
+		}
+	}
+	if err := CheckContainerPathCollisions(ds); err != nil {
+		return p.rejectPaths(audit, i, err)
+	}
+	audit.Result = AuditResultGranted
+	granted := make([]string, 0, len(decision.Devices))
+	for _, dev := range decision.Devices {
+		granted = append(granted, devicePath(dev))
+	}
+	a.grants = append(a.grants, grant{key: grantKey(req.DevicesIds), devices: granted, at: time.Now()})
+
+	response := &pluginapi.ContainerAllocateResponse{
+		Devices: ds,
+	}
+	klog.Infof("Allocate response for container %d: %+v", i, response)
+	return response, audit, nil
+}
+
+// Select runs the policy over the block devices and the requested class devices apart. Class devices
+// are always resolved from the requested IDs, so a policy such as grant-all never hands the IOMMU groups
+// or the TPM of the node to a container that did not ask for them.
+func (a *allocation) Select(req AllocationRequest) (AllocationDecision, error) {
+	if len(a.classes) == 0 {
+		return a.policy.Select(req)
+	}
+	blockReq, classReq := req, req
+	blockReq.RequestedIDs, classReq.RequestedIDs = a.splitClasses(req.RequestedIDs, PhysicalDeviceID)
+	blockReq.Devices, classReq.Devices = a.splitClasses(req.Devices, deviceID)
+	blockReq.Reserved, classReq.Reserved = a.splitClasses(req.Reserved, deviceID)
+
+	decision := AllocationDecision{}
+	if len(blockReq.RequestedIDs) > 0 || len(classReq.RequestedIDs) == 0 {
+		blocks, err := a.policy.Select(blockReq)
+		if err != nil {
+			return blocks, err
+		}
+		decision = blocks
+	}
+	if len(classReq.RequestedIDs) > 0 {
+		classes, err := a.selectClassDevices(classReq)
+		decision.LimitSkipped = append(decision.LimitSkipped, classes.LimitSkipped...)
+		if err != nil {
+			return AllocationDecision{LimitSkipped: decision.LimitSkipped}, err
+		}
+		decision.Devices = append(decision.Devices, classes.Devices...)
+	}
+	return decision, nil
+}
+
+// selectClassDevices keeps what the policy grants of the requested class devices and rejects the
+// container when it leaves one of them out
+func (a *allocation) selectClassDevices(req AllocationRequest) (AllocationDecision, error) {
+	requested, err := requestedDevices(req)
+	if err != nil {
+		return AllocationDecision{}, err
+	}
+	selected, err := a.policy.Select(req)
+	if err != nil {
+		return selected, err
+	}
+	granted, skipped := map[string]bool{}, map[string]bool{}
+	for _, dev := range selected.Devices {
+		granted[dev] = true
+	}
+	for _, path := range selected.LimitSkipped {
+		skipped[path] = true
+	}
+	decision, missing := AllocationDecision{}, []string{}
+	for _, dev := range requested {
+		switch {
+		case granted[dev]:
+			decision.Devices = append(decision.Devices, dev)
+		case skipped[devicePath(dev)]:
+			decision.LimitSkipped = append(decision.LimitSkipped, devicePath(dev))
+			missing = append(missing, devicePath(dev))
+		default:
+			missing = append(missing, devicePath(dev))
+		}
+	}
+	if len(missing) > 0 {
+		return AllocationDecision{LimitSkipped: decision.LimitSkipped}, status.Errorf(codes.ResourceExhausted,
+			"allocation policy %s did not grant the requested class devices to container %d: %s", a.policy.Name(), req.ContainerIndex, strings.Join(missing, ", "))
+	}
+	return decision, nil
+}
+
+// splitClasses splits devices or IDs into those of the block devices and those of the class devices
+func (a *allocation) splitClasses(names []string, id func(string) string) ([]string, []string) {
+	blocks, classes := []string{}, []string{}
+	for _, name := range names {
+		if a.classes[id(name)] != "" {
+			classes = append(classes, name)
+		} else {
+			blocks = append(blocks, name)
+		}
+	}
+	return blocks, classes
+}
+
+// rejectPaths turns a container path error into the rejection of container i
+func (p *PowerPlugin) rejectPaths(audit AuditRecord, i int, pathErr error) (*pluginapi.ContainerAllocateResponse, AuditRecord, error) {
+	klog.Errorf("Invalid container paths for container %d: %v", i, pathErr)
+	err := fmt.Errorf("invalid container paths for container %d: %w", i, pathErr)
+	audit.Devices = nil
+	audit.Result, audit.Error = AuditResultRejected, err.Error()
+	return nil, audit, err
+}
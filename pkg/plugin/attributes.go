@@ -0,0 +1,303 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ocp-power-demos/power-dev-plugin/api"
+	k8sresource "k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog"
+)
+
+const (
+	DeviceTypeDisk      = "disk"
+	DeviceTypePartition = "partition"
+	DeviceTypeChar      = "char"
+
+	fsTypeNone = "none"
+)
+
+// DeviceAttributes are the properties of a device selectors can match on
+type DeviceAttributes struct {
+	Name       string
+	Type       string
+	SizeBytes  uint64
+	Vendor     string
+	Model      string
+	Serial     string
+	WWN        string
+	FSType     string
+	Label      string
+	DMName     string
+	DMUUID     string
+	Transport  string
+	Rotational bool
+	// SysfsClass and Major are set for character devices
+	SysfsClass string
+	Major      int
+}
+
+// AttributeScanner is implemented by scanners that can describe devices.
+// Without it, include selectors match nothing and exclude selectors exclude nothing.
+type AttributeScanner interface {
+	DeviceAttributes(devices []string) (map[string]*DeviceAttributes, error)
+}
+
+// ghwValue drops the placeholder ghw uses for unknown values
+func ghwValue(v string) string {
+	if v == "unknown" {
+		return ""
+	}
+	return v
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// AttributeReader reads device attributes from sysfs and the udev database
+type AttributeReader struct {
+	SysRoot  string
+	UdevRoot string
+}
+
+// Read returns the attributes of each device that exists, keyed by the kernel name (dm-3, sda1)
+func (a *AttributeReader) Read(devices []string) map[string]*DeviceAttributes {
+	attrs := map[string]*DeviceAttributes{}
+	for _, dev := range devices {
+		name := strings.TrimPrefix(dev, "/dev/")
+		if attr := a.readDevice(name); attr != nil {
+			attrs[name] = attr
+		}
+	}
+	return attrs
+}
+
+func (a *AttributeReader) readDevice(name string) *DeviceAttributes {
+	dir, err := filepath.EvalSymlinks(filepath.Join(a.SysRoot, "class", "block", name))
+	if err != nil {
+		return nil
+	}
+
+	attr := &DeviceAttributes{Name: name, Type: DeviceTypeDisk}
+	diskDir := dir
+	if _, err := os.Stat(filepath.Join(dir, "partition")); err == nil {
+		attr.Type = DeviceTypePartition
+		diskDir = filepath.Dir(dir)
+	}
+	if sectors, err := strconv.ParseUint(readSysfsString(filepath.Join(dir, "size")), 10, 64); err == nil {
+		attr.SizeBytes = sectors * 512
+	}
+	attr.Vendor = readSysfsString(filepath.Join(diskDir, "device", "vendor"))
+	attr.Model = readSysfsString(filepath.Join(diskDir, "device", "model"))
+	attr.Serial = readSysfsString(filepath.Join(diskDir, "device", "serial"))
+	attr.WWN = firstNonEmpty(readSysfsString(filepath.Join(diskDir, "device", "wwid")), readSysfsString(filepath.Join(diskDir, "wwid")))
+	attr.Rotational = readSysfsString(filepath.Join(diskDir, "queue", "rotational")) == "1"
+	attr.DMName = readSysfsString(filepath.Join(dir, "dm", "name"))
+	attr.DMUUID = readSysfsString(filepath.Join(dir, "dm", "uuid"))
+	attr.Transport = transportFromPath(diskDir)
+
+	udev := a.readUdev(readSysfsString(filepath.Join(dir, "dev")))
+	attr.FSType = udev["ID_FS_TYPE"]
+	attr.Label = firstNonEmpty(udev["ID_FS_LABEL"], udev["ID_PART_ENTRY_NAME"])
+	attr.Vendor = firstNonEmpty(attr.Vendor, udev["ID_VENDOR"])
+	attr.Model = firstNonEmpty(attr.Model, udev["ID_MODEL"])
+	attr.Serial = firstNonEmpty(attr.Serial, udev["ID_SERIAL_SHORT"], udev["ID_SERIAL"])
+	attr.WWN = firstNonEmpty(attr.WWN, udev["ID_WWN_WITH_EXTENSION"], udev["ID_WWN"])
+	attr.Transport = firstNonEmpty(attr.Transport, transportFromIDPath(udev["ID_PATH"]))
+
+	// a dm device (multipath map, LV) describes the LUN through its first slave
+	if slaves := readSysfsDir(filepath.Join(diskDir, "slaves")); len(slaves) > 0 {
+		if slave := a.readDevice(slaves[0]); slave != nil {
+			attr.Vendor = firstNonEmpty(attr.Vendor, slave.Vendor)
+			attr.Model = firstNonEmpty(attr.Model, slave.Model)
+			attr.Serial = firstNonEmpty(attr.Serial, slave.Serial)
+			attr.WWN = firstNonEmpty(attr.WWN, slave.WWN)
+			attr.Transport = firstNonEmpty(attr.Transport, slave.Transport)
+			attr.Rotational = attr.Rotational || slave.Rotational
+		}
+	}
+	for _, v := range []*string{&attr.Vendor, &attr.Model, &attr.Serial, &attr.WWN} {
+		*v = strings.TrimSpace(*v)
+	}
+	return attr
+}
+
+// readUdev reads the E: properties of the udev database entry for a block device number (8:1)
+func (a *AttributeReader) readUdev(devNumber string) map[string]string {
+	properties := map[string]string{}
+	if devNumber == "" || a.UdevRoot == "" {
+		return properties
+	}
+	file, err := os.Open(filepath.Join(a.UdevRoot, "b"+devNumber))
+	if err != nil {
+		return properties
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "E:") {
+			continue
+		}
+		if key, value, ok := strings.Cut(strings.TrimPrefix(line, "E:"), "="); ok {
+			properties[key] = value
+		}
+	}
+	return properties
+}
+
+// transportFromPath derives the transport from the resolved sysfs device path
+func transportFromPath(path string) string {
+	switch {
+	case strings.Contains(path, "/rport-"):
+		return "fc"
+	case strings.Contains(path, "/session") && strings.Contains(path, "iscsi"), strings.Contains(path, "/iscsi"):
+		return "iscsi"
+	case strings.Contains(path, "/vio/"):
+		return "vscsi"
+	case strings.Contains(path, "/nvme"):
+		return "nvme"
+	case strings.Contains(path, "/virtio"):
+		return "virtio"
+	case strings.Contains(path, "/end_device-"):
+		return "sas"
+	case strings.Contains(path, "/ata"):
+		return "sata"
+	case strings.Contains(path, "/target"):
+		return "scsi"
+	}
+	return ""
+}
+
+// transportFromIDPath derives the transport from the udev ID_PATH, e.g. pci-0000:01:00.0-fc-0x5005076810123456-lun-0
+func transportFromIDPath(idPath string) string {
+	switch {
+	case strings.Contains(idPath, "-fc-"):
+		return "fc"
+	case strings.Contains(idPath, "-iscsi-"):
+		return "iscsi"
+	case strings.HasPrefix(idPath, "vio-"):
+		return "vscsi"
+	case strings.Contains(idPath, "-nvme-"):
+		return "nvme"
+	case strings.Contains(idPath, "-sas-"):
+		return "sas"
+	case strings.Contains(idPath, "-ata-"):
+		return "sata"
+	}
+	return ""
+}
+
+// MatchesSelector reports whether the attributes satisfy every field set in the selector
+func MatchesSelector(attr *DeviceAttributes, selector api.DeviceSelector) bool {
+	if attr == nil {
+		return false
+	}
+	fields := []struct{ pattern, value string }{
+		{selector.Vendor, attr.Vendor},
+		{selector.Model, attr.Model},
+		{selector.Serial, attr.Serial},
+		{selector.WWN, attr.WWN},
+		{selector.Label, attr.Label},
+		{selector.DMName, attr.DMName},
+		{selector.DMUUID, attr.DMUUID},
+		{selector.Transport, attr.Transport},
+		{selector.Type, attr.Type},
+		{selector.SysfsClass, attr.SysfsClass},
+	}
+	for _, f := range fields {
+		if f.pattern != "" && !matchesFold(f.pattern, f.value) {
+			return false
+		}
+	}
+	if selector.FSType != "" {
+		if strings.EqualFold(selector.FSType, fsTypeNone) {
+			if attr.FSType != "" {
+				return false
+			}
+		} else if !matchesFold(selector.FSType, attr.FSType) {
+			return false
+		}
+	}
+	if selector.Major != 0 && selector.Major != attr.Major {
+		return false
+	}
+	if selector.Rotational != nil && *selector.Rotational != attr.Rotational {
+		return false
+	}
+	if selector.MinSize != "" {
+		min, ok := quantityBytes(selector.MinSize)
+		if !ok || attr.SizeBytes < min {
+			return false
+		}
+	}
+	if selector.MaxSize != "" {
+		max, ok := quantityBytes(selector.MaxSize)
+		if !ok || attr.SizeBytes > max {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesFold(pattern, value string) bool {
+	matched, err := filepath.Match(strings.ToLower(pattern), strings.ToLower(value))
+	if err != nil {
+		klog.Warningf("Invalid selector pattern: %s. Skipping...", pattern)
+		return false
+	}
+	return matched
+}
+
+// quantityBytes parses a Kubernetes quantity such as 100Gi or 1T
+func quantityBytes(quantity string) (uint64, bool) {
+	q, err := k8sresource.ParseQuantity(quantity)
+	if err != nil || q.Sign() < 0 {
+		klog.Warningf("Invalid selector size %s: %v", quantity, err)
+		return 0, false
+	}
+	return uint64(q.Value()), true
+}
+
+// deviceAttributes reads the attributes of devices when a rule matches on them and the scanner supports it
+func deviceAttributes(scanner DeviceScanner, devices []string, needed bool) map[string]*DeviceAttributes {
+	if !needed {
+		return nil
+	}
+	attrScanner, ok := scanner.(AttributeScanner)
+	if !ok {
+		klog.Warning("Device selectors are configured but the scanner cannot read device attributes")
+		return nil
+	}
+	attrs, err := attrScanner.DeviceAttributes(devices)
+	if err != nil {
+		klog.Warningf("Unable to read device attributes: %v", err)
+	}
+	return attrs
+}
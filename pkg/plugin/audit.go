@@ -0,0 +1,391 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ocp-power-demos/power-dev-plugin/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"k8s.io/klog"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+const (
+	AuditEventAllocate    = "allocate"
+	AuditEventPodResolved = "pod-resolved"
+
+	AuditResultGranted  = "granted"
+	AuditResultRejected = "rejected"
+	// AuditResultRolledBack marks a container that could be served, but whose request was rejected
+	// because of another container
+	AuditResultRolledBack = "rolled-back"
+
+	defaultAuditMaxSizeMB  = 10
+	defaultAuditMaxBackups = 3
+
+	podResourcesSocket = "/var/lib/kubelet/pod-resources/kubelet.sock"
+	podResolveAttempts = 15
+	podResolveInterval = 2 * time.Second
+)
+
+// AuditDevice is a device granted to a container
+type AuditDevice struct {
+	HostPath      string `json:"host-path"`
+	ContainerPath string `json:"container-path"`
+	Permissions   string `json:"permissions"`
+	// PermissionSource is the permission rule that set Permissions, or "permissions" for the default
+	PermissionSource string `json:"permission-source,omitempty"`
+}
+
+// PodIdentity is the pod and container a set of device IDs was allocated to
+type PodIdentity struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Container string `json:"container"`
+}
+
+// AuditRecord is a single line of the audit log.
+// An "allocate" record is written for every container of an Allocate call; once the kubelet
+// reports the owning pod a "pod-resolved" record with the same ID is appended.
+type AuditRecord struct {
+	Time           time.Time     `json:"time"`
+	Event          string        `json:"event"`
+	ID             string        `json:"id"`
+	ContainerIndex int           `json:"container-index"`
+	RequestedIDs   []string      `json:"requested-ids"`
+	Result         string        `json:"result,omitempty"`
+	Error          string        `json:"error,omitempty"`
+	Devices        []AuditDevice `json:"devices,omitempty"`
+	UpperLimit     int           `json:"upper-limit,omitempty"`
+	LimitSkipped   []string      `json:"limit-skipped,omitempty"`
+	Pod            *PodIdentity  `json:"pod,omitempty"`
+}
+
+// AuditLogger appends JSON-lines records to a file, rotating it by size.
+// It is safe for concurrent use, and a nil *AuditLogger drops everything.
+type AuditLogger struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mutex sync.Mutex
+	// file is nil after a failed rotation, until the next write opens it again
+	file   *os.File
+	closed bool
+	size   int64
+	seq    atomic.Uint64
+}
+
+// NewAuditLogger opens (or creates) the audit log at path, rotating once it grows past maxSizeMB
+// and keeping maxBackups rotated files
+func NewAuditLogger(path string, maxSizeMB int, maxBackups int) (*AuditLogger, error) {
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultAuditMaxSizeMB
+	}
+	if maxBackups <= 0 {
+		maxBackups = defaultAuditMaxBackups
+	}
+	a := &AuditLogger{
+		path:       filepath.Clean(path),
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxBackups: maxBackups,
+	}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// NewAuditLoggerFromConfig creates the audit logger when audit-log is set, nil otherwise
+func NewAuditLoggerFromConfig(config *api.DevicePluginConfig) *AuditLogger {
+	if config == nil || config.AuditLog == "" {
+		return nil
+	}
+	a, err := NewAuditLogger(config.AuditLog, config.AuditLogMaxSize, config.AuditLogMaxBackups)
+	if err != nil {
+		klog.Errorf("Unable to open audit log %s, allocations are not audited: %v", config.AuditLog, err)
+		return nil
+	}
+	klog.Infof("Auditing allocations to %s", config.AuditLog)
+	return a
+}
+
+// auditSettings are the audit-log settings of a config, the audit logger is rebuilt when they change
+type auditSettings struct {
+	path       string
+	maxSize    int
+	maxBackups int
+}
+
+func auditSettingsOf(config *api.DevicePluginConfig) auditSettings {
+	if config == nil || config.AuditLog == "" {
+		return auditSettings{}
+	}
+	return auditSettings{path: config.AuditLog, maxSize: config.AuditLogMaxSize, maxBackups: config.AuditLogMaxBackups}
+}
+
+// configureAudit opens the audit log of the config of a scan and closes the previous one when the
+// audit-log settings changed since the last scan
+func (p *PowerPlugin) configureAudit(config *api.DevicePluginConfig) {
+	settings := auditSettingsOf(config)
+	p.auditLock.Lock()
+	defer p.auditLock.Unlock()
+	if settings == p.auditSettings {
+		return
+	}
+	previous := p.audit
+	p.audit, p.auditSettings = NewAuditLoggerFromConfig(config), settings
+	if previous != nil {
+		klog.Infof("The audit-log settings changed, closing %s", previous.path)
+		if err := previous.Close(); err != nil {
+			klog.Warningf("Unable to close audit log %s: %v", previous.path, err)
+		}
+	}
+}
+
+// auditLogger returns Audit when the program set it, else the audit logger of the last scan's config
+func (p *PowerPlugin) auditLogger() *AuditLogger {
+	if p.Audit != nil {
+		return p.Audit
+	}
+	p.auditLock.Lock()
+	defer p.auditLock.Unlock()
+	return p.audit
+}
+
+func (a *AuditLogger) open() error {
+	if err := os.MkdirAll(filepath.Dir(a.path), 0750); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	a.file = file
+	a.size = info.Size()
+	return nil
+}
+
+// rotate shifts path.N-1 to path.N, ..., path to path.1 and opens a fresh file, must hold the mutex.
+// When it fails, the file is left closed and the next write opens it again.
+func (a *AuditLogger) rotate() error {
+	err := a.file.Close()
+	a.file = nil
+	if err != nil {
+		return err
+	}
+	for i := a.maxBackups - 1; i >= 1; i-- {
+		src := fmt.Sprintf("%s.%d", a.path, i)
+		if err := os.Rename(src, fmt.Sprintf("%s.%d", a.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(a.path, a.path+".1"); err != nil {
+		return err
+	}
+	return a.open()
+}
+
+// NextID returns a unique ID to correlate the records of one allocation
+func (a *AuditLogger) NextID() string {
+	if a == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", time.Now().UnixNano(), a.seq.Add(1))
+}
+
+// Write appends the record as one JSON line
+func (a *AuditLogger) Write(record AuditRecord) error {
+	if a == nil {
+		return nil
+	}
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.closed {
+		return os.ErrClosed
+	}
+	if a.file == nil {
+		if err := a.open(); err != nil {
+			return fmt.Errorf("reopening after a failed rotation: %w", err)
+		}
+	}
+	if a.size > 0 && a.size+int64(len(line)) > a.maxSize {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	return err
+}
+
+// Close closes the audit log
+func (a *AuditLogger) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.closed = true
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+
+// PodResolver finds the pod a set of device IDs of a resource is assigned to
+type PodResolver interface {
+	Resolve(ctx context.Context, resourceName string, deviceIDs []string) (*PodIdentity, error)
+}
+
+// kubeletPodResolver queries the kubelet PodResources API
+type kubeletPodResolver struct {
+	socket string
+}
+
+// NewKubeletPodResolver creates a resolver using the kubelet PodResources socket
+func NewKubeletPodResolver() PodResolver {
+	return &kubeletPodResolver{socket: podResourcesSocket}
+}
+
+// NewKubeletAllocationLister creates a lister using the kubelet PodResources socket
+func NewKubeletAllocationLister() AllocationLister {
+	return &kubeletPodResolver{socket: podResourcesSocket}
+}
+
+func (k *kubeletPodResolver) Resolve(ctx context.Context, resourceName string, deviceIDs []string) (*PodIdentity, error) {
+	resp, err := k.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return FindPodForDevices(resp, resourceName, deviceIDs), nil
+}
+
+// list returns the resources of the pods the kubelet runs
+func (k *kubeletPodResolver) list(ctx context.Context) (*podresourcesapi.ListPodResourcesResponse, error) {
+	if _, err := os.Stat(k.socket); err != nil {
+		return nil, err
+	}
+	conn, err := grpc.NewClient(unix+":"+k.socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return podresourcesapi.NewPodResourcesListerClient(conn).List(ctx, &podresourcesapi.ListPodResourcesRequest{})
+}
+
+// FindPodForDevices returns the container whose devices of resourceName contain all deviceIDs, nil if none
+func FindPodForDevices(resp *podresourcesapi.ListPodResourcesResponse, resourceName string, deviceIDs []string) *PodIdentity {
+	if len(deviceIDs) == 0 {
+		return nil
+	}
+	for _, pod := range resp.GetPodResources() {
+		for _, container := range pod.GetContainers() {
+			assigned := map[string]bool{}
+			for _, dev := range container.GetDevices() {
+				if dev.GetResourceName() != resourceName {
+					continue
+				}
+				for _, id := range dev.GetDeviceIds() {
+					assigned[id] = true
+				}
+			}
+			all := true
+			for _, id := range deviceIDs {
+				if !assigned[id] {
+					all = false
+					break
+				}
+			}
+			if all {
+				return &PodIdentity{Namespace: pod.GetNamespace(), Name: pod.GetName(), Container: container.GetName()}
+			}
+		}
+	}
+	return nil
+}
+
+// auditAllocation writes the allocate record and, for granted containers, resolves the pod in the background.
+// The kubelet only reports the pod after Allocate returned, so the resolution is retried for a while.
+func (p *PowerPlugin) auditAllocation(record AuditRecord) {
+	audit := p.auditLogger()
+	if audit == nil {
+		return
+	}
+	record.Event = AuditEventAllocate
+	record.ID = audit.NextID()
+	if err := audit.Write(record); err != nil {
+		klog.Errorf("Unable to write audit record %s: %v", record.ID, err)
+	}
+	if record.Result != AuditResultGranted || p.PodResolver == nil {
+		return
+	}
+
+	go func() {
+		for attempt := 0; attempt < podResolveAttempts; attempt++ {
+			time.Sleep(podResolveInterval)
+			ctx, cancel := context.WithTimeout(context.Background(), podResolveInterval)
+			pod, err := p.PodResolver.Resolve(ctx, resource, record.RequestedIDs)
+			cancel()
+			if err != nil {
+				klog.V(4).Infof("Unable to resolve pod for audit record %s: %v", record.ID, err)
+				continue
+			}
+			if pod == nil {
+				continue
+			}
+			if err := audit.Write(AuditRecord{
+				Event:          AuditEventPodResolved,
+				ID:             record.ID,
+				ContainerIndex: record.ContainerIndex,
+				RequestedIDs:   record.RequestedIDs,
+				Pod:            pod,
+			}); err != nil {
+				klog.Errorf("Unable to write audit record %s: %v", record.ID, err)
+			}
+			return
+		}
+		klog.V(2).Infof("Pod for audit record %s was not reported by the kubelet", record.ID)
+	}()
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ocp-power-demos/power-dev-plugin/api"
+	"k8s.io/klog"
+)
+
+// Kinds of device classes
+const (
+	// DeviceClassKindChar classes match the character devices of /sys/class
+	DeviceClassKindChar = "char"
+	// DeviceClassKindVFIO classes match the viable IOMMU groups of the devices bound to vfio-pci
+	DeviceClassKindVFIO = "vfio"
+)
+
+// pciDevicesAnnotation lists the PCI addresses of an IOMMU group in the inventory
+const pciDevicesAnnotation = "pci-devices"
+
+// CharDevice is a character device of the host as /sys/class lists it
+type CharDevice struct {
+	// Path is the host path, e.g. /dev/tpmrm0 or /dev/vfio/12
+	Path       string
+	SysfsClass string
+	Major      int
+	Minor      int
+}
+
+// CharDeviceScanner is implemented by scanners that can list the character devices of the host.
+// Without it, device classes find no devices.
+type CharDeviceScanner interface {
+	CharDevices() ([]CharDevice, error)
+}
+
+// ReadCharDevices lists the devices of every /sys/class directory under sysRoot but block. The
+// device node is named by DEVNAME in the uevent of the device, e.g. vfio/12, else by the entry.
+func ReadCharDevices(sysRoot string) ([]CharDevice, error) {
+	classes, err := os.ReadDir(filepath.Join(sysRoot, "class"))
+	if err != nil {
+		return nil, err
+	}
+	devices := []CharDevice{}
+	for _, class := range classes {
+		if class.Name() == "block" {
+			continue
+		}
+		classDir := filepath.Join(sysRoot, "class", class.Name())
+		for _, entry := range readSysfsDir(classDir) {
+			major, minor, ok := parseDevNumber(readSysfsString(filepath.Join(classDir, entry, "dev")))
+			if !ok {
+				continue
+			}
+			name := firstNonEmpty(readUevent(filepath.Join(classDir, entry, "uevent"))["DEVNAME"], entry)
+			devices = append(devices, CharDevice{Path: "/dev/" + name, SysfsClass: class.Name(), Major: major, Minor: minor})
+		}
+	}
+	return devices, nil
+}
+
+// parseDevNumber parses the major:minor of a sysfs dev file
+func parseDevNumber(devNumber string) (int, int, bool) {
+	majorStr, minorStr, found := strings.Cut(devNumber, ":")
+	if !found {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(majorStr)
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err := strconv.Atoi(minorStr)
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
+// readUevent reads the KEY=value lines of a sysfs uevent file
+func readUevent(path string) map[string]string {
+	properties := map[string]string{}
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return properties
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if key, value, found := strings.Cut(scanner.Text(), "="); found {
+			properties[key] = value
+		}
+	}
+	return properties
+}
+
+// charAttributes are the attributes of a character device selectors can match on
+func charAttributes(dev CharDevice) *DeviceAttributes {
+	return &DeviceAttributes{
+		Name:       strings.TrimPrefix(dev.Path, "/dev/"),
+		Type:       DeviceTypeChar,
+		SysfsClass: dev.SysfsClass,
+		Major:      dev.Major,
+	}
+}
+
+// deviceClassRule is a validated device class
+type deviceClassRule struct {
+	api.DeviceClass
+	deviceMatcher
+	index int
+}
+
+// source names the class in the logs and the audit log, e.g. "device-classes[0] (tpm)"
+func (c *deviceClassRule) source() string {
+	return fmt.Sprintf("device-classes[%d] (%s)", c.index, c.Name)
+}
+
+// membersMatcher matches the devices a scan put in the class, classes is the class of each device by
+// name. The permissions, replicas and upper-limit of a class apply to them only, never to a block
+// device its glob would match too.
+func (c *deviceClassRule) membersMatcher(classes map[string]string) deviceMatcher {
+	members := map[string]bool{}
+	for name, class := range classes {
+		if class == c.Name {
+			members["/dev/"+name] = true
+		}
+	}
+	return deviceMatcher{members: members}
+}
+
+// compileDeviceClasses validates the device classes of config, invalid classes are logged and skipped
+func compileDeviceClasses(config *api.DevicePluginConfig) []deviceClassRule {
+	if config == nil {
+		return nil
+	}
+	classes := []deviceClassRule{}
+	for i, class := range config.DeviceClasses {
+		matcher, err := compileDeviceClass(class)
+		if err != nil {
+			klog.Warningf("Invalid device class %d (%s): %v. Skipping...", i, class.Name, err)
+			continue
+		}
+		if class.Kind == DeviceClassKindVFIO {
+			// a group is opened by one container at a time, whole
+			if class.UpperLimit == 0 {
+				class.UpperLimit = 1
+			}
+			if class.Replicas > 1 {
+				klog.Warningf("Device class %d (%s): IOMMU groups cannot be shared, ignoring replicas %d", i, class.Name, class.Replicas)
+			}
+			class.Replicas = 1
+		}
+		classes = append(classes, deviceClassRule{DeviceClass: class, deviceMatcher: matcher, index: i})
+	}
+	return classes
+}
+
+// compileDeviceClass turns the matchers of a class into the device matcher discovery uses. The sysfs
+// class and the major number are matched as attributes. A vfio class only matches group nodes.
+func compileDeviceClass(class api.DeviceClass) (deviceMatcher, error) {
+	if class.Name == "" {
+		return deviceMatcher{}, errors.New("name is empty")
+	}
+	regex := ""
+	switch class.Kind {
+	case "", DeviceClassKindChar:
+		if class.Glob == "" && class.SysfsClass == "" && class.Major == 0 {
+			return deviceMatcher{}, errors.New("one of glob, sysfs-class or major is required")
+		}
+	case DeviceClassKindVFIO:
+		regex = vfioGroupRegex
+	default:
+		return deviceMatcher{}, fmt.Errorf("unknown kind %q, expected %s or %s", class.Kind, DeviceClassKindChar, DeviceClassKindVFIO)
+	}
+	var selector *api.DeviceSelector
+	if class.SysfsClass != "" || class.Major != 0 {
+		selector = &api.DeviceSelector{Type: DeviceTypeChar, SysfsClass: class.SysfsClass, Major: class.Major}
+	}
+	return compileDeviceMatcher(class.Glob, regex, selector)
+}
+
+// classDevices is what the device classes found
+type classDevices struct {
+	devices []string
+	// membership is the class of each device, by device name
+	membership map[string]string
+	// annotations describe the devices in the inventory, by device name
+	annotations map[string]map[string]string
+}
+
+// discoverClassDevices returns the character devices of the device classes. A device matching
+// several classes belongs to the first.
+func discoverClassDevices(scanner DeviceScanner, config *api.DevicePluginConfig) classDevices {
+	found := classDevices{}
+	classes := compileDeviceClasses(config)
+	if len(classes) == 0 {
+		return found
+	}
+	charScanner, ok := scanner.(CharDeviceScanner)
+	if !ok {
+		klog.Warning("Device classes are configured but the scanner cannot list character devices")
+		return found
+	}
+	chars, err := charScanner.CharDevices()
+	if err != nil {
+		klog.Warningf("Unable to list character devices, device classes find no devices: %v", err)
+		return found
+	}
+
+	found.devices = []string{}
+	found.membership = map[string]string{}
+	found.annotations = map[string]map[string]string{}
+	var (
+		groups         []CharDevice
+		groupAddresses map[string]string
+		groupsRead     bool
+	)
+	for _, class := range classes {
+		candidates := chars
+		if class.Kind == DeviceClassKindVFIO {
+			// the groups are read once, whatever the number of vfio classes
+			if !groupsRead {
+				groups, groupAddresses = vfioCandidates(scanner, chars)
+				groupsRead = true
+			}
+			candidates = groups
+		}
+		count := 0
+		for _, dev := range candidates {
+			name := strings.TrimPrefix(dev.Path, "/dev/")
+			if _, claimed := found.membership[name]; claimed || !class.matches([]string{dev.Path}, charAttributes(dev)) {
+				continue
+			}
+			if err := scanner.StatDevice(dev.Path); err != nil {
+				klog.V(4).Infof("Device %s of class %s has no device node: %v", dev.Path, class.Name, err)
+				continue
+			}
+			found.devices = append(found.devices, dev.Path)
+			found.membership[name] = class.Name
+			if addresses, ok := groupAddresses[name]; ok && class.Kind == DeviceClassKindVFIO {
+				found.annotations[name] = map[string]string{pciDevicesAnnotation: addresses}
+			}
+			count++
+		}
+		klog.Infof("Device class %s matched %d devices", class.Name, count)
+	}
+	return found
+}
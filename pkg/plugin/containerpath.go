@@ -0,0 +1,197 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ocp-power-demos/power-dev-plugin/api"
+	"k8s.io/klog"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+var placeholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// containerPathPlaceholders are the placeholders a container path template can use
+var containerPathPlaceholders = map[string]bool{
+	"{name}":        true, // kernel name, dm-17
+	"{mapper-name}": true, // /dev/mapper name, mpatha
+	"{by-id}":       true, // /dev/disk/by-id name, wwn-0x6005076... preferred
+	"{index}":       true, // position of the device in the container's allocation, 0, 1, ...
+	"{letter}":      true, // the same position as a drive letter, a, b, ..., z, aa
+}
+
+// ContainerPathVars are the values substituted into a container path template
+type ContainerPathVars struct {
+	Name       string
+	MapperName string
+	ByID       string
+	Index      int
+}
+
+// NewContainerPathVars derives the template values of a device from its aliases and multipath map
+func NewContainerPathVars(dev string, index int, aliases DeviceAliases, m *MultipathMap) ContainerPathVars {
+	vars := ContainerPathVars{Name: strings.TrimPrefix(dev, "/dev/"), Index: index}
+	for _, alias := range aliases[vars.Name] {
+		switch {
+		case strings.HasPrefix(alias, "/dev/mapper/") && vars.MapperName == "":
+			vars.MapperName = path.Base(alias)
+		case strings.HasPrefix(alias, "/dev/disk/by-id/wwn-"):
+			vars.ByID = path.Base(alias)
+		case strings.HasPrefix(alias, "/dev/disk/by-id/") && vars.ByID == "":
+			vars.ByID = path.Base(alias)
+		}
+	}
+	if vars.MapperName == "" && m != nil {
+		vars.MapperName = m.Alias
+	}
+	return vars
+}
+
+// ValidateContainerPathTemplate checks the template is absolute and only uses known placeholders
+func ValidateContainerPathTemplate(template string) error {
+	if !strings.HasPrefix(template, "/") {
+		return fmt.Errorf("container path template %q is not absolute", template)
+	}
+	for _, placeholder := range placeholderPattern.FindAllString(template, -1) {
+		if !containerPathPlaceholders[placeholder] {
+			return fmt.Errorf("unknown placeholder %s in container path template %q", placeholder, template)
+		}
+	}
+	return nil
+}
+
+// RenderContainerPath substitutes the placeholders of template. It fails when a placeholder has no value
+// for the device or the result is not a clean path.
+func RenderContainerPath(template string, vars ContainerPathVars) (string, error) {
+	values := map[string]string{
+		"{name}":        vars.Name,
+		"{mapper-name}": vars.MapperName,
+		"{by-id}":       vars.ByID,
+		"{index}":       strconv.Itoa(vars.Index),
+		"{letter}":      driveLetters(vars.Index),
+	}
+	var missing []string
+	rendered := placeholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		value, ok := values[placeholder]
+		if !ok || value == "" {
+			missing = append(missing, placeholder)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("device %s has no value for %s in container path template %q", vars.Name, strings.Join(missing, ", "), template)
+	}
+	if path.Clean(rendered) != rendered {
+		return "", fmt.Errorf("container path %q of device %s is not a clean absolute path", rendered, vars.Name)
+	}
+	return rendered, nil
+}
+
+// driveLetters turns 0, 1, ..., 25, 26 into a, b, ..., z, aa like the kernel names disks
+func driveLetters(index int) string {
+	letters := ""
+	for n := index + 1; n > 0; n /= 26 {
+		n--
+		letters = string(rune('a'+n%26)) + letters
+	}
+	return letters
+}
+
+// containerPathRule is a validated container path rule
+type containerPathRule struct {
+	deviceMatcher
+	template string
+}
+
+// ContainerPathPolicy picks the container path template of each device from the container path rules,
+// falling back to container-path. An empty template keeps the host path.
+type ContainerPathPolicy struct {
+	rules           []containerPathRule
+	defaultTemplate string
+}
+
+// NewContainerPathPolicy validates the templates of config, invalid ones are logged and skipped
+func NewContainerPathPolicy(config *api.DevicePluginConfig) *ContainerPathPolicy {
+	policy := &ContainerPathPolicy{}
+	if config == nil {
+		return policy
+	}
+	if config.ContainerPath != "" {
+		if err := ValidateContainerPathTemplate(config.ContainerPath); err != nil {
+			klog.Warningf("Invalid container-path, keeping host paths: %v", err)
+		} else {
+			policy.defaultTemplate = config.ContainerPath
+		}
+	}
+	for i, rule := range config.ContainerPathRules {
+		if err := ValidateContainerPathTemplate(rule.Template); err != nil {
+			klog.Warningf("Invalid container path rule %d (%s): %v. Skipping...", i, rule.Comment, err)
+			continue
+		}
+		matcher, err := compileDeviceMatcher(rule.Glob, rule.Regex, rule.Selector)
+		if err != nil {
+			klog.Warningf("Invalid container path rule %d (%s): %v. Skipping...", i, rule.Comment, err)
+			continue
+		}
+		policy.rules = append(policy.rules, containerPathRule{deviceMatcher: matcher, template: rule.Template})
+	}
+	return policy
+}
+
+// HasTemplates reports whether any device can get a container path other than its host path
+func (p *ContainerPathPolicy) HasTemplates() bool {
+	return p.defaultTemplate != "" || len(p.rules) > 0
+}
+
+// NeedsAttributes reports whether any rule matches on device attributes
+func (p *ContainerPathPolicy) NeedsAttributes() bool {
+	for _, rule := range p.rules {
+		if rule.selector != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Template returns the container path template of a device, empty to keep the host path
+func (p *ContainerPathPolicy) Template(dev string, aliases DeviceAliases, attrs *DeviceAttributes) string {
+	names := aliases.Names(dev)
+	for _, rule := range p.rules {
+		if rule.matches(names, attrs) {
+			return rule.template
+		}
+	}
+	return p.defaultTemplate
+}
+
+// CheckContainerPathCollisions fails when two device specs of one container share a container path
+func CheckContainerPathCollisions(specs []*pluginapi.DeviceSpec) error {
+	hostPathOf := map[string]string{}
+	for _, spec := range specs {
+		if other, ok := hostPathOf[spec.ContainerPath]; ok {
+			return fmt.Errorf("container path %s collides for host devices %s and %s", spec.ContainerPath, other, spec.HostPath)
+		}
+		hostPathOf[spec.ContainerPath] = spec.HostPath
+	}
+	return nil
+}
@@ -0,0 +1,448 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jaypipes/ghw"
+	"github.com/ocp-power-demos/power-dev-plugin/api"
+	"k8s.io/klog"
+)
+
+// Discovery backends, selected with discovery-backend
+const (
+	DiscoveryBackendGhw    = "ghw"
+	DiscoveryBackendSysfs  = "sysfs"
+	DiscoveryBackendLsblk  = "lsblk"
+	DiscoveryBackendStatic = "static"
+)
+
+// BlockDevice is a device found by a DiscoveryBackend. Every backend fills in the same record.
+type BlockDevice struct {
+	// Name is the kernel name, e.g. dm-0
+	Name string
+	// Path is the host path, /dev/<name>
+	Path string
+	// MajMin is the device number, e.g. 253:0, empty when unknown
+	MajMin    string
+	SizeBytes uint64
+	// Type is DeviceTypeDisk or DeviceTypePartition
+	Type string
+	// Parents are the devices it is built on: the disk of a partition, the paths of a multipath map
+	Parents []string
+	// Children are the devices built on it: its partitions and holders
+	Children []string
+	// Vendor, Model, Serial and WWN identify a disk, they are empty when the backend does not read
+	// them; the scan reads them from sysfs and the udev database then
+	Vendor string
+	Model  string
+	Serial string
+	WWN    string
+}
+
+// DiscoveryBackend lists the block devices of the host
+type DiscoveryBackend interface {
+	Name() string
+	Discover() ([]BlockDevice, error)
+}
+
+// BackendScanner is a DeviceScanner that discovers with the backend the config selects
+type BackendScanner interface {
+	DiscoveryBackend(config *api.DevicePluginConfig) DiscoveryBackend
+}
+
+// NewDiscoveryBackend returns the backend named by discovery-backend reading the host through fs,
+// ghw when it is empty or unknown
+func NewDiscoveryBackend(fs HostFS, config *api.DevicePluginConfig) DiscoveryBackend {
+	name := ""
+	if config != nil {
+		name = config.DiscoveryBackend
+	}
+	switch name {
+	case "", DiscoveryBackendGhw:
+		return &GhwBackend{HostFS: fs}
+	case DiscoveryBackendSysfs:
+		return &SysfsBackend{HostFS: fs}
+	case DiscoveryBackendLsblk:
+		return &LsblkBackend{HostFS: fs}
+	case DiscoveryBackendStatic:
+		return &StaticBackend{HostFS: fs, Devices: config.StaticDevices}
+	}
+	klog.Warningf("Unknown discovery-backend '%s', using %s", name, DiscoveryBackendGhw)
+	return &GhwBackend{HostFS: fs}
+}
+
+// DevicePaths returns the paths of the discovered devices
+func DevicePaths(devices []BlockDevice) []string {
+	paths := make([]string, 0, len(devices))
+	for _, dev := range devices {
+		paths = append(paths, dev.Path)
+	}
+	return paths
+}
+
+// discoverDevices lists the devices with the backend of scanner, or its GetBlockDevices when it has
+// none, whose records then only hold the name and path
+func discoverDevices(scanner DeviceScanner, config *api.DevicePluginConfig) ([]BlockDevice, error) {
+	bs, ok := scanner.(BackendScanner)
+	if !ok {
+		paths, err := scanner.GetBlockDevices()
+		if err != nil {
+			return nil, err
+		}
+		devices := make([]BlockDevice, 0, len(paths))
+		for _, path := range paths {
+			devices = append(devices, BlockDevice{Name: strings.TrimPrefix(path, "/dev/"), Path: path})
+		}
+		return devices, nil
+	}
+	backend := bs.DiscoveryBackend(config)
+	devices, err := backend.Discover()
+	if err != nil {
+		klog.Errorf("Discovery with the %s backend failed: %v", backend.Name(), err)
+		return nil, err
+	}
+	klog.V(4).Infof("Discovered %d devices with the %s backend", len(devices), backend.Name())
+	return devices, nil
+}
+
+// blockDeviceRecords indexes the discovered records by device name
+func blockDeviceRecords(devices []BlockDevice) map[string]BlockDevice {
+	records := make(map[string]BlockDevice, len(devices))
+	for _, dev := range devices {
+		records[dev.Name] = dev
+	}
+	return records
+}
+
+// withBlockDeviceRecords fills in what sysfs and the udev database did not know about the devices
+// from their discovery records, a device they do not know at all is described by its record
+func withBlockDeviceRecords(attrs map[string]*DeviceAttributes, devices []string, records map[string]BlockDevice) map[string]*DeviceAttributes {
+	if attrs == nil || len(records) == 0 {
+		return attrs
+	}
+	for _, dev := range devices {
+		name := strings.TrimPrefix(dev, "/dev/")
+		record, ok := records[name]
+		if !ok {
+			continue
+		}
+		a, ok := attrs[name]
+		if !ok {
+			a = &DeviceAttributes{Name: name, Type: record.Type}
+			if a.Type == "" {
+				a.Type = DeviceTypeDisk
+			}
+			attrs[name] = a
+		}
+		if a.SizeBytes == 0 {
+			a.SizeBytes = record.SizeBytes
+		}
+		a.Vendor = firstNonEmpty(a.Vendor, record.Vendor)
+		a.Model = firstNonEmpty(a.Model, record.Model)
+		a.Serial = firstNonEmpty(a.Serial, record.Serial)
+		a.WWN = firstNonEmpty(a.WWN, record.WWN)
+	}
+	return attrs
+}
+
+// GhwBackend discovers the disks and partitions ghw finds in /sys/block, with the device numbers
+// and relations read from sysfs and what ghw knows about the identity of the disks
+type GhwBackend struct {
+	HostFS
+}
+
+func (b *GhwBackend) Name() string {
+	return DiscoveryBackendGhw
+}
+
+func (b *GhwBackend) Discover() ([]BlockDevice, error) {
+	block, err := ghw.Block(ghw.WithChroot(b.Root))
+	if err != nil {
+		return nil, err
+	}
+	sysBlock := b.Path("/sys/block")
+	devices := []BlockDevice{}
+	for _, disk := range block.Disks {
+		klog.V(4).Infof("Discovered disk %s with %d partitions", disk.Name, len(disk.Partitions))
+		partitions := []string{}
+		for _, part := range disk.Partitions {
+			partitions = append(partitions, part.Name)
+			devices = append(devices, BlockDevice{
+				Name:      part.Name,
+				Path:      "/dev/" + part.Name,
+				MajMin:    readSysfsString(filepath.Join(sysBlock, disk.Name, part.Name, "dev")),
+				SizeBytes: part.SizeBytes,
+				Type:      DeviceTypePartition,
+				Parents:   []string{disk.Name},
+				Children:  readSysfsDir(filepath.Join(sysBlock, disk.Name, part.Name, "holders")),
+			})
+		}
+		devices = append(devices, BlockDevice{
+			Name:      disk.Name,
+			Path:      "/dev/" + disk.Name,
+			MajMin:    readSysfsString(filepath.Join(sysBlock, disk.Name, "dev")),
+			SizeBytes: disk.SizeBytes,
+			Type:      DeviceTypeDisk,
+			Parents:   readSysfsDir(filepath.Join(sysBlock, disk.Name, "slaves")),
+			Children:  append(partitions, readSysfsDir(filepath.Join(sysBlock, disk.Name, "holders"))...),
+			Vendor:    ghwValue(disk.Vendor),
+			Model:     ghwValue(disk.Model),
+			Serial:    ghwValue(disk.SerialNumber),
+			WWN:       ghwValue(disk.WWN),
+		})
+	}
+	return devices, nil
+}
+
+// SysfsBackend walks /sys/block directly. It finds the devices ghw finds and likewise skips unused
+// loop devices, but reads only the few files of each device the record needs.
+type SysfsBackend struct {
+	HostFS
+}
+
+func (b *SysfsBackend) Name() string {
+	return DiscoveryBackendSysfs
+}
+
+func (b *SysfsBackend) Discover() ([]BlockDevice, error) {
+	sysBlock := b.Path("/sys/block")
+	entries, err := os.ReadDir(sysBlock)
+	if err != nil {
+		return nil, err
+	}
+	devices := []BlockDevice{}
+	for _, entry := range entries {
+		name := entry.Name()
+		dir := filepath.Join(sysBlock, name)
+		size := readSectors(filepath.Join(dir, "size"))
+		if strings.HasPrefix(name, "loop") && size == 0 {
+			continue
+		}
+
+		// partitions are the subdirectories named after their disk, like ghw finds them
+		partitions := []string{}
+		for _, sub := range readSysfsDir(dir) {
+			if !strings.HasPrefix(sub, name) {
+				continue
+			}
+			partDir := filepath.Join(dir, sub)
+			partitions = append(partitions, sub)
+			devices = append(devices, BlockDevice{
+				Name:      sub,
+				Path:      "/dev/" + sub,
+				MajMin:    readSysfsString(filepath.Join(partDir, "dev")),
+				SizeBytes: readSectors(filepath.Join(partDir, "size")),
+				Type:      DeviceTypePartition,
+				Parents:   []string{name},
+				Children:  readSysfsDir(filepath.Join(partDir, "holders")),
+			})
+		}
+		devices = append(devices, BlockDevice{
+			Name:      name,
+			Path:      "/dev/" + name,
+			MajMin:    readSysfsString(filepath.Join(dir, "dev")),
+			SizeBytes: size,
+			Type:      DeviceTypeDisk,
+			Parents:   readSysfsDir(filepath.Join(dir, "slaves")),
+			Children:  append(partitions, readSysfsDir(filepath.Join(dir, "holders"))...),
+		})
+	}
+	return devices, nil
+}
+
+// readSectors reads a sysfs size file, in 512 byte sectors whatever the block size, as bytes
+func readSectors(path string) uint64 {
+	sectors, err := strconv.ParseUint(readSysfsString(path), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return sectors * 512
+}
+
+// LsblkBackend runs lsblk --json on the host root, like cdi/generate-cdi.sh. CD-ROMs and the logical
+// volumes and encrypted devices built on the disks are left out, like the other backends do.
+type LsblkBackend struct {
+	HostFS
+	// Run runs lsblk with args and returns its output, exec'ing lsblk when nil
+	Run func(args ...string) ([]byte, error)
+}
+
+// lsblkOutput is the output of lsblk --json --list
+type lsblkOutput struct {
+	BlockDevices []struct {
+		KName  string          `json:"kname"`
+		MajMin string          `json:"maj:min"`
+		Size   json.RawMessage `json:"size"`
+		Type   string          `json:"type"`
+		PKName *string         `json:"pkname"`
+		Vendor *string         `json:"vendor"`
+		Model  *string         `json:"model"`
+		Serial *string         `json:"serial"`
+		WWN    *string         `json:"wwn"`
+	} `json:"blockdevices"`
+}
+
+// lsblkSkippedTypes are the lsblk types that are not discovered
+var lsblkSkippedTypes = []string{"rom", "lvm", "crypt"}
+
+// lsblkValue trims the padding lsblk keeps, e.g. of SCSI vendors, a null value is empty
+func lsblkValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return strings.TrimSpace(*value)
+}
+
+func (b *LsblkBackend) Name() string {
+	return DiscoveryBackendLsblk
+}
+
+func (b *LsblkBackend) Discover() ([]BlockDevice, error) {
+	args := []string{"--json", "--list", "--bytes", "--output", "KNAME,MAJ:MIN,SIZE,TYPE,PKNAME,VENDOR,MODEL,SERIAL,WWN"}
+	if b.Root != "/" {
+		args = append(args, "--sysroot", b.Root)
+	}
+	run := b.Run
+	if run == nil {
+		run = runLsblk
+	}
+	out, err := run(args...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseLsblk(out)
+}
+
+func runLsblk(args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("lsblk", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("lsblk: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// ParseLsblk parses the output of lsblk --json --list --bytes --output KNAME,MAJ:MIN,SIZE,TYPE,PKNAME,
+// VENDOR,MODEL,SERIAL,WWN. lsblk lists a device once per parent, e.g. a multipath map once per path;
+// those rows are merged. The rows of lsblkSkippedTypes are dropped.
+func ParseLsblk(out []byte) ([]BlockDevice, error) {
+	var parsed lsblkOutput
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		return nil, fmt.Errorf("unable to parse lsblk output: %w", err)
+	}
+	devices := []BlockDevice{}
+	index := map[string]int{}
+	for _, row := range parsed.BlockDevices {
+		if slices.Contains(lsblkSkippedTypes, row.Type) {
+			continue
+		}
+		i, seen := index[row.KName]
+		if !seen {
+			// older lsblk prints the size as a string, even with --bytes
+			size, _ := strconv.ParseUint(strings.Trim(string(row.Size), `"`), 10, 64)
+			devType := DeviceTypeDisk
+			if row.Type == "part" {
+				devType = DeviceTypePartition
+			}
+			i = len(devices)
+			index[row.KName] = i
+			devices = append(devices, BlockDevice{
+				Name:      row.KName,
+				Path:      "/dev/" + row.KName,
+				MajMin:    row.MajMin,
+				SizeBytes: size,
+				Type:      devType,
+				Parents:   []string{},
+				Children:  []string{},
+				Vendor:    lsblkValue(row.Vendor),
+				Model:     lsblkValue(row.Model),
+				Serial:    lsblkValue(row.Serial),
+				WWN:       lsblkValue(row.WWN),
+			})
+		}
+		if row.PKName != nil && *row.PKName != "" && !slices.Contains(devices[i].Parents, *row.PKName) {
+			devices[i].Parents = append(devices[i].Parents, *row.PKName)
+		}
+	}
+	for _, dev := range devices {
+		for _, parent := range dev.Parents {
+			if p, ok := index[parent]; ok {
+				devices[p].Children = append(devices[p].Children, dev.Name)
+			}
+		}
+	}
+	return devices, nil
+}
+
+// StaticBackend advertises the devices listed in static-devices without discovering anything.
+// What sysfs knows about a listed device is filled in, a device sysfs does not know is kept as is.
+type StaticBackend struct {
+	HostFS
+	Devices []string
+}
+
+func (b *StaticBackend) Name() string {
+	return DiscoveryBackendStatic
+}
+
+func (b *StaticBackend) Discover() ([]BlockDevice, error) {
+	devices := []BlockDevice{}
+	for _, path := range b.Devices {
+		name := strings.TrimPrefix(path, "/dev/")
+		dev := BlockDevice{Name: name, Path: "/dev/" + name, Type: DeviceTypeDisk, Parents: []string{}, Children: []string{}}
+		dir := b.Path(filepath.Join("/sys/class/block", name))
+		if _, err := os.Stat(dir); err == nil {
+			dev.MajMin = readSysfsString(filepath.Join(dir, "dev"))
+			dev.SizeBytes = readSectors(filepath.Join(dir, "size"))
+			if _, err := os.Stat(filepath.Join(dir, "partition")); err == nil {
+				dev.Type = DeviceTypePartition
+				if disk := partitionDisk(dir); disk != "" {
+					dev.Parents = []string{disk}
+				}
+			} else {
+				dev.Parents = readSysfsDir(filepath.Join(dir, "slaves"))
+			}
+			dev.Children = readSysfsDir(filepath.Join(dir, "holders"))
+		} else {
+			klog.V(4).Infof("Static device %s is not in sysfs", path)
+		}
+		devices = append(devices, dev)
+	}
+	return devices, nil
+}
+
+// partitionDisk returns the disk of the partition at /sys/class/block/<name>, whose link points into
+// the directory of its disk
+func partitionDisk(dir string) string {
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(filepath.Dir(resolved))
+}
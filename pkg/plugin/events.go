@@ -0,0 +1,325 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog"
+)
+
+const (
+	// ReadyCondition is the custom node condition maintained by the plugin
+	ReadyCondition corev1.NodeConditionType = "PowerDevicePluginReady"
+
+	ReasonDeviceAdded          = "DeviceAdded"
+	ReasonDeviceRemoved        = "DeviceRemoved"
+	ReasonDeviceUnhealthy      = "DeviceUnhealthy"
+	ReasonAllocationRejected   = "AllocationRejected"
+	ReasonConfigLoadFailed     = "ConfigLoadFailed"
+	ReasonPluginRegistered     = "PluginRegistered"
+	ReasonPluginStopped        = "PluginStopped"
+	ReasonScanTimedOut         = "ScanTimedOut"
+	ReasonProbeTimedOut        = "ProbeTimedOut"
+	ReasonDiscoveryHookFailed  = "DiscoveryHookFailed"
+	ReasonMultipathDegraded    = "MultipathDegraded"
+	ReasonSystemDevicesUnknown = "SystemDevicesUnknown"
+
+	eventSource    = "power-device-plugin"
+	eventNamespace = "default"
+	nodeNameEnv    = "NODE_NAME"
+	// eventQueueSize bounds the events waiting to be written, more are dropped
+	eventQueueSize = 100
+)
+
+// NodeReporter records Kubernetes Events against the plugin's Node and maintains the ReadyCondition.
+// Events are queued and written by a goroutine of their own, so Allocate never waits on the API server.
+// A nil *NodeReporter is valid and drops everything, so callers don't need to check for a cluster connection.
+type NodeReporter struct {
+	client   kubernetes.Interface
+	nodeName string
+
+	// DedupInterval suppresses identical events (same reason and message) inside the window
+	DedupInterval time.Duration
+	limiter       flowcontrol.RateLimiter
+
+	mutex     sync.Mutex
+	lastFor   map[string]time.Time
+	lastPrune time.Time
+	known     map[string]bool
+
+	queue   chan *corev1.Event
+	pending sync.WaitGroup
+	// uid is the node UID, looked up by the event writer once
+	uid types.UID
+}
+
+// NewNodeReporter creates a reporter for nodeName, emitting at most qps events per second with the given burst
+func NewNodeReporter(client kubernetes.Interface, nodeName string, qps float32, burst int) *NodeReporter {
+	r := &NodeReporter{
+		client:        client,
+		nodeName:      nodeName,
+		DedupInterval: 5 * time.Minute,
+		limiter:       flowcontrol.NewTokenBucketRateLimiter(qps, burst),
+		lastFor:       map[string]time.Time{},
+		queue:         make(chan *corev1.Event, eventQueueSize),
+	}
+	go r.writeEvents()
+	return r
+}
+
+// NewInClusterNodeReporter builds a reporter from the pod's ServiceAccount and the NODE_NAME env (downward API).
+// Returns nil when the plugin is not running in a cluster.
+func NewInClusterNodeReporter() *NodeReporter {
+	nodeName := os.Getenv(nodeNameEnv)
+	if nodeName == "" {
+		klog.Warningf("%s is not set, Kubernetes events and node conditions are disabled", nodeNameEnv)
+		return nil
+	}
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		klog.Warningf("Unable to load in-cluster config, Kubernetes events and node conditions are disabled: %v", err)
+		return nil
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		klog.Warningf("Unable to create Kubernetes client: %v", err)
+		return nil
+	}
+	return NewNodeReporter(client, nodeName, 1, 10)
+}
+
+// Event queues an event of eventType (Normal/Warning) against the node, subject to dedup and rate limiting
+func (r *NodeReporter) Event(eventType, reason, messageFmt string, args ...interface{}) {
+	if r == nil {
+		return
+	}
+	message := fmt.Sprintf(messageFmt, args...)
+	key := reason + "/" + message
+	now := time.Now()
+
+	r.mutex.Lock()
+	r.pruneDedup(now)
+	if last, ok := r.lastFor[key]; ok && now.Sub(last) < r.DedupInterval {
+		r.mutex.Unlock()
+		klog.V(4).Infof("Suppressing duplicate event %s: %s", reason, message)
+		return
+	}
+	if !r.limiter.TryAccept() {
+		r.mutex.Unlock()
+		klog.V(2).Infof("Event rate limit reached, dropping event %s: %s", reason, message)
+		return
+	}
+	r.lastFor[key] = now
+	r.mutex.Unlock()
+
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			// same naming scheme as the client-go event recorder
+			Name:      fmt.Sprintf("%v.%x", r.nodeName, now.UnixNano()),
+			Namespace: eventNamespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:       "Node",
+			APIVersion: "v1",
+			Name:       r.nodeName,
+		},
+		Reason:              reason,
+		Message:             message,
+		Type:                eventType,
+		Count:               1,
+		FirstTimestamp:      metav1.NewTime(now),
+		LastTimestamp:       metav1.NewTime(now),
+		Source:              corev1.EventSource{Component: eventSource, Host: r.nodeName},
+		ReportingController: eventSource,
+		ReportingInstance:   eventSource + "-" + r.nodeName,
+	}
+	r.pending.Add(1)
+	select {
+	case r.queue <- event:
+	default:
+		r.pending.Done()
+		klog.Warningf("Event queue is full, dropping event %s: %s", reason, message)
+	}
+}
+
+// pruneDedup forgets the events older than DedupInterval, at most once per interval. The mutex is held.
+func (r *NodeReporter) pruneDedup(now time.Time) {
+	if now.Sub(r.lastPrune) < r.DedupInterval {
+		return
+	}
+	for key, last := range r.lastFor {
+		if now.Sub(last) >= r.DedupInterval {
+			delete(r.lastFor, key)
+		}
+	}
+	r.lastPrune = now
+}
+
+// writeEvents writes the queued events, it runs for the lifetime of the reporter
+func (r *NodeReporter) writeEvents() {
+	for event := range r.queue {
+		event.InvolvedObject.UID = r.nodeUID()
+		if _, err := r.client.CoreV1().Events(eventNamespace).Create(context.Background(), event, metav1.CreateOptions{}); err != nil {
+			klog.Warningf("Unable to record event %s: %v", event.Reason, err)
+		}
+		r.pending.Done()
+	}
+}
+
+// Flush waits until the queued events are written
+func (r *NodeReporter) Flush() {
+	if r == nil {
+		return
+	}
+	r.pending.Wait()
+}
+
+// nodeUID looks up the node UID once so the event shows up in `oc describe node`, an empty UID is
+// acceptable and looked up again with the next event. Only the event writer calls it.
+func (r *NodeReporter) nodeUID() types.UID {
+	if r.uid != "" {
+		return r.uid
+	}
+	node, err := r.client.CoreV1().Nodes().Get(context.Background(), r.nodeName, metav1.GetOptions{})
+	if err != nil {
+		return ""
+	}
+	r.uid = node.UID
+	return r.uid
+}
+
+// ObserveDevices compares devices to the previous observation and records DeviceAdded/DeviceRemoved events.
+// The first observation only seeds the known set.
+func (r *NodeReporter) ObserveDevices(devices []string) {
+	if r == nil {
+		return
+	}
+	current := map[string]bool{}
+	for _, dev := range devices {
+		current[dev] = true
+	}
+
+	r.mutex.Lock()
+	previous := r.known
+	r.known = current
+	r.mutex.Unlock()
+
+	if previous == nil {
+		return
+	}
+	added, removed := []string{}, []string{}
+	for dev := range current {
+		if !previous[dev] {
+			added = append(added, dev)
+		}
+	}
+	for dev := range previous {
+		if !current[dev] {
+			removed = append(removed, dev)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	if len(added) > 0 {
+		r.Event(corev1.EventTypeNormal, ReasonDeviceAdded, "Devices added: %v", added)
+	}
+	if len(removed) > 0 {
+		r.Event(corev1.EventTypeWarning, ReasonDeviceRemoved, "Devices removed: %v", removed)
+	}
+}
+
+// SetReady updates the PowerDevicePluginReady node condition, only writing when status or reason changes.
+// The kubelet and the node controllers update the node status too, a conflicting write is retried on
+// the node read again.
+func (r *NodeReporter) SetReady(ready bool, reason, message string) {
+	if r == nil {
+		return
+	}
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+
+	written := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var err error
+		written, err = r.writeReady(status, reason, message)
+		return err
+	})
+	if err != nil {
+		klog.Warningf("Unable to update %s on node %s: %v", ReadyCondition, r.nodeName, err)
+		return
+	}
+	if written {
+		klog.Infof("Node condition %s set to %s (%s)", ReadyCondition, status, reason)
+	}
+}
+
+// writeReady writes the PowerDevicePluginReady condition to the node as it is now and reports whether
+// it wrote, the condition is left alone when status and reason are unchanged
+func (r *NodeReporter) writeReady(status corev1.ConditionStatus, reason, message string) (bool, error) {
+	ctx := context.Background()
+	node, err := r.client.CoreV1().Nodes().Get(ctx, r.nodeName, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	now := metav1.Now()
+	condition := corev1.NodeCondition{
+		Type:               ReadyCondition,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		LastHeartbeatTime:  now,
+		LastTransitionTime: now,
+	}
+	found := false
+	for i, c := range node.Status.Conditions {
+		if c.Type != ReadyCondition {
+			continue
+		}
+		found = true
+		if c.Status == status && c.Reason == reason {
+			return false, nil
+		}
+		if c.Status == status {
+			condition.LastTransitionTime = c.LastTransitionTime
+		}
+		node.Status.Conditions[i] = condition
+	}
+	if !found {
+		node.Status.Conditions = append(node.Status.Conditions, condition)
+	}
+
+	if _, err := r.client.CoreV1().Nodes().UpdateStatus(ctx, node, metav1.UpdateOptions{}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
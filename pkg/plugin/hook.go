@@ -0,0 +1,199 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ocp-power-demos/power-dev-plugin/api"
+	"k8s.io/klog"
+)
+
+const (
+	defaultHookTimeout = 10 * time.Second
+	// hookHostRootEnv tells the hook where the host filesystem is mounted
+	hookHostRootEnv = "POWER_DEV_HOST_ROOT"
+	// hookStderrLimit bounds the hook output kept for the logs
+	hookStderrLimit = 4096
+)
+
+// HookDevice is a device as the discovery hook reads it on stdin and prints it on stdout
+type HookDevice struct {
+	Path        string            `json:"path"`
+	Aliases     []string          `json:"aliases,omitempty"`
+	Attributes  *HookAttributes   `json:"attributes,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// HookAttributes are the device attributes passed to the hook, empty values are left out
+type HookAttributes struct {
+	Type      string `json:"type,omitempty"`
+	SizeBytes uint64 `json:"size-bytes,omitempty"`
+	Vendor    string `json:"vendor,omitempty"`
+	Model     string `json:"model,omitempty"`
+	Serial    string `json:"serial,omitempty"`
+	WWN       string `json:"wwn,omitempty"`
+	DMName    string `json:"dm-name,omitempty"`
+	DMUUID    string `json:"dm-uuid,omitempty"`
+	Transport string `json:"transport,omitempty"`
+}
+
+// HookDevices is the document the hook reads on stdin and prints on stdout
+type HookDevices struct {
+	Devices []HookDevice `json:"devices"`
+}
+
+// hookTimeout is how long the hook may run, its timeout or 10s
+func hookTimeout(hook *api.DiscoveryHook) time.Duration {
+	return parseTimeout("discovery-hook timeout", hook.Timeout, defaultHookTimeout)
+}
+
+// RunDiscoveryHook runs the hook command with the candidates on stdin and returns the devices it
+// printed. A non-zero exit, a timeout or output that is not a device document is an error.
+func RunDiscoveryHook(ctx context.Context, hook *api.DiscoveryHook, candidates []HookDevice) ([]HookDevice, error) {
+	if hook == nil || len(hook.Command) == 0 {
+		return nil, errors.New("discovery hook has no command")
+	}
+	input, err := json.Marshal(HookDevices{Devices: candidates})
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := hookTimeout(hook)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, hook.Command[0], hook.Command[1:]...)
+	cmd.Env = append(os.Environ(), hookHostRootEnv+"="+HostRoot())
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// a child the hook started may keep the pipes open after the hook is killed
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Run()
+	if msg := hookStderr(&stderr); msg != "" {
+		klog.V(4).Infof("Discovery hook stderr: %s", msg)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("discovery hook did not finish within %v", timeout)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("discovery hook exited with status %d: %s", exitErr.ExitCode(), hookStderr(&stderr))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to run discovery hook: %w", err)
+	}
+
+	var output HookDevices
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return nil, fmt.Errorf("discovery hook printed invalid output: %w", err)
+	}
+	return output.Devices, nil
+}
+
+// hookStderr is the trimmed start of the hook's stderr
+func hookStderr(stderr *bytes.Buffer) string {
+	msg := strings.TrimSpace(stderr.String())
+	if len(msg) > hookStderrLimit {
+		msg = msg[:hookStderrLimit] + "..."
+	}
+	return msg
+}
+
+// hookCandidates describes the devices for the hook
+func hookCandidates(devices []string, aliases DeviceAliases, attrs map[string]*DeviceAttributes) []HookDevice {
+	candidates := make([]HookDevice, 0, len(devices))
+	for _, dev := range devices {
+		name := strings.TrimPrefix(dev, "/dev/")
+		candidate := HookDevice{Path: "/dev/" + name, Aliases: aliases[name]}
+		if a := attrs[name]; a != nil {
+			candidate.Attributes = &HookAttributes{
+				Type:      a.Type,
+				SizeBytes: a.SizeBytes,
+				Vendor:    a.Vendor,
+				Model:     a.Model,
+				Serial:    a.Serial,
+				WWN:       a.WWN,
+				DMName:    a.DMName,
+				DMUUID:    a.DMUUID,
+				Transport: a.Transport,
+			}
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates
+}
+
+// ApplyDiscoveryHook keeps the devices the hook accepts and returns their annotations by device name.
+// The hook can only narrow the devices down: a path that is not one of them is ignored. When the
+// hook fails, the devices are kept as they are and the error is returned for reporting.
+func ApplyDiscoveryHook(ctx context.Context, hook *api.DiscoveryHook, devices []string, aliases DeviceAliases, attrs map[string]*DeviceAttributes) ([]string, map[string]map[string]string, error) {
+	output, err := RunDiscoveryHook(ctx, hook, hookCandidates(devices, aliases, attrs))
+	if err != nil {
+		klog.Warningf("Discovery hook failed, keeping the %d devices the rules allowed: %v", len(devices), err)
+		return devices, nil, err
+	}
+
+	accepted := map[string]HookDevice{}
+	for _, out := range output {
+		name := strings.TrimPrefix(out.Path, "/dev/")
+		if !strings.HasPrefix(out.Path, "/dev/") || !containsDevice(devices, name) {
+			klog.Warningf("Discovery hook returned %s, which is not a candidate device; ignored", out.Path)
+			continue
+		}
+		accepted[name] = out
+	}
+
+	// keep the discovery order
+	filtered := []string{}
+	annotations := map[string]map[string]string{}
+	for _, dev := range devices {
+		name := strings.TrimPrefix(dev, "/dev/")
+		out, ok := accepted[name]
+		if !ok {
+			klog.V(4).Infof("Excluding device %s by the discovery hook", dev)
+			continue
+		}
+		filtered = append(filtered, dev)
+		if len(out.Annotations) > 0 {
+			annotations[name] = out.Annotations
+		}
+	}
+	klog.Infof("Discovery hook accepted %d of %d devices", len(filtered), len(devices))
+	return filtered, annotations, nil
+}
+
+// containsDevice reports whether devices holds name, as a bare name or a /dev path
+func containsDevice(devices []string, name string) bool {
+	for _, dev := range devices {
+		if strings.TrimPrefix(dev, "/dev/") == name {
+			return true
+		}
+	}
+	return false
+}
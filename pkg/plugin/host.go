@@ -0,0 +1,206 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ocp-power-demos/power-dev-plugin/api"
+	"k8s.io/klog"
+)
+
+// hostRoot is the root set by SetHostRoot
+var hostRoot struct {
+	sync.RWMutex
+	root string
+}
+
+// SetHostRoot sets where the host filesystem is mounted in this container, e.g. /host from the
+// --host-root flag. An empty root falls back to GHW_CHROOT.
+func SetHostRoot(root string) {
+	hostRoot.Lock()
+	defer hostRoot.Unlock()
+	hostRoot.root = root
+}
+
+// HostRoot is where the host filesystem is mounted: the root set by SetHostRoot, else GHW_CHROOT, else /
+func HostRoot() string {
+	hostRoot.RLock()
+	defer hostRoot.RUnlock()
+	if hostRoot.root != "" {
+		return filepath.Join("/", hostRoot.root)
+	}
+	return filepath.Join("/", os.Getenv("GHW_CHROOT"))
+}
+
+// HostFS is the filesystem of the host mounted at Root. The config, the kubelet and the containers
+// use host paths such as /dev/dm-3; Path maps them to where this process reads them, e.g. /host/dev/dm-3.
+// Every read of host state goes through it, so a deployment that only mounts /host/dev and /host/sys
+// sees the host and not the container's own /dev.
+type HostFS struct {
+	Root string
+}
+
+// Path maps a host path such as /dev/dm-3 into Root
+func (f HostFS) Path(hostPath string) string {
+	return filepath.Join(f.Root, hostPath)
+}
+
+// HostPath maps a path under Root back to the path on the host
+func (f HostFS) HostPath(path string) string {
+	rel, err := filepath.Rel(f.Root, path)
+	if err != nil {
+		return path
+	}
+	return filepath.Join("/", rel)
+}
+
+// Glob matches a host pattern such as /dev/dm-* and returns host paths
+func (f HostFS) Glob(pattern string) ([]string, error) {
+	matches, err := filepath.Glob(f.Path(pattern))
+	if err != nil {
+		return nil, err
+	}
+	for i, match := range matches {
+		matches[i] = f.HostPath(match)
+	}
+	return matches, nil
+}
+
+// Stat stats a host path
+func (f HostFS) Stat(hostPath string) (os.FileInfo, error) {
+	return os.Stat(f.Path(hostPath))
+}
+
+// HostScanner discovers devices in the filesystem tree of a host mounted at Root: ghw, sysfs,
+// the udev database and /dev are all read below it. The DaemonSet points it at the host root,
+// tests at a fake tree built in a temporary directory.
+type HostScanner struct {
+	HostFS
+	// ProcRoot is /proc/<pid> of a process in the host mount namespace, for mountinfo and swaps
+	ProcRoot string
+}
+
+// NewHostScanner creates a scanner reading the host mounted at root. Mounts are read from
+// root/proc/1 when the tree has them, otherwise from the host PID 1 or this process.
+func NewHostScanner(root string) *HostScanner {
+	root = filepath.Join("/", root)
+	procRoot := "/proc/self"
+	for _, candidate := range []string{filepath.Join(root, "proc", "1"), hostProcRoot} {
+		if _, err := os.Stat(filepath.Join(candidate, "mountinfo")); err == nil {
+			procRoot = candidate
+			break
+		}
+	}
+	return &HostScanner{HostFS: HostFS{Root: root}, ProcRoot: procRoot}
+}
+
+// NewDeviceScanner returns the scanner reading the host through ghw, sysfs and /dev under HostRoot
+func NewDeviceScanner() DeviceScanner {
+	return NewHostScanner(HostRoot())
+}
+
+// GetBlockDevices lists the devices the backend discovery-backend of the config file selects finds.
+// Scans discover through DiscoveryBackend with the config they loaded instead.
+func (h *HostScanner) GetBlockDevices() ([]string, error) {
+	config, err := h.LoadConfig()
+	if err != nil {
+		klog.Warningf("Discovering with the default backend, the config did not load: %v", err)
+	}
+	devices, err := h.DiscoveryBackend(config).Discover()
+	if err != nil {
+		klog.Errorf("Error getting block storage info: %v", err)
+		return nil, err
+	}
+	return DevicePaths(devices), nil
+}
+
+// DiscoveryBackend returns the backend discovery-backend selects, reading the host root
+func (h *HostScanner) DiscoveryBackend(config *api.DevicePluginConfig) DiscoveryBackend {
+	return NewDiscoveryBackend(h.HostFS, config)
+}
+
+func (h *HostScanner) LoadConfig() (*api.DevicePluginConfig, error) {
+	return LoadDevicePluginConfig()
+}
+
+// FindDevices globs a host pattern such as /dev/dm-* and returns the host paths
+func (h *HostScanner) FindDevices(pattern string) ([]string, error) {
+	return h.Glob(pattern)
+}
+
+func (h *HostScanner) StatDevice(path string) error {
+	_, err := h.Stat(path)
+	return err
+}
+
+func (h *HostScanner) MultipathMaps() (map[string]*MultipathMap, error) {
+	return ReadMultipathMaps(h.Path("/sys"))
+}
+
+func (h *HostScanner) ProtectedDevices() (map[string]string, error) {
+	guard := &SystemDeviceGuard{SysRoot: h.Path("/sys"), ProcRoot: h.ProcRoot}
+	return guard.ProtectedDevices()
+}
+
+func (h *HostScanner) DeviceAliases() (DeviceAliases, error) {
+	return ReadDeviceAliases(h.Path("/dev"))
+}
+
+// CharDevices lists the character devices in the /sys/class directories of the host
+func (h *HostScanner) CharDevices() ([]CharDevice, error) {
+	return ReadCharDevices(h.Path("/sys"))
+}
+
+// VFIOGroups lists the IOMMU groups of the devices bound to vfio-pci on the host
+func (h *HostScanner) VFIOGroups() ([]VFIOGroup, error) {
+	return ReadVFIOGroups(h.Path("/sys"))
+}
+
+// DeviceAttributes reads the attributes of devices from sysfs and the udev database. What the
+// discovery backend knows besides, e.g. the vendor ghw read, is filled in by the scan from its records.
+func (h *HostScanner) DeviceAttributes(devices []string) (map[string]*DeviceAttributes, error) {
+	reader := &AttributeReader{SysRoot: h.Path("/sys"), UdevRoot: h.Path("/run/udev/data")}
+	attrs := reader.Read(devices)
+	h.charAttributes(devices, attrs)
+	return attrs, nil
+}
+
+// charAttributes adds the attributes of the devices that are not block devices, when any are
+func (h *HostScanner) charAttributes(devices []string, attrs map[string]*DeviceAttributes) {
+	if len(attrs) == len(devices) {
+		return
+	}
+	chars, err := h.CharDevices()
+	if err != nil {
+		klog.V(4).Infof("Unable to list character devices for device attributes: %v", err)
+		return
+	}
+	wanted := map[string]bool{}
+	for _, dev := range devices {
+		wanted[strings.TrimPrefix(dev, "/dev/")] = true
+	}
+	for _, dev := range chars {
+		name := strings.TrimPrefix(dev.Path, "/dev/")
+		if _, ok := attrs[name]; !ok && wanted[name] {
+			attrs[name] = charAttributes(dev)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"maps"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ocp-power-demos/power-dev-plugin/api/v1alpha1"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/client/clientset/versioned"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+const (
+	inventoryResyncInterval = 5 * time.Minute
+
+	// PoolReserved is the pool of the devices reserved-devices keeps for the node, they are not advertised
+	PoolReserved = "reserved"
+)
+
+// InventoryReporter publishes the node's PowerDeviceInventory.
+// Observations only record state and wake up Run, so the gRPC paths never wait on the API server.
+// A nil *InventoryReporter is valid and drops everything.
+type InventoryReporter struct {
+	client   versioned.Interface
+	nodeName string
+
+	// Interval is the periodic resync, which also recreates a deleted inventory
+	Interval time.Duration
+
+	mutex     sync.Mutex
+	devices   []string
+	scanTime  time.Time
+	usage     map[string]int
+	unhealthy map[string]bool
+	// degraded are the multipath maps with some paths down, by device name
+	degraded map[string]bool
+	// reserved are the devices reserved-devices keeps for the node, by device name
+	reserved map[string]bool
+	// annotations are set by the discovery hook, by device name
+	annotations map[string]map[string]string
+	// classes are the device classes of the character devices, by device name
+	classes map[string]string
+	written *v1alpha1.PowerDeviceInventoryStatus
+
+	scanTimeouts  int
+	probeTimeouts int
+
+	changed chan struct{}
+}
+
+// NewInventoryReporter creates a reporter for nodeName
+func NewInventoryReporter(client versioned.Interface, nodeName string) *InventoryReporter {
+	return &InventoryReporter{
+		client:    client,
+		nodeName:  nodeName,
+		Interval:  inventoryResyncInterval,
+		usage:     map[string]int{},
+		unhealthy: map[string]bool{},
+		degraded:  map[string]bool{},
+		changed:   make(chan struct{}, 1),
+	}
+}
+
+// NewInClusterInventoryReporter builds a reporter from the pod's ServiceAccount and the NODE_NAME env.
+// Returns nil when the plugin is not running in a cluster.
+func NewInClusterInventoryReporter() *InventoryReporter {
+	nodeName := os.Getenv(nodeNameEnv)
+	if nodeName == "" {
+		klog.Warningf("%s is not set, PowerDeviceInventory is disabled", nodeNameEnv)
+		return nil
+	}
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		klog.Warningf("Unable to load in-cluster config, PowerDeviceInventory is disabled: %v", err)
+		return nil
+	}
+	client, err := versioned.NewForConfig(config)
+	if err != nil {
+		klog.Warningf("Unable to create PowerDeviceInventory client: %v", err)
+		return nil
+	}
+	return NewInventoryReporter(client, nodeName)
+}
+
+// ObserveScan records the result of a fresh device scan
+func (r *InventoryReporter) ObserveScan(devices []string, at time.Time) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	r.devices = append([]string{}, devices...)
+	r.scanTime = at
+	r.mutex.Unlock()
+	r.notify()
+}
+
+// ObserveReserved records the devices reserved-devices keeps for the node at the last scan
+func (r *InventoryReporter) ObserveReserved(reserved []string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	r.reserved = map[string]bool{}
+	for _, dev := range reserved {
+		r.reserved[strings.TrimPrefix(dev, "/dev/")] = true
+	}
+	r.mutex.Unlock()
+	r.notify()
+}
+
+// ObserveUsage records the current allocation count per device
+func (r *InventoryReporter) ObserveUsage(usage map[string]int) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	r.usage = map[string]int{}
+	for dev, count := range usage {
+		r.usage[strings.TrimPrefix(dev, "/dev/")] = count
+	}
+	r.mutex.Unlock()
+	r.notify()
+}
+
+// ObserveHealth records the health of a single device
+func (r *InventoryReporter) ObserveHealth(dev string, health string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	r.unhealthy[strings.TrimPrefix(dev, "/dev/")] = health != pluginapi.Healthy
+	r.mutex.Unlock()
+	r.notify()
+}
+
+// ObserveDegraded records whether the multipath map dev has some paths down
+func (r *InventoryReporter) ObserveDegraded(dev string, degraded bool) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	r.degraded[strings.TrimPrefix(dev, "/dev/")] = degraded
+	r.mutex.Unlock()
+	r.notify()
+}
+
+// ObserveScanTimeout counts a scan that did not finish within the scan timeout
+func (r *InventoryReporter) ObserveScanTimeout() {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	r.scanTimeouts++
+	r.mutex.Unlock()
+	r.notify()
+}
+
+// ObserveProbeTimeouts counts the devices a scan left out because their probe timed out
+func (r *InventoryReporter) ObserveProbeTimeouts(count int) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	r.probeTimeouts += count
+	r.mutex.Unlock()
+	r.notify()
+}
+
+// ObserveAnnotations records the annotations the discovery hook set at the last scan
+func (r *InventoryReporter) ObserveAnnotations(annotations map[string]map[string]string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	r.annotations = annotations
+	r.mutex.Unlock()
+	r.notify()
+}
+
+// ObserveClasses records the device classes of the character devices found at the last scan
+func (r *InventoryReporter) ObserveClasses(classes map[string]string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	r.classes = classes
+	r.mutex.Unlock()
+	r.notify()
+}
+
+func (r *InventoryReporter) notify() {
+	select {
+	case r.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Status builds the inventory status from the last observations
+func (r *InventoryReporter) Status() v1alpha1.PowerDeviceInventoryStatus {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	status := v1alpha1.PowerDeviceInventoryStatus{
+		Devices:       []v1alpha1.DeviceStatus{},
+		DeviceCount:   len(r.devices),
+		LastScanTime:  metav1.NewTime(r.scanTime),
+		ScanTimeouts:  r.scanTimeouts,
+		ProbeTimeouts: r.probeTimeouts,
+	}
+	for _, dev := range r.devices {
+		name := strings.TrimPrefix(dev, "/dev/")
+		health := pluginapi.Healthy
+		if r.unhealthy[name] {
+			health = pluginapi.Unhealthy
+		}
+		allocations := r.usage[name]
+		if allocations > 0 {
+			status.AllocatedCount++
+		}
+		pool := resource
+		if r.reserved[name] {
+			pool = PoolReserved
+		}
+		status.Devices = append(status.Devices, v1alpha1.DeviceStatus{
+			Name:        name,
+			Path:        "/dev/" + name,
+			Health:      health,
+			Degraded:    r.degraded[name],
+			Pool:        pool,
+			Allocations: allocations,
+			Class:       r.classes[name],
+			Annotations: maps.Clone(r.annotations[name]),
+		})
+	}
+	sort.Slice(status.Devices, func(i, j int) bool {
+		return status.Devices[i].Name < status.Devices[j].Name
+	})
+	return status
+}
+
+// Sync writes the inventory when it changed since the last write, or always when force is set
+func (r *InventoryReporter) Sync(force bool) error {
+	if r == nil {
+		return nil
+	}
+	status := r.Status()
+
+	r.mutex.Lock()
+	unchanged := r.written != nil && reflect.DeepEqual(*r.written, status)
+	r.mutex.Unlock()
+	if unchanged && !force {
+		return nil
+	}
+
+	ctx := context.Background()
+	inventories := r.client.PowerV1alpha1().PowerDeviceInventories()
+	inventory, err := inventories.Get(ctx, r.nodeName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		klog.Infof("Creating PowerDeviceInventory %s", r.nodeName)
+		inventory, err = inventories.Create(ctx, &v1alpha1.PowerDeviceInventory{
+			ObjectMeta: metav1.ObjectMeta{Name: r.nodeName},
+			Spec:       v1alpha1.PowerDeviceInventorySpec{NodeName: r.nodeName},
+		}, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return err
+	}
+
+	inventory.Status = status
+	inventory.Status.LastUpdateTime = metav1.Now()
+	if _, err := inventories.UpdateStatus(ctx, inventory, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	r.written = &status
+	r.mutex.Unlock()
+	klog.V(4).Infof("Updated PowerDeviceInventory %s with %d devices", r.nodeName, status.DeviceCount)
+	return nil
+}
+
+// Run writes the inventory on every change and on the periodic resync until stop is closed
+func (r *InventoryReporter) Run(stop <-chan interface{}) {
+	if r == nil {
+		return
+	}
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		force := false
+		select {
+		case <-stop:
+			return
+		case <-r.changed:
+		case <-ticker.C:
+			force = true
+		}
+		if err := r.Sync(force); err != nil {
+			klog.Warningf("Unable to update PowerDeviceInventory %s: %v", r.nodeName, err)
+		}
+	}
+}
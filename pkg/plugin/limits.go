@@ -0,0 +1,192 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ocp-power-demos/power-dev-plugin/api"
+	"k8s.io/klog"
+)
+
+// Unlimited is the upper limit of a device without one
+const Unlimited = math.MaxInt
+
+// normalizeUpperLimit maps an unset limit to Unlimited, a negative limit is invalid
+func normalizeUpperLimit(limit int) (int, error) {
+	switch {
+	case limit == 0:
+		return Unlimited, nil
+	case limit < 0:
+		return 0, fmt.Errorf("negative upper-limit %d", limit)
+	}
+	return limit, nil
+}
+
+// upperLimitRule is a validated upper limit rule
+type upperLimitRule struct {
+	deviceMatcher
+	limit int
+}
+
+// UpperLimitPolicy resolves how many allocations each device takes from the upper-limit of its
+// device class and the upper limit rules, falling back to upper-limit
+type UpperLimitPolicy struct {
+	rules        []upperLimitRule
+	defaultLimit int
+}
+
+// NewUpperLimitPolicy validates the upper limit rules of config, invalid rules are logged and skipped.
+// classes is the device class of each device by name, as the scan found them.
+func NewUpperLimitPolicy(config *api.DevicePluginConfig, classes map[string]string) *UpperLimitPolicy {
+	policy := &UpperLimitPolicy{defaultLimit: Unlimited}
+	if config == nil {
+		return policy
+	}
+	if limit, err := normalizeUpperLimit(config.UpperLimitPerDevice); err != nil {
+		klog.Warningf("Invalid upper-limit: %v. Ignoring, devices are not limited...", err)
+	} else {
+		policy.defaultLimit = limit
+	}
+	for _, class := range compileDeviceClasses(config) {
+		if class.UpperLimit == 0 {
+			continue
+		}
+		limit, err := normalizeUpperLimit(class.UpperLimit)
+		if err != nil {
+			klog.Warningf("Invalid upper-limit of device class %s: %v. Skipping...", class.Name, err)
+			continue
+		}
+		policy.rules = append(policy.rules, upperLimitRule{deviceMatcher: class.membersMatcher(classes), limit: limit})
+	}
+	for i, rule := range config.UpperLimitRules {
+		matcher, err := compileDeviceMatcher(rule.Glob, rule.Regex, rule.Selector)
+		if err != nil {
+			klog.Warningf("Invalid upper limit rule %d (%s): %v. Skipping...", i, rule.Comment, err)
+			continue
+		}
+		limit, err := normalizeUpperLimit(rule.UpperLimit)
+		if err != nil {
+			klog.Warningf("Invalid upper limit rule %d (%s): %v. Skipping...", i, rule.Comment, err)
+			continue
+		}
+		policy.rules = append(policy.rules, upperLimitRule{deviceMatcher: matcher, limit: limit})
+	}
+	return policy
+}
+
+// Default is the limit of devices no rule matches, Unlimited when upper-limit is not set
+func (p *UpperLimitPolicy) Default() int {
+	return p.defaultLimit
+}
+
+// HasRules reports whether any device can get another limit than the default
+func (p *UpperLimitPolicy) HasRules() bool {
+	return len(p.rules) > 0
+}
+
+// NeedsAttributes reports whether any rule matches on device attributes
+func (p *UpperLimitPolicy) NeedsAttributes() bool {
+	for _, rule := range p.rules {
+		if rule.selector != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Limit returns the number of allocations a device can hold at once, Unlimited for no limit
+func (p *UpperLimitPolicy) Limit(dev string, aliases DeviceAliases, attrs *DeviceAttributes) int {
+	names := aliases.Names(dev)
+	for _, rule := range p.rules {
+		if rule.matches(names, attrs) {
+			return rule.limit
+		}
+	}
+	return p.defaultLimit
+}
+
+// Limits resolves the limits of the devices, reading aliases and attributes only when the rules need them
+func (p *UpperLimitPolicy) Limits(scanner DeviceScanner, devices []string) map[string]int {
+	limits := map[string]int{}
+	aliases, attrs := deviceDetails(scanner, devices, p.HasRules(), p.NeedsAttributes())
+	for _, dev := range devices {
+		limits[dev] = p.Limit(dev, aliases, attrs[strings.TrimPrefix(dev, "/dev/")])
+	}
+	return limits
+}
+
+// ReservedDevices splits off the devices the node keeps for itself: the last reserved block devices in
+// name order are neither advertised nor allocated. The devices of classes, by device name, are never
+// reserved. The order of the remaining devices is kept.
+func ReservedDevices(devices []string, reserved int, classes map[string]string) ([]string, []string) {
+	if reserved <= 0 {
+		return devices, nil
+	}
+	names := []string{}
+	for _, dev := range devices {
+		if classes[deviceID(dev)] == "" {
+			names = append(names, deviceID(dev))
+		}
+	}
+	if reserved >= len(names) {
+		klog.Warningf("reserved-devices %d holds back all %d block devices", reserved, len(names))
+		reserved = len(names)
+	}
+	sort.Strings(names)
+	held := map[string]bool{}
+	for _, name := range names[len(names)-reserved:] {
+		held[name] = true
+	}
+	available, kept := []string{}, []string{}
+	for _, dev := range devices {
+		if held[deviceID(dev)] {
+			kept = append(kept, dev)
+		} else {
+			available = append(available, dev)
+		}
+	}
+	return available, kept
+}
+
+// reservedCount is the reserved-devices of config
+func reservedCount(config *api.DevicePluginConfig) int {
+	if config == nil {
+		return 0
+	}
+	return config.ReservedDevices
+}
+
+// describeLimit prints a limit for the logs
+func describeLimit(limit int) string {
+	if limit == Unlimited {
+		return "unlimited"
+	}
+	return strconv.Itoa(limit)
+}
+
+// auditLimit is the limit as recorded in the audit log, 0 for no limit
+func auditLimit(limit int) int {
+	if limit == Unlimited {
+		return 0
+	}
+	return limit
+}
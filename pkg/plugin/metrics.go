@@ -0,0 +1,59 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"expvar"
+	"net/http"
+	"time"
+)
+
+const (
+	// MetricsPath is where ServeMetrics serves the metrics
+	MetricsPath = "/debug/vars"
+
+	metricScanTimeouts  = "scan_timeouts"
+	metricProbeTimeouts = "probe_timeouts"
+)
+
+// metrics are the counters of the plugin process, published as the power_dev_plugin expvar
+var metrics = expvar.NewMap("power_dev_plugin")
+
+// ScanTimeouts returns how many scans did not finish within the scan timeout
+func ScanTimeouts() int64 {
+	return metricValue(metricScanTimeouts)
+}
+
+// ProbeTimeouts returns how many devices were left out of a scan because their probe timed out
+func ProbeTimeouts() int64 {
+	return metricValue(metricProbeTimeouts)
+}
+
+func metricValue(name string) int64 {
+	if v, ok := metrics.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// ServeMetrics serves the expvar metrics in JSON at MetricsPath on addr, until the listener fails
+func ServeMetrics(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, expvar.Handler())
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return server.ListenAndServe()
+}
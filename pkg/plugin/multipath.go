@@ -0,0 +1,262 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+const (
+	// MultipathModeDM exposes only the /dev/dm-N node of a multipath map
+	MultipathModeDM = "dm"
+	// MultipathModeDMAndPaths exposes the dm node, its paths and the devices built on it (holders)
+	MultipathModeDMAndPaths = "dm-and-paths"
+	// MultipathModeMapper exposes the /dev/mapper/<name> alias of the map
+	MultipathModeMapper = "mapper"
+
+	multipathUUIDPrefix = "mpath-"
+	pathStateRunning    = "running"
+	healthCheckInterval = 10 * time.Second
+)
+
+// MultipathPath is a single path (/dev/sdX) of a multipath map
+type MultipathPath struct {
+	Name  string
+	State string
+}
+
+// MultipathMap is a device-mapper multipath map and the block devices it is built from
+type MultipathMap struct {
+	// Name is the kernel name, e.g. dm-3
+	Name string
+	// Alias is the /dev/mapper name, e.g. mpatha
+	Alias string
+	UUID  string
+	Paths []MultipathPath
+	// Holders are the devices built on the map, e.g. its kpartx partitions and what is built on those
+	Holders []string
+}
+
+// ActivePaths counts the paths in the running state
+func (m *MultipathMap) ActivePaths() int {
+	active := 0
+	for _, path := range m.Paths {
+		if path.State == pathStateRunning {
+			active++
+		}
+	}
+	return active
+}
+
+// Degraded reports whether some paths are down while others still serve I/O
+func (m *MultipathMap) Degraded() bool {
+	active := m.ActivePaths()
+	return active > 0 && active < len(m.Paths)
+}
+
+// Health is Unhealthy when no path is left, a map with some paths down is degraded but still usable
+func (m *MultipathMap) Health() string {
+	if m.ActivePaths() == 0 {
+		return pluginapi.Unhealthy
+	}
+	return pluginapi.Healthy
+}
+
+// MultipathScanner is implemented by scanners that can read the multipath topology.
+// Scanners without it are treated as having no multipath maps.
+type MultipathScanner interface {
+	MultipathMaps() (map[string]*MultipathMap, error)
+}
+
+// ReadMultipathMaps builds the multipath maps from sysRoot/block/dm-*, keyed by the dm name.
+// Only dm devices with an mpath- uuid are returned; their slaves are the paths and their holders, followed
+// all the way up, the devices built on them.
+func ReadMultipathMaps(sysRoot string) (map[string]*MultipathMap, error) {
+	blockDir := filepath.Join(sysRoot, "block")
+	entries, err := os.ReadDir(blockDir)
+	if err != nil {
+		return nil, err
+	}
+
+	maps := map[string]*MultipathMap{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, "dm-") {
+			continue
+		}
+		uuid := readSysfsString(filepath.Join(blockDir, name, "dm", "uuid"))
+		if !strings.HasPrefix(uuid, multipathUUIDPrefix) {
+			continue
+		}
+		m := &MultipathMap{
+			Name:    name,
+			Alias:   readSysfsString(filepath.Join(blockDir, name, "dm", "name")),
+			UUID:    uuid,
+			Holders: readHolders(blockDir, name),
+		}
+		for _, slave := range readSysfsDir(filepath.Join(blockDir, name, "slaves")) {
+			state := readSysfsString(filepath.Join(blockDir, slave, "device", "state"))
+			if state == "" {
+				// not every transport exposes a state, a present path is considered up
+				state = pathStateRunning
+			}
+			m.Paths = append(m.Paths, MultipathPath{Name: slave, State: state})
+		}
+		maps[name] = m
+	}
+	return maps, nil
+}
+
+// readHolders lists the devices built on the block device name, the holders of its holders included
+func readHolders(blockDir, name string) []string {
+	holders := []string{}
+	seen := map[string]bool{name: true}
+	queue := readSysfsDir(filepath.Join(blockDir, name, "holders"))
+	for len(queue) > 0 {
+		holder := queue[0]
+		queue = queue[1:]
+		if seen[holder] {
+			continue
+		}
+		seen[holder] = true
+		holders = append(holders, holder)
+		queue = append(queue, readSysfsDir(filepath.Join(blockDir, holder, "holders"))...)
+	}
+	return holders
+}
+
+func readSysfsString(path string) string {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func readSysfsDir(path string) []string {
+	entries, err := os.ReadDir(filepath.Clean(path))
+	if err != nil {
+		return nil
+	}
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GroupMultipathDevices drops the paths of multipath maps and the devices built on them from devices,
+// so each map is one allocatable unit and a partition of a map never goes to a second container
+func GroupMultipathDevices(devices []string, maps map[string]*MultipathMap) []string {
+	pathOf := map[string]string{}
+	holderOf := map[string]string{}
+	for _, m := range maps {
+		for _, path := range m.Paths {
+			pathOf[path.Name] = m.Name
+		}
+		for _, holder := range m.Holders {
+			holderOf[holder] = m.Name
+		}
+	}
+
+	grouped := []string{}
+	for _, dev := range devices {
+		name := strings.TrimPrefix(dev, "/dev/")
+		if owner, ok := pathOf[name]; ok {
+			klog.V(4).Infof("Device %s is a path of multipath map %s, not advertised on its own", dev, owner)
+			continue
+		}
+		if owner, ok := holderOf[name]; ok {
+			klog.V(4).Infof("Device %s is built on multipath map %s, not advertised on its own", dev, owner)
+			continue
+		}
+		grouped = append(grouped, dev)
+	}
+	return grouped
+}
+
+// MultipathDevicePaths returns the host paths exposed for a map in the given mode
+func MultipathDevicePaths(m *MultipathMap, mode string) []string {
+	switch mode {
+	case MultipathModeMapper:
+		if m.Alias != "" {
+			return []string{"/dev/mapper/" + m.Alias}
+		}
+	case MultipathModeDMAndPaths:
+		paths := []string{"/dev/" + m.Name}
+		for _, path := range m.Paths {
+			paths = append(paths, "/dev/"+path.Name)
+		}
+		for _, holder := range m.Holders {
+			paths = append(paths, "/dev/"+holder)
+		}
+		return paths
+	}
+	return []string{"/dev/" + m.Name}
+}
+
+// multipathMaps reads the maps when multipath grouping is enabled and the scanner supports it
+func multipathMaps(scanner DeviceScanner, mode string) map[string]*MultipathMap {
+	if mode == "" {
+		return nil
+	}
+	mpScanner, ok := scanner.(MultipathScanner)
+	if !ok {
+		return nil
+	}
+	maps, err := mpScanner.MultipathMaps()
+	if err != nil {
+		klog.Warningf("Unable to read multipath maps: %v", err)
+		return nil
+	}
+	return maps
+}
+
+// CheckDeviceHealth re-reads the multipath paths and publishes the health of each advertised map.
+// A map turning degraded is reported with a MultipathDegraded event, it stays Healthy for the kubelet.
+func (p *PowerPlugin) CheckDeviceHealth() {
+	state := p.snapshot()
+	if state.config == nil || state.config.MultipathMode == "" {
+		return
+	}
+	maps := multipathMaps(p.scanner(), state.config.MultipathMode)
+	for _, dev := range state.devices {
+		m, ok := maps[strings.TrimPrefix(dev, "/dev/")]
+		if !ok {
+			continue
+		}
+		degraded := m.Degraded()
+		if degraded {
+			klog.Warningf("Multipath map %s (%s) is degraded: %d of %d paths active", m.Name, m.Alias, m.ActivePaths(), len(m.Paths))
+		}
+		if p.setDeviceDegraded(dev, degraded) && degraded {
+			p.Reporter.Event(corev1.EventTypeWarning, ReasonMultipathDegraded, "Multipath map %s (%s) is degraded: %d of %d paths active",
+				deviceID(dev), m.Alias, m.ActivePaths(), len(m.Paths))
+		}
+		p.setDeviceHealth(dev, m.Health())
+	}
+}
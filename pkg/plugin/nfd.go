@@ -0,0 +1,195 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog"
+)
+
+const (
+	// NodeFeatureFile is the Node Feature Discovery local source file written after each scan
+	NodeFeatureFile = "/etc/kubernetes/node-feature-discovery/features.d/power-device-plugin"
+	nfdLabelPrefix  = "power-dev-plugin.ibm.com/"
+	nxGzipDevice    = "/dev/crypto/nx-gzip"
+	// maxLabelValue keeps an attribute short enough for the 63 characters of a label name
+	maxLabelValue = 32
+)
+
+// BuildNodeFeatures summarizes the discovered devices into NFD feature labels.
+// The pool count is keyed on the advertised resource and counts the devices besides nx-gzip. Each
+// name prefix (dm, sd, nvme, ...) and each vendor, model and transport of attrs gets its own count,
+// and the size summary is in GiB, so schedulers can match on them. attrs may be nil.
+func BuildNodeFeatures(devices []string, nxGzip bool, attrs map[string]*DeviceAttributes) map[string]string {
+	features := map[string]string{}
+	pool := resource[strings.LastIndex(resource, "/")+1:]
+
+	nxGzipFound := false
+	count := 0
+	var totalBytes, maxBytes uint64
+	counts := map[string]int{}
+	for _, dev := range devices {
+		if devicePath(dev) == nxGzipDevice {
+			nxGzipFound = true
+			continue
+		}
+		count++
+		counts[deviceNamePrefix(dev)+".count"]++
+		attr := attrs[strings.TrimPrefix(dev, "/dev/")]
+		if attr == nil {
+			continue
+		}
+		for _, summary := range []struct{ kind, value string }{
+			{"vendor", attr.Vendor}, {"model", attr.Model}, {"transport", attr.Transport},
+		} {
+			if value := labelValue(summary.value); value != "" {
+				counts[summary.kind+"."+value+".count"]++
+			}
+		}
+		totalBytes += attr.SizeBytes
+		maxBytes = max(maxBytes, attr.SizeBytes)
+	}
+	features[nfdLabelPrefix+pool+".count"] = strconv.Itoa(count)
+	for key, n := range counts {
+		features[nfdLabelPrefix+pool+"."+key] = strconv.Itoa(n)
+	}
+	if totalBytes > 0 {
+		features[nfdLabelPrefix+pool+".size-gi.total"] = strconv.FormatUint(totalBytes>>30, 10)
+		features[nfdLabelPrefix+pool+".size-gi.max"] = strconv.FormatUint(maxBytes>>30, 10)
+	}
+	features[nfdLabelPrefix+"nx-gzip"] = strconv.FormatBool(nxGzip && nxGzipFound)
+	return features
+}
+
+// deviceNamePrefix strips the path and the instance number from a device name, e.g. /dev/dm-3 -> dm
+func deviceNamePrefix(dev string) string {
+	if isVFIOGroup(devicePath(dev)) {
+		return "vfio"
+	}
+	name := filepath.Base(dev)
+	if strings.HasPrefix(name, "nvme") {
+		return "nvme"
+	}
+	name = strings.TrimRight(name, "0123456789")
+	name = strings.TrimSuffix(name, "-")
+	if strings.HasPrefix(name, "sd") || strings.HasPrefix(name, "vd") {
+		// sda, sdab, sda1 all share a prefix
+		return name[:2]
+	}
+	if name == "" {
+		return "other"
+	}
+	return name
+}
+
+// labelValue turns an attribute such as "IBM     " or "Micron_7450" into a lowercase label name
+// part, replacing what a label cannot hold with dashes. Empty when nothing is left.
+func labelValue(value string) string {
+	value = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, strings.TrimSpace(value))
+	if len(value) > maxLabelValue {
+		value = value[:maxLabelValue]
+	}
+	return strings.Trim(value, "-_.")
+}
+
+// FormatNodeFeatures renders the features in the NFD local source format (one key=value per line), sorted by key
+func FormatNodeFeatures(features map[string]string) []byte {
+	keys := make([]string, 0, len(features))
+	for k := range features {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by power-device-plugin. Do not edit.\n")
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s=%s\n", k, features[k])
+	}
+	return buf.Bytes()
+}
+
+// WriteNodeFeatureFile writes the features to path, only touching the file when the content changed.
+// The file is replaced atomically so nfd-worker never reads a partial file.
+func WriteNodeFeatureFile(path string, features map[string]string) error {
+	data := FormatNodeFeatures(features)
+
+	existing, err := os.ReadFile(filepath.Clean(path))
+	if err == nil && bytes.Equal(existing, data) {
+		klog.V(4).Infof("NFD feature file %s is up to date", path)
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".power-device-plugin-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	klog.Infof("Updated NFD feature file %s", path)
+	return nil
+}
+
+// exportNodeFeatures writes the NFD feature file when enabled in the config of a scan, errors are only logged
+func (p *PowerPlugin) exportNodeFeatures(found discovery) {
+	config := found.config
+	if config == nil || !config.NodeFeatures {
+		return
+	}
+	path := p.NodeFeatureFile
+	if path == "" {
+		path = NodeFeatureFile
+	}
+	var attrs map[string]*DeviceAttributes
+	if attrScanner, ok := p.scanner().(AttributeScanner); ok {
+		var err error
+		if attrs, err = attrScanner.DeviceAttributes(found.devices); err != nil {
+			klog.Warningf("Unable to read device attributes for the NFD feature file: %v", err)
+		}
+		attrs = withBlockDeviceRecords(attrs, found.devices, found.records)
+	}
+	if err := WriteNodeFeatureFile(path, BuildNodeFeatures(found.devices, config.NxGzip, attrs)); err != nil {
+		klog.Warningf("Unable to write NFD feature file %s: %v", path, err)
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ocp-power-demos/power-dev-plugin/api"
+	"k8s.io/klog"
+)
+
+// PermissionSourceDefault marks a permission coming from the permissions field rather than a rule
+const PermissionSourceDefault = "permissions"
+
+// ValidatePermissions checks a cgroup permission string is a non-empty combination of r, w and m,
+// each at most once, and returns it lowercase in rwm order
+func ValidatePermissions(perm string) (string, error) {
+	perm = strings.ToLower(strings.TrimSpace(perm))
+	if perm == "" {
+		return "", fmt.Errorf("permissions are empty")
+	}
+	seen := map[rune]bool{}
+	for _, c := range perm {
+		if !strings.ContainsRune("rwm", c) {
+			return "", fmt.Errorf("invalid permission %q in %q, only r, w and m are allowed", c, perm)
+		}
+		if seen[c] {
+			return "", fmt.Errorf("permission %q repeated in %q", c, perm)
+		}
+		seen[c] = true
+	}
+	ordered := ""
+	for _, c := range "rwm" {
+		if seen[c] {
+			ordered += string(c)
+		}
+	}
+	return ordered, nil
+}
+
+// permissionRule is a validated permission rule
+type permissionRule struct {
+	deviceMatcher
+	permissions string
+	// source names the rule, e.g. "permission-rules[1] (backup LUNs)"
+	source string
+}
+
+// PermissionPolicy resolves the cgroup permissions of each device from the permissions of its device
+// class and the permission rules, falling back to the permissions field
+type PermissionPolicy struct {
+	rules       []permissionRule
+	defaultPerm string
+}
+
+// NewPermissionPolicy validates the permission rules of config, invalid rules are logged and skipped.
+// classes is the device class of each device by name, as the scan found them.
+func NewPermissionPolicy(config *api.DevicePluginConfig, classes map[string]string) *PermissionPolicy {
+	policy := &PermissionPolicy{defaultPerm: GetValidatedPermission(config)}
+	if config == nil {
+		return policy
+	}
+	for _, class := range compileDeviceClasses(config) {
+		if class.Permissions == "" {
+			continue
+		}
+		perm, err := ValidatePermissions(class.Permissions)
+		if err != nil {
+			klog.Warningf("Invalid permissions of device class %d (%s): %v. Skipping...", class.index, class.Name, err)
+			continue
+		}
+		policy.rules = append(policy.rules, permissionRule{deviceMatcher: class.membersMatcher(classes), permissions: perm, source: class.source()})
+	}
+	for i, rule := range config.PermissionRules {
+		perm, err := ValidatePermissions(rule.Permissions)
+		if err != nil {
+			klog.Warningf("Invalid permission rule %d (%s): %v. Skipping...", i, rule.Comment, err)
+			continue
+		}
+		matcher, err := compileDeviceMatcher(rule.Glob, rule.Regex, rule.Selector)
+		if err != nil {
+			klog.Warningf("Invalid permission rule %d (%s): %v. Skipping...", i, rule.Comment, err)
+			continue
+		}
+		source := fmt.Sprintf("permission-rules[%d]", i)
+		if rule.Comment != "" {
+			source += " (" + rule.Comment + ")"
+		}
+		policy.rules = append(policy.rules, permissionRule{deviceMatcher: matcher, permissions: perm, source: source})
+	}
+	return policy
+}
+
+// HasRules reports whether any device can get other permissions than the default
+func (p *PermissionPolicy) HasRules() bool {
+	return len(p.rules) > 0
+}
+
+// NeedsAttributes reports whether any rule matches on device attributes
+func (p *PermissionPolicy) NeedsAttributes() bool {
+	for _, rule := range p.rules {
+		if rule.selector != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the permissions of a device and where they come from, e.g. "permission-rules[1] (backup LUNs)"
+func (p *PermissionPolicy) Resolve(dev string, aliases DeviceAliases, attrs *DeviceAttributes) (string, string) {
+	names := aliases.Names(dev)
+	for _, rule := range p.rules {
+		if rule.matches(names, attrs) {
+			return rule.permissions, rule.source
+		}
+	}
+	return p.defaultPerm, PermissionSourceDefault
+}
+
+// ResolveAll resolves the permissions of the devices, reading aliases and attributes only when the rules need them
+func (p *PermissionPolicy) ResolveAll(scanner DeviceScanner, devices []string) (map[string]string, map[string]string) {
+	perms := map[string]string{}
+	sources := map[string]string{}
+	aliases, attrs := deviceDetails(scanner, devices, p.HasRules(), p.NeedsAttributes())
+	for _, dev := range devices {
+		perms[dev], sources[dev] = p.Resolve(dev, aliases, attrs[strings.TrimPrefix(dev, "/dev/")])
+	}
+	return perms, sources
+}
+
+// deviceDetails reads the aliases and attributes of devices as far as the rules in use need them
+func deviceDetails(scanner DeviceScanner, devices []string, needAliases, needAttrs bool) (DeviceAliases, map[string]*DeviceAttributes) {
+	var aliases DeviceAliases
+	if needAliases {
+		aliases = deviceAliases(scanner)
+	}
+	return aliases, deviceAttributes(scanner, devices, needAttrs)
+}
@@ -24,16 +24,17 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
-	"strconv"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/jaypipes/ghw"
 	"github.com/ocp-power-demos/power-dev-plugin/api"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/klog"
 
 	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
@@ -48,53 +49,128 @@ const (
 	getPreferredAllocationFlag = false
 	unix                       = "unix"
 	configPath                 = "/etc/power-device-plugin/config.json"
+	socketHealthInterval       = 10 * time.Second
+	rescanInterval             = 1 * time.Minute
 )
 
 // DevicePluginServer is a mandatory interface that must be implemented by all plugins.
 // For more information see
 // https://godoc.org/k8s.io/kubernetes/pkg/kubelet/apis/deviceplugin/v1beta#DevicePluginServer
 type PowerPlugin struct {
-	devs   []string
 	socket string
 
-	stop     chan interface{}
-	health   chan *pluginapi.Device
-	restart  chan struct{}
-	stopOnce sync.Once
-
-	server *grpc.Server
-
+	server        *grpc.Server
+	lifecycleLock sync.Mutex
+
+	// state is the current snapshot, see snapshot and update; the controller is its only writer
+	state     atomic.Pointer[deviceState]
+	stateOnce sync.Once
+	// ctrl is the running controller, Stop ends it and Start after Stop replaces it
+	ctrl atomic.Pointer[controller]
+	// audit is the audit logger of the audit-log settings of the last scan, see configureAudit
+	audit         *AuditLogger
+	auditSettings auditSettings
+	auditLock     sync.Mutex
+	// allocateLock serializes Allocate requests
+	allocateLock sync.Mutex
+	// scanning is the scan in flight, shared by concurrent Rescan calls
+	scanning *scanCall
+	scanLock sync.Mutex
+	// probes are the device probes of the scans
+	probes prober
+
+	// Config is the config the plugin starts with, each scan replaces it with the config it loads.
+	// It is read once; the running config is part of the plugin state.
 	Config  *api.DevicePluginConfig
 	Cache   *DeviceCache
 	Scanner DeviceScanner
 
+	// DeviceUsage seeds the usage of each device, keyed by /dev path. It is read once; use Usage
+	// for the current usage.
 	DeviceUsage map[string]int
-	usageLock   sync.Mutex
+
+	// NodeFeatureFile overrides the NFD feature file location, defaults to NodeFeatureFile
+	NodeFeatureFile string
+
+	// Reporter records Kubernetes Events and the node condition, nil when not running in a cluster
+	Reporter *NodeReporter
+	// Inventory publishes the node's PowerDeviceInventory, nil when not running in a cluster
+	Inventory *InventoryReporter
+	// Audit records every allocation when set, instead of the audit-log of the config
+	Audit *AuditLogger
+	// Policy picks the devices of each container, overriding allocation-policy when set
+	Policy AllocationPolicy
+
+	// KubeletSocket is the kubelet registration socket, pluginapi.KubeletSocket when empty
+	KubeletSocket string
+	// SocketHealthInterval is how often the controller checks the sockets, 10s when zero
+	SocketHealthInterval time.Duration
+	// RescanInterval is how often the controller refreshes the devices, 1m when zero
+	RescanInterval time.Duration
+
+	PodResolver PodResolver
+	// Allocations reports the containers holding devices, so Allocate releases the usage of the
+	// containers that are gone. The usage recorded by Allocate is never released when it is nil.
+	Allocations AllocationLister
 
 	pluginapi.DevicePluginServer
 }
 
+// scanCall is a scan in flight, its result is set before done is closed
+type scanCall struct {
+	done    chan struct{}
+	devices []string
+	err     error
+	// timedOut is set once a caller stopped waiting for the scan
+	timedOut atomic.Bool
+}
+
 type DeviceCache struct {
 	Devices      []string
 	LastScanTime time.Time
 	Mutex        sync.Mutex
+	// records are the discovery records of Devices, classes the device classes of its character devices
+	records map[string]BlockDevice
+	classes map[string]string
 }
 
 // Creates a Plugin
 func New() (*PowerPlugin, error) {
-	// Empty array to start.
-	var devs []string = []string{}
 	return &PowerPlugin{
-		devs:        devs,
 		socket:      socket,
-		stop:        make(chan interface{}),
-		health:      make(chan *pluginapi.Device),
-		restart:     make(chan struct{}, 1),
 		Cache:       &DeviceCache{},
 		DeviceUsage: make(map[string]int),
+		Reporter:    NewInClusterNodeReporter(),
+		Inventory:   NewInClusterInventoryReporter(),
+		PodResolver: NewKubeletPodResolver(),
+		Allocations: NewKubeletAllocationLister(),
 	}, nil
 }
 
+// NewWithPluginDir creates a plugin serving its socket from dir and registering with the kubelet
+// socket in dir, instead of pluginapi.DevicePluginPath. Tests point it at a fake kubelet.
+func NewWithPluginDir(dir string) (*PowerPlugin, error) {
+	p, err := New()
+	if err != nil {
+		return nil, err
+	}
+	p.socket = filepath.Join(dir, socketFile)
+	p.KubeletSocket = filepath.Join(dir, filepath.Base(pluginapi.KubeletSocket))
+	return p, nil
+}
+
+// SocketPath is the socket the device plugin server listens on
+func (p *PowerPlugin) SocketPath() string {
+	return p.socket
+}
+
+func (p *PowerPlugin) kubeletSocket() string {
+	if p.KubeletSocket == "" {
+		return pluginapi.KubeletSocket
+	}
+	return p.KubeletSocket
+}
+
 // no-action needed to get options
 func (p *PowerPlugin) GetDevicePluginOptions(context.Context, *pluginapi.Empty) (*pluginapi.DevicePluginOptions, error) {
 	return &pluginapi.DevicePluginOptions{
@@ -103,37 +179,36 @@ func (p *PowerPlugin) GetDevicePluginOptions(context.Context, *pluginapi.Empty)
 	}, nil
 }
 
-// dial establishes the gRPC communication with the registered device plugin.
-func dial() (*grpc.ClientConn, error) {
+// dial establishes the gRPC communication with the kubelet socket.
+func dial(kubeletSocket string) (*grpc.ClientConn, error) {
 	c, err := grpc.NewClient(
-		unix+":"+pluginapi.KubeletSocket,
+		unix+":"+kubeletSocket,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 	)
 	if err != nil {
-		klog.Errorf("%s device plugin unable connect to Kubelet : %v", pluginapi.KubeletSocket, err)
+		klog.Errorf("%s device plugin unable connect to Kubelet : %v", kubeletSocket, err)
 		return nil, err
 	}
 
 	return c, nil
 }
 
-// Start starts the gRPC server of the device plugin
+// Start starts the gRPC server of the device plugin, and a new controller when the plugin was stopped
 func (p *PowerPlugin) Start() error {
-	config, err := LoadDevicePluginConfig()
-	if err != nil {
-		klog.Warningf("Failed to load config file: %v. Proceeding without nx-gzip.", err)
+	p.snapshot()
+	p.lifecycleLock.Lock()
+	if c := p.ctrl.Load(); c.stopped() {
+		p.startController()
 	}
+	p.lifecycleLock.Unlock()
 
-	p.Config = config
-
-	devices, err := p.GetDiscoveredDevices()
+	// the scan loads the config
+	devices, err := p.Rescan()
 	if err != nil {
-		klog.Errorf("Scan root for devices was unsuccessful during ListAndWatch: %v", err)
+		klog.Errorf("Scan root for devices was unsuccessful during Start: %v", err)
 		return err
 	}
-
-	p.devs = devices
-	klog.Infof("Initiatlizing the devices recorded with the plugin to: %v", p.devs)
+	klog.Infof("Initiatlizing the devices recorded with the plugin to: %v", devices)
 
 	errx := p.cleanup()
 	if errx != nil {
@@ -146,19 +221,22 @@ func (p *PowerPlugin) Start() error {
 		return err
 	}
 
-	p.server = grpc.NewServer()
-	pluginapi.RegisterDevicePluginServer(p.server, p)
+	server := grpc.NewServer()
+	pluginapi.RegisterDevicePluginServer(server, p)
+	p.lifecycleLock.Lock()
+	p.server = server
+	p.lifecycleLock.Unlock()
 
 	// start serving from grpcServer
 	go func() {
-		err := p.server.Serve(sock)
+		err := server.Serve(sock)
 		if err != nil {
 			klog.Errorf("serving incoming requests failed: %s", err.Error())
 		}
 	}()
 
 	// Wait for server to start by launching a blocking connection
-	conn, err := dial()
+	conn, err := dial(p.kubeletSocket())
 	if err != nil {
 		klog.Errorf("unable to dial %v", err)
 		return err
@@ -170,25 +248,30 @@ func (p *PowerPlugin) Start() error {
 	return nil
 }
 
-// Stop stops the gRPC server
+// Stop stops the gRPC server and the controller. It is safe to call more than once and from any goroutine.
 func (p *PowerPlugin) Stop() error {
-	if p.server == nil {
+	p.lifecycleLock.Lock()
+	server := p.server
+	p.server = nil
+	// ListAndWatch returns on stop, which lets the server stop
+	p.controller().shutdown()
+	p.lifecycleLock.Unlock()
+	if server == nil {
 		return nil
 	}
-	p.server.Stop()
-	p.server = nil
-	close(p.stop)
+	server.Stop()
+	p.Reporter.SetReady(false, ReasonPluginStopped, "device plugin server stopped")
 
 	return p.cleanup()
 }
 
 // Registers the device plugin for the given resourceName with Kubelet.
 func (p *PowerPlugin) Register(kubeletEndpoint, resourceName string) error {
-	conn, err := dial()
-	//defer conn.Close()
+	conn, err := dial(kubeletEndpoint)
 	if err != nil {
 		return err
 	}
+	defer conn.Close()
 	klog.Infof("Dial kubelet endpoint %s", conn.Target())
 
 	client := pluginapi.NewRegistrationClient(conn)
@@ -206,154 +289,174 @@ func (p *PowerPlugin) Register(kubeletEndpoint, resourceName string) error {
 	return nil
 }
 
-// Lists devices and update that list according to the health status
+// Lists devices and update that list according to the health status. Every stream sends the
+// current devices and again whenever the devices, their health or the config change.
 func (p *PowerPlugin) ListAndWatch(e *pluginapi.Empty, stream pluginapi.DevicePlugin_ListAndWatchServer) error {
-	klog.Infof("Listing devices: %v", p.devs)
-
-	go p.MonitorSocketHealth()
-
-	// Initial scan if devices list is empty
-	if len(p.devs) == 0 {
-		devices, err := p.GetDiscoveredDevices()
-		if err != nil {
-			klog.Errorf("Scan root for devices was unsuccessful during ListAndWatch: %v", err)
-			return err
-		}
-		p.devs = devices
-		klog.Infof("Updating the devices to %d total devices", len(p.devs))
-	}
-
-	// Always send device list at the beginning
-	if err := stream.Send(&pluginapi.ListAndWatchResponse{Devices: convertDeviceToPluginDevices(p.devs)}); err != nil {
-		klog.Errorf("Failed to send initial device list: %v", err)
+	// Initial scan if nothing was discovered yet
+	if _, err := p.inventory(); err != nil {
+		klog.Errorf("Scan root for devices was unsuccessful during ListAndWatch: %v", err)
 		return err
 	}
 
+	stop := p.controller().stop
+	sent := false
+	var generation uint64
 	for {
+		state := p.snapshot()
+		if !sent || state.generation != generation {
+			klog.Infof("Listing devices: %v", state.devices)
+			if err := stream.Send(&pluginapi.ListAndWatchResponse{Devices: advertisedDevices(state, p.scanner())}); err != nil {
+				klog.Errorf("Failed to send device list to kubelet: %v", err)
+				return err
+			}
+			sent, generation = true, state.generation
+		}
+
 		select {
-		case <-p.stop:
+		case <-state.changed:
+		case <-stop:
 			klog.Infoln("Told to Stop...")
 			return nil
-
-		case <-p.restart:
-			klog.Infoln("Told to restart...")
-			p.Stop()
+		case <-stream.Context().Done():
+			klog.Infoln("ListAndWatch stream closed by the kubelet")
 			return nil
-
-		case d := <-p.health:
-			//ignoring unhealthy state.
-			klog.Infoln("Checking the health")
-			klog.Infof("Device health update received for %s", d.ID)
-			d.Health = pluginapi.Healthy
-
-			if err := stream.Send(&pluginapi.ListAndWatchResponse{Devices: convertDeviceToPluginDevices(p.devs)}); err != nil {
-				klog.Errorf("Failed to send updated device health to kubelet: %v", err)
-				return err
-			}
 		}
 	}
 }
 
-// Allocate returns list of devices for the container request.
+// Allocate returns list of devices for the container request. The request is served as a whole:
+// containers are allocated against a copy of the device usage, which replaces the usage only when
+// every container got its devices, so a rejected container never leaks what earlier ones took.
+// Devices, what is known about them and the config come from the last scan, so Allocate neither
+// scans nor reads the host or the config file once the plugin is serving.
 func (p *PowerPlugin) Allocate(ctx context.Context, reqs *pluginapi.AllocateRequest) (*pluginapi.AllocateResponse, error) {
+	return p.allocate(reqs, p.Policy)
+}
+
+// allocate serves an Allocate request with policy, or the allocation-policy of the config when it is nil.
+// The usage is the one recorded in the state; the kubelet is asked for the containers that are gone
+// only when a container is rejected because of the upper limits, and the request is then served again.
+func (p *PowerPlugin) allocate(reqs *pluginapi.AllocateRequest, policy AllocationPolicy) (*pluginapi.AllocateResponse, error) {
 	klog.Infof("Allocate request: %v", reqs)
 
-	devices, err := p.GetDiscoveredDevices()
-	if err != nil {
+	if _, err := p.inventory(); err != nil {
 		klog.Errorf("Scan root for devices was unsuccessful: %v", err)
 		return nil, err
 	}
 
-	config, err := LoadDevicePluginConfig()
-	if err != nil {
-		klog.Warningf("Failed to load config: %v", err)
+	responses, audits, rejectErr := p.serveAllocate(reqs, policy)
+	if rejectErr != nil && len(audits[len(audits)-1].LimitSkipped) > 0 && p.reconcileUsage() {
+		klog.Infof("Serving the request again, the kubelet no longer reports containers that held devices")
+		responses, audits, rejectErr = p.serveAllocate(reqs, policy)
 	}
 
-	upperLimit := config.UpperLimitPerDevice
-	if upperLimit <= 0 {
-		upperLimit = 100_000 // default: effectively unlimited
+	if rejectErr != nil {
+		p.Reporter.Event(corev1.EventTypeWarning, ReasonAllocationRejected, "Allocation rejected: %v", rejectErr)
+		// the containers served before the rejected one are handed nothing either
+		for j := range audits[:len(audits)-1] {
+			audits[j].Result, audits[j].Error = AuditResultRolledBack, rejectErr.Error()
+		}
+		if len(audits) > 1 {
+			klog.Warningf("Rolled back %d containers of the request: %v", len(audits)-1, rejectErr)
+		}
+	}
+	for _, audit := range audits {
+		p.auditAllocation(audit)
+	}
+	if rejectErr != nil {
+		return nil, rejectErr
 	}
-	klog.Infof("Using upper-limit per device: %d", upperLimit)
-
-	responses := pluginapi.AllocateResponse{}
 
-	for i, req := range reqs.ContainerRequests {
-		klog.Infof("Handling container request %d: %+v", i, req)
-
-		ds := []*pluginapi.DeviceSpec{}
-		allocated := 0
-		skippedDueToLimit := 0
-		totalDevices := len(devices)
-
-		p.usageLock.Lock()
-		klog.Infof("Current device usage: %+v", p.DeviceUsage)
-		for _, dev := range devices {
-			devPath := dev
-			if !strings.HasPrefix(dev, "/dev/") {
-				devPath = "/dev/" + dev
-			}
-			count := p.DeviceUsage[devPath]
-			klog.Infof("Evaluating device %s: current usage=%d, limit=%d", dev, count, upperLimit)
-
-			if count < upperLimit {
-				p.DeviceUsage[devPath]++
-				klog.Infof("Allocating device %s to container. New usage: %d", dev, p.DeviceUsage[dev])
-
-				ds = append(ds, &pluginapi.DeviceSpec{
-					HostPath:      devPath,
-					ContainerPath: devPath,
-					// Per DeviceSpec:
-					// Cgroups permissions of the device, candidates are one or more of
-					// * r - allows container to read from the specified device.
-					// * w - allows container to write to the specified device.
-					// * m - allows container to create device files that do not yet exist.
-					// We don't need `m`
-					Permissions: GetValidatedPermission(config),
-				})
-				allocated++
-				// If we were strict, we would allocate 1 device per container
-			} else {
-				klog.Infof("Device %s reached upper-limit; marking skipped", dev)
-				skippedDueToLimit++
-			}
-		}
-		p.usageLock.Unlock()
+	klog.Infof("Final Allocate response for all containers: %+v", responses)
+	return responses, nil
+}
 
-		if allocated == 0 {
-			if skippedDueToLimit == totalDevices {
-				klog.Errorf("All devices reached upper-limit; cannot allocate to container %d", i)
-				return nil, fmt.Errorf("upper limit per device reached for all devices for container %d", i)
-			}
-			klog.Errorf("Insufficient devices: requested=1, allocated=0 for container %d", i)
-			return nil, fmt.Errorf("not enough available devices to satisfy request for container %d", i)
-		}
+// serveAllocate computes the responses of a request against the recorded usage and publishes the
+// grants of the containers it served. The audit record of each container is returned with the
+// error of the rejected one, if any.
+func (p *PowerPlugin) serveAllocate(reqs *pluginapi.AllocateRequest, policy AllocationPolicy) (*pluginapi.AllocateResponse, []AuditRecord, error) {
+	p.allocateLock.Lock()
+	defer p.allocateLock.Unlock()
+	state := p.snapshot()
 
-		response := pluginapi.ContainerAllocateResponse{
-			Devices: ds,
+	config := state.config
+	if config == nil {
+		config = &api.DevicePluginConfig{}
+	}
+	a := &allocation{limitPolicy: NewUpperLimitPolicy(config, state.classes), policy: policy}
+	if a.policy == nil {
+		a.policy = LookupAllocationPolicy(config)
+	}
+	a.devices, a.reserved = ReservedDevices(state.devices, reservedCount(config), state.classes)
+	klog.Infof("Using allocation policy %s, upper-limit per device: %s, %d devices reserved",
+		a.policy.Name(), describeLimit(a.limitPolicy.Default()), len(a.reserved))
+
+	// the maps, aliases and attributes were read with the devices, Allocate does not read the host
+	a.multipathMode = config.MultipathMode
+	a.maps = state.info.maps
+	a.permPolicy = NewPermissionPolicy(config, state.classes)
+	a.pathPolicy = NewContainerPathPolicy(config)
+	a.aliases, a.attrs = state.info.aliases, state.info.attrs
+	a.classes = state.classes
+
+	responses := &pluginapi.AllocateResponse{}
+	audits := []AuditRecord{}
+	var rejectErr error
+
+	a.grants = slices.Clone(state.grants)
+	usage := countUsage(a.grants)
+	klog.Infof("Current device usage: %d devices allocated", len(usage))
+	klog.V(4).Infof("Current device usage: %+v", usage)
+	for i, req := range reqs.ContainerRequests {
+		response, audit, err := p.allocateContainer(a, i, req, usage)
+		audits = append(audits, audit)
+		if err != nil {
+			rejectErr = err
+			break
 		}
-		klog.Infof("Allocate response for container %d: %+v", i, &response)
-		responses.ContainerResponses = append(responses.ContainerResponses, &response)
+		responses.ContainerResponses = append(responses.ContainerResponses, response)
 	}
-
-	klog.Infof("Final Allocate response for all containers: %+v", &responses)
-	return &responses, nil
+	if rejectErr == nil {
+		p.commitGrants(a.grants)
+	} else {
+		p.commitGrants(a.grants[:len(a.grants)-len(responses.ContainerResponses)])
+	}
+	return responses, audits, rejectErr
 }
 
-func convertDeviceToPluginDevices(devS []string) []*pluginapi.Device {
+// convertDeviceToPluginDevices advertises each device under its name, or as replica IDs when replicas
+// returns more than 1 for it
+func convertDeviceToPluginDevices(devS []string, health func(dev string) string, replicas func(dev string) int) []*pluginapi.Device {
 	klog.Infof("Converting Devices to Plugin Devices - %d", len(devS))
 	devs := []*pluginapi.Device{}
-	for idx := range devS {
-		devs = append(devs, &pluginapi.Device{
-			ID:     strconv.Itoa(idx),
-			Health: pluginapi.Healthy,
-		})
+	for _, dev := range devS {
+		n := 1
+		if replicas != nil {
+			n = replicas(dev)
+		}
+		if n <= 1 {
+			devs = append(devs, &pluginapi.Device{ID: deviceID(dev), Health: health(dev)})
+			continue
+		}
+		for i := 0; i < n; i++ {
+			devs = append(devs, &pluginapi.Device{ID: ReplicaID(dev, i), Health: health(dev)})
+		}
 	}
 	klog.Infoln("Conversion completed")
 	return devs
 }
 
-func (p *PowerPlugin) unhealthy(dev *pluginapi.Device) {
-	p.health <- dev
+// deviceID is the ID a device is advertised under to the kubelet, its name without /dev/
+func deviceID(dev string) string {
+	return strings.TrimPrefix(dev, "/dev/")
+}
+
+// scanner returns the configured DeviceScanner, defaulting to the host scanner
+func (p *PowerPlugin) scanner() DeviceScanner {
+	if p.Scanner == nil {
+		return NewDeviceScanner()
+	}
+	return p.Scanner
 }
 
 // no-action needed to configure/load et cetra
@@ -380,13 +483,17 @@ func (p *PowerPlugin) Serve() error {
 	}
 	klog.Infof("Starting to serve on %s", p.socket)
 
-	err = p.Register(pluginapi.KubeletSocket, resource)
+	err = p.Register(p.kubeletSocket(), resource)
 	if err != nil {
 		klog.Errorf("Could not register device plugin: %v", err)
 		p.Stop()
 		return err
 	}
 	klog.Infof("Registered device plugin with Kubelet")
+	p.Reporter.SetReady(true, ReasonPluginRegistered, fmt.Sprintf("registered %s with %d devices", resource, len(p.snapshot().devices)))
+	c := p.controller()
+	go p.Inventory.Run(c.stop)
+	c.serve()
 	return nil
 }
 
@@ -417,34 +524,44 @@ type DeviceScanner interface {
 	StatDevice(path string) error
 }
 
-type realDeviceScanner struct{}
-
-func (r realDeviceScanner) GetBlockDevices() ([]string, error) {
-	return getBlockDevices()
-}
-
-func (r realDeviceScanner) LoadConfig() (*api.DevicePluginConfig, error) {
-	return LoadDevicePluginConfig()
-}
-
-func (r *realDeviceScanner) FindDevices(pattern string) ([]string, error) {
-	return filepath.Glob(pattern)
-}
-
-func (r *realDeviceScanner) StatDevice(path string) error {
-	_, err := os.Stat(path)
-	return err
-}
-
 // scans the local disk using ghw to find the blockdevices
 func ScanRootForDevicesWithDeps(scanner DeviceScanner, nxGzipEnabled bool) ([]string, error) {
-	// relies on GHW_CHROOT=/host/dev
-	// lsblk -f --json --paths -s | jq -r '.blockdevices[] | select(.fstype != "xfs")' | grep mpath | grep -v fstype | sort -u | wc -l
-	// This may be the best way to get the devices.
+	return ScanRootForDevicesContext(context.Background(), scanner, nxGzipEnabled)
+}
+
+// ScanRootForDevicesContext is ScanRootForDevicesWithDeps giving up once ctx is done
+func ScanRootForDevicesContext(ctx context.Context, scanner DeviceScanner, nxGzipEnabled bool) ([]string, error) {
 	config, err := scanner.LoadConfig()
 	if err != nil {
 		klog.Warningf("ScanRootForDevices: failed to load config, proceeding with default behavior: %v", err)
 	}
+	result, err := scanRootForDevices(ctx, scanner, &prober{}, config, nxGzipEnabled)
+	return result.devices, err
+}
+
+// scanResult is what a scan found besides the devices to advertise
+type scanResult struct {
+	devices []string
+	// records are what the discovery backend found out about the block devices, by device name
+	records map[string]BlockDevice
+	// stuck are the devices left out because their probe timed out
+	stuck []string
+	// annotations are set by the discovery hook, by device name
+	annotations map[string]map[string]string
+	// hookErr is why the discovery hook failed, its result was not used then
+	hookErr error
+	// guardErr is why the host system devices are unknown, only allow-system-devices were kept then
+	guardErr error
+	// classes are the device classes of the character devices, by device name
+	classes map[string]string
+}
+
+// scanRootForDevices returns the devices to advertise with config, the default config when it is nil.
+// ctx bounds the steps reading the host, and is checked between the steps.
+func scanRootForDevices(ctx context.Context, scanner DeviceScanner, probes *prober, config *api.DevicePluginConfig, nxGzipEnabled bool) (scanResult, error) {
+	result := scanResult{}
+	// reads the host through the scanner, a HostScanner on HostRoot outside of tests, which discovers
+	// with the backend discovery-backend selects: ghw, sysfs, lsblk or a static list
 	if config == nil {
 		klog.Warning("ScanRootForDevices: config is nil, using default config")
 		config = &api.DevicePluginConfig{
@@ -457,163 +574,112 @@ func ScanRootForDevicesWithDeps(scanner DeviceScanner, nxGzipEnabled bool) ([]st
 
 	// The logic to discover, include and exclude disks dynamically. Steps are indicated with numbers
 	// 1) discover: List all block devices/block disks
-	devices, err := scanner.GetBlockDevices()
+	found, err := runContext(ctx, func() ([]BlockDevice, error) {
+		return discoverDevices(scanner, config)
+	})
 	if err != nil {
-		return nil, err
+		return result, err
 	}
+	devices := DevicePaths(found)
+	result.records = blockDeviceRecords(found)
 
 	if nxGzipEnabled {
 		devices = append(devices, "/dev/crypto/nx-gzip")
 		klog.Infof("nx-gzip enabled: appended /dev/crypto/nx-gzip to devices")
 	}
 
-	// 2) exclude: using configmap exclude devices
-	filtered := ApplyExcludeFilters(devices, config.ExcludeDevices)
-
-	// 3) include: Only include devices that match the include patterns and exist on the host.
-	finalDevices := ApplyIncludeFilters(scanner, filtered, config.IncludeDevices)
-
-	klog.Infof("Final filtered device list: %v", finalDevices)
-	return finalDevices, nil
-}
-
-func getBlockDevices() ([]string, error) {
-	block, err := ghw.Block()
-	if err != nil {
-		fmt.Printf("Error getting block storage info: %v", err)
-		return nil, err
+	// 1a) probe: a device that does not answer, e.g. a dm device with all paths down, is left out of
+	// this scan instead of holding up the others
+	stuck := probes.probeDevices(ctx, scanner, devices, probeTimeout(config))
+	result.stuck = stuck
+	if len(stuck) > 0 {
+		// the scanner may hand out a slice it keeps, so filter into a new one
+		devices = slices.DeleteFunc(slices.Clone(devices), func(dev string) bool { return slices.Contains(stuck, dev) })
 	}
-
-	devices := []string{}
-	fmt.Printf("DEVICE: %v\n", block)
-	for _, disk := range block.Disks {
-		fmt.Printf("    - DISK: %v\n", disk.Name)
-		for _, part := range disk.Partitions {
-			fmt.Printf("        - PART: %v\n", part.Disk.Name)
-			devices = append(devices, "/dev/"+part.Name)
-		}
-		devices = append(devices, "/dev/"+disk.Name)
+	if err := ctx.Err(); err != nil {
+		return result, err
 	}
-	return devices, nil
-}
 
-func ApplyExcludeFilters(devices []string, excludes []string) []string {
-	if excludes == nil {
-		return devices
+	// 2) filter: the ordered device rules decide, the first rule matching /dev/<name>, an alias or the
+	// attributes of a device wins. Only discovered devices are considered, so a denied device cannot come back.
+	rules := NewDeviceRuleSet(EffectiveDeviceRules(config))
+	aliases := deviceAliases(scanner)
+	attrs := withBlockDeviceRecords(deviceAttributes(scanner, devices, rules.NeedsAttributes()), devices, result.records)
+	finalDevices := ApplyDeviceRules(devices, rules, aliases, attrs)
+	if err := ctx.Err(); err != nil {
+		return result, err
 	}
-	filtered := []string{}
-	for _, dev := range devices {
-		if MatchesAny(dev, excludes) {
-			klog.V(4).Infof("Excluding device: %s", dev)
-			continue
+
+	// 2a) hook: an external command may narrow the allowed devices down and annotate them. It runs
+	// before the guard, so it cannot bring back a device the host runs on either.
+	if config.DiscoveryHook != nil {
+		if attrs == nil {
+			attrs = withBlockDeviceRecords(deviceAttributes(scanner, finalDevices, true), finalDevices, result.records)
+		}
+		finalDevices, result.annotations, result.hookErr = ApplyDiscoveryHook(ctx, config.DiscoveryHook, finalDevices, aliases, attrs)
+		if err := ctx.Err(); err != nil {
+			return result, err
 		}
-		filtered = append(filtered, dev)
 	}
-	return filtered
-}
 
-func ApplyIncludeFilters(scanner DeviceScanner, devices []string, includes []string) []string {
-	if includes == nil {
-		return devices
-	}
-	cleaned := []string{}
-	for _, item := range includes {
-		p := strings.TrimSpace(item)
-		if p == "" {
-			klog.Warningf("Include-devices contains an empty string. Dropping entry.")
-			continue
+	// 3) guard: never advertise the devices the host itself runs on
+	if guard, ok := scanner.(SystemDeviceScanner); ok {
+		protected, err := guard.ProtectedDevices()
+		if err != nil {
+			klog.Errorf("Unable to determine host system devices, advertising only allow-system-devices: %v", err)
+			finalDevices = failClosedGuard(finalDevices, config.AllowSystemDevices)
+			result.guardErr = err
+		} else {
+			finalDevices, _ = ApplySystemDeviceGuard(finalDevices, protected, config.AllowSystemDevices)
 		}
-		cleaned = append(cleaned, p)
 	}
 
-	if len(cleaned) == 0 {
-		final := []string{}
-		for _, dev := range devices {
-			final = append(final, strings.TrimPrefix(dev, "/dev/"))
-		}
-		return final
+	// 4) group: a multipath map and its paths are one allocatable unit
+	if maps := multipathMaps(scanner, config.MultipathMode); maps != nil {
+		finalDevices = GroupMultipathDevices(finalDevices, maps)
 	}
 
-	klog.Infof("Include-devices specified, overriding with: %v", cleaned)
-	final := []string{}
-	for _, pattern := range cleaned {
-		matches, err := scanner.FindDevices(pattern)
-		if err != nil {
-			klog.Warningf("Invalid include pattern: %s, skipping. Error: %v", pattern, err)
-			continue
+	// 5) classes: the character devices of the device classes, which are configured one by one, so
+	// the rules, the guard and the hook above do not apply to them
+	classes := discoverClassDevices(scanner, config)
+	for _, dev := range classes.devices {
+		if !containsDevice(finalDevices, deviceID(dev)) {
+			finalDevices = append(finalDevices, dev)
 		}
-		for _, dev := range matches {
-			if err := scanner.StatDevice(dev); err == nil {
-				final = append(final, strings.TrimPrefix(dev, "/dev/"))
-				klog.V(4).Infof("Included device: %s", dev)
-			} else {
-				klog.Warningf("Device does not exist or is inaccessible: %s", dev)
-			}
+	}
+	result.classes = classes.membership
+	for name, annotations := range classes.annotations {
+		if result.annotations == nil {
+			result.annotations = map[string]map[string]string{}
 		}
+		result.annotations[name] = annotations
 	}
-	return final
+
+	klog.Infof("Final filtered device list: %v", finalDevices)
+	result.devices = finalDevices
+	return result, ctx.Err()
 }
 
+// GetAllocateFunc serves requests like Allocate with the grant-all policy, whatever allocation-policy says.
+// devs is not used.
 func (m *PowerPlugin) GetAllocateFunc() func(r *pluginapi.AllocateRequest, devs map[string]pluginapi.Device) (*pluginapi.AllocateResponse, error) {
 	return func(r *pluginapi.AllocateRequest, devs map[string]pluginapi.Device) (*pluginapi.AllocateResponse, error) {
-		devices, err := m.GetDiscoveredDevices()
-		if err != nil {
-			klog.Errorf("Scan root for devices was unsuccessful: %v", err)
-			return nil, err
-		}
-
-		config, err := LoadDevicePluginConfig()
-		if err != nil {
-			klog.Warningf("Failed to load config: %v", err)
-		}
-
-		var responses pluginapi.AllocateResponse
-		for _, req := range r.ContainerRequests {
-
-			klog.V(5).Infof("Container Request: %s", req)
-			response := &pluginapi.ContainerAllocateResponse{}
-
-			// Dev: DevicesIDs and health are ignore. We are granting access to all devices needed.
-
-			// Originally req.DeviceIds
-			for i := range devices {
-				response.Devices = append(response.Devices, &pluginapi.DeviceSpec{
-					HostPath:      "/dev/" + devices[i],
-					ContainerPath: "/dev/" + devices[i],
-					// Per DeviceSpec:
-					// Cgroups permissions of the device, candidates are one or more of
-					// * r - allows container to read from the specified device.
-					// * w - allows container to write to the specified device.
-					// * m - allows container to create device files that do not yet exist.
-					// We don't need `m`
-					Permissions: GetValidatedPermission(config),
-				})
-			}
-
-			responses.ContainerResponses = append(responses.ContainerResponses, response)
-		}
-
-		klog.Infof("Get Allocate response: %v", &responses)
-		return &responses, nil
+		return m.allocate(r, GrantAllPolicy{})
 	}
 }
 
-// monitoring socket health function
-func (p *PowerPlugin) MonitorSocketHealth() {
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		for _, path := range []string{pluginapi.KubeletSocket, p.socket} {
-			if _, err := os.Stat(path); os.IsNotExist(err) {
-				klog.Warningf("Healthcheck: socket deleted (%s), triggering plugin restart", path)
-				p.restart <- struct{}{}
-				return
-			} else if err != nil {
-				klog.Errorf("Healthcheck: error checking %s: %v", path, err)
-			}
+// socketsPresent reports whether the kubelet and plugin sockets still exist. Both are gone after a
+// kubelet restart, which the plugin answers by stopping so it is restarted and registers again.
+func (p *PowerPlugin) socketsPresent() bool {
+	for _, path := range []string{p.kubeletSocket(), p.socket} {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			klog.Warningf("Healthcheck: socket deleted (%s), triggering plugin restart", path)
+			return false
+		} else if err != nil {
+			klog.Errorf("Healthcheck: error checking %s: %v", path, err)
 		}
 	}
+	return true
 }
 
 // Read config map file
@@ -657,19 +723,14 @@ func GetValidatedPermission(config *api.DevicePluginConfig) string {
 		return "rwm"
 	}
 
-	perm := strings.ToLower(config.Permissions)
-	valid := map[string]bool{
-		"r": true, "w": true, "m": true,
-		"rw": true, "rm": true, "wm": true, "rwm": true,
-	}
-
-	if valid[perm] {
+	perm, err := ValidatePermissions(config.Permissions)
+	if err == nil {
 		klog.Infof("Using validated device permission: '%s'", perm)
 		return perm
 	}
 
-	if perm != "" {
-		klog.Warningf("Invalid device permission '%s' in config, using default 'rw'", perm)
+	if config.Permissions != "" {
+		klog.Warningf("Invalid device permission '%s' in config, using default 'rw': %v", config.Permissions, err)
 	} else {
 		klog.Infof("No permission set in config, using default 'rw'")
 	}
@@ -678,7 +739,7 @@ func GetValidatedPermission(config *api.DevicePluginConfig) string {
 
 func MatchesAny(dev string, patterns []string) bool {
 	for _, pattern := range patterns {
-		matched, err := filepath.Match(pattern, dev)
+		matched, err := MatchPattern(pattern, dev)
 		if err != nil {
 			klog.Warningf("Invalid pattern: %s. Skipping...", pattern)
 			continue
@@ -691,31 +752,42 @@ func MatchesAny(dev string, patterns []string) bool {
 }
 
 func (p *PowerPlugin) GetDiscoveredDevices() ([]string, error) {
+	return p.GetDiscoveredDevicesContext(context.Background())
+}
+
+// GetDiscoveredDevicesContext is GetDiscoveredDevices giving up once ctx is done
+func (p *PowerPlugin) GetDiscoveredDevicesContext(ctx context.Context) ([]string, error) {
+	found, err := p.discover(ctx)
+	return found.devices, err
+}
+
+// discover loads the config and finds the devices with it, scanning as its discovery strategy says
+func (p *PowerPlugin) discover(ctx context.Context) (discovery, error) {
 	klog.Info("GetDiscoveredDevices: starting device discovery")
 
+	scanner := p.scanner()
+	config := p.loadConfig(scanner)
+
 	// Determine strategy
 	strategy := "default"
-	if p.Config != nil && p.Config.DiscoveryStrategy != "" {
-		strategy = p.Config.DiscoveryStrategy
+	if config != nil && config.DiscoveryStrategy != "" {
+		strategy = config.DiscoveryStrategy
 		klog.Infof("Discovery strategy set to: %s", strategy)
 	} else {
 		klog.Info("No discovery strategy specified, using default")
 	}
 
 	nxGzip := false
-	if p.Config != nil {
-		nxGzip = p.Config.NxGzip
+	if config != nil {
+		nxGzip = config.NxGzip
 	}
 	klog.Infof("nxGzip enabled: %v", nxGzip)
 
-	scanner := p.Scanner
-	if scanner == nil {
-		scanner = &realDeviceScanner{}
-	}
-
 	if strategy == "time" {
+		// the cache is locked to read and to store it, never during the scan
 		p.Cache.Mutex.Lock()
-		defer p.Cache.Mutex.Unlock()
+		cached, records, classes, lastScanTime := p.Cache.Devices, p.Cache.records, p.Cache.classes, p.Cache.LastScanTime
+		p.Cache.Mutex.Unlock()
 
 		now := time.Now().UTC()
 		klog.Infof("Current time: %v", now)
@@ -723,10 +795,10 @@ func (p *PowerPlugin) GetDiscoveredDevices() ([]string, error) {
 		interval := 60 * time.Minute // fallback default
 		klog.Infof("Default interval is: %v", interval)
 
-		if p.Config != nil && p.Config.ScanInterval != "" {
-			parsedInterval, err := time.ParseDuration(p.Config.ScanInterval)
+		if config != nil && config.ScanInterval != "" {
+			parsedInterval, err := time.ParseDuration(config.ScanInterval)
 			if err != nil {
-				klog.Warningf("Invalid scan-interval '%s': %v. Using default interval: %v", p.Config.ScanInterval, err, interval)
+				klog.Warningf("Invalid scan-interval '%s': %v. Using default interval: %v", config.ScanInterval, err, interval)
 			} else {
 				interval = parsedInterval
 				klog.Infof("Parsed scan-interval successfully: %v", interval)
@@ -736,47 +808,238 @@ func (p *PowerPlugin) GetDiscoveredDevices() ([]string, error) {
 		}
 
 		var timeSinceLastScan time.Duration
-		if !p.Cache.LastScanTime.IsZero() {
-			timeSinceLastScan = now.Sub(p.Cache.LastScanTime)
-			klog.Infof("Time since last scan: %v (Last scan at: %v UTC)", timeSinceLastScan, p.Cache.LastScanTime.UTC())
+		if !lastScanTime.IsZero() {
+			timeSinceLastScan = now.Sub(lastScanTime)
+			klog.Infof("Time since last scan: %v (Last scan at: %v UTC)", timeSinceLastScan, lastScanTime.UTC())
 		} else {
 			klog.Infof("No previous scan found. Starting first device scan.")
 		}
 
-		klog.Infof("Cached devices count: %d", len(p.Cache.Devices))
+		klog.Infof("Cached devices count: %d", len(cached))
 		klog.Infof("Configured scan interval: %v", interval)
 
-		if len(p.Cache.Devices) > 0 && timeSinceLastScan < interval {
-			klog.Infof("Skipping rescan. Using cached devices. Next scan after: %v", p.Cache.LastScanTime.Add(interval))
-			return p.Cache.Devices, nil
+		if len(cached) > 0 && timeSinceLastScan < interval {
+			klog.Infof("Skipping rescan. Using cached devices. Next scan after: %v", lastScanTime.Add(interval))
+			return discovered(scanner, config, cached, records, classes), nil
 		}
 
 		klog.Infof("Triggering fresh scan now (reason: interval passed or cache empty).")
 		klog.Infof("scanner: %v", scanner)
-		devices, err := ScanRootForDevicesWithDeps(scanner, nxGzip)
+		found, err := p.scanDevices(ctx, scanner, config, nxGzip)
 		if err != nil {
 			klog.Errorf("Scan failed: %v", err)
-			if len(p.Cache.Devices) > 0 {
+			if len(cached) > 0 {
 				klog.Warning("Falling back to cached devices due to scan failure.")
-				return p.Cache.Devices, nil
+				return discovered(scanner, config, cached, records, classes), nil
 			}
 			klog.Error("No cached devices available, returning error.")
-			return nil, err
+			return discovery{}, err
 		}
 
-		klog.Infof("Scan successful. Found %d devices.", len(devices))
-		p.Cache.Devices = devices
+		klog.Infof("Scan successful. Found %d devices.", len(found.devices))
+		p.Cache.Mutex.Lock()
+		p.Cache.Devices = found.devices
+		p.Cache.records = found.records
+		p.Cache.classes = found.classes
 		p.Cache.LastScanTime = now
+		p.Cache.Mutex.Unlock()
+		p.observeScan(found)
 		klog.Infof("Devices cached. Next scan will occur after: %v", now.Add(interval))
-		return devices, nil
+		return found, nil
 	}
 
 	klog.Infof("Discovery strategy is '%s'. Performing fresh scan every call.", strategy)
-	devices, err := ScanRootForDevicesWithDeps(scanner, nxGzip)
+	found, err := p.scanDevices(ctx, scanner, config, nxGzip)
 	if err != nil {
 		klog.Errorf("Scan failed during default strategy: %v", err)
-		return nil, err
+		return discovery{}, err
+	}
+	klog.Infof("Scan completed with %d devices found.", len(found.devices))
+	p.observeScan(found)
+	return found, nil
+}
+
+// loadConfig loads the config a scan runs with. A config that fails to load is reported, and the
+// running config is kept then.
+func (p *PowerPlugin) loadConfig(scanner DeviceScanner) *api.DevicePluginConfig {
+	config, err := scanner.LoadConfig()
+	if err != nil {
+		klog.Warningf("Failed to load config file: %v", err)
+		p.reportConfigError(err)
+	}
+	if config == nil {
+		return p.config()
+	}
+	return config
+}
+
+// scanDevices scans with scanner and reports the devices whose probe timed out and the outcome of
+// the discovery hook
+func (p *PowerPlugin) scanDevices(ctx context.Context, scanner DeviceScanner, config *api.DevicePluginConfig, nxGzip bool) (discovery, error) {
+	result, err := scanRootForDevices(ctx, scanner, &p.probes, config, nxGzip)
+	p.observeProbeTimeouts(result.stuck)
+	if result.hookErr != nil {
+		p.Reporter.Event(corev1.EventTypeWarning, ReasonDiscoveryHookFailed, "Discovery hook failed, advertising the devices the rules allowed: %v", result.hookErr)
+	}
+	if result.guardErr != nil {
+		p.Reporter.Event(corev1.EventTypeWarning, ReasonSystemDevicesUnknown, "Unable to determine host system devices, advertising only allow-system-devices: %v", result.guardErr)
+	}
+	if err == nil {
+		p.Inventory.ObserveAnnotations(result.annotations)
+		p.Inventory.ObserveClasses(result.classes)
+	}
+	if err != nil {
+		return discovery{}, err
+	}
+	return discovered(scanner, config, result.devices, result.records, result.classes), nil
+}
+
+// Rescan discovers the devices and publishes them to ListAndWatch. Calls made while a scan is in
+// flight wait for it and share its result instead of scanning again. A caller waits at most the
+// scan timeout: it then gets the last devices while the scan continues and publishes its result when
+// it finishes, or an error when nothing was discovered yet.
+func (p *PowerPlugin) Rescan() ([]string, error) {
+	call := p.startScan()
+	timeout := scanTimeout(p.config())
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-call.done:
+		return call.devices, call.err
+	case <-timer.C:
+	}
+
+	state := p.snapshot()
+	p.observeScanTimeout(call, timeout, state)
+	if !state.scanned {
+		return nil, fmt.Errorf("device scan did not finish within %v", timeout)
+	}
+	return append([]string{}, state.devices...), nil
+}
+
+// startScan returns the scan in flight, starting one when there is none
+func (p *PowerPlugin) startScan() *scanCall {
+	p.scanLock.Lock()
+	defer p.scanLock.Unlock()
+	if p.scanning == nil {
+		p.scanning = &scanCall{done: make(chan struct{})}
+		go p.scan(p.scanning)
+	}
+	return p.scanning
+}
+
+// scan runs call until it finishes or the plugin stops, and publishes the devices it found
+func (p *PowerPlugin) scan(call *scanCall) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := p.controller().stop
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	start := time.Now()
+	found, err := p.discover(ctx)
+	call.devices, call.err = found.devices, err
+	if err == nil {
+		p.setDevices(found)
+		p.configureAudit(found.config)
+	}
+	if call.timedOut.Load() {
+		klog.Warningf("Slow device scan finished after %v: %d devices, error: %v", time.Since(start), len(call.devices), call.err)
+	}
+
+	p.scanLock.Lock()
+	p.scanning = nil
+	p.scanLock.Unlock()
+	close(call.done)
+}
+
+// observeScan publishes the result of a fresh scan to the NFD feature file, events and inventory
+func (p *PowerPlugin) observeScan(found discovery) {
+	p.exportNodeFeatures(found)
+	p.Reporter.ObserveDevices(found.devices)
+	p.Inventory.ObserveScan(found.devices, time.Now().UTC())
+	_, reserved := ReservedDevices(found.devices, reservedCount(found.config), found.classes)
+	p.Inventory.ObserveReserved(reserved)
+}
+
+// reportConfigError records a config load failure, a missing config file is expected and not reported
+func (p *PowerPlugin) reportConfigError(err error) {
+	if os.IsNotExist(err) {
+		return
+	}
+	p.Reporter.Event(corev1.EventTypeWarning, ReasonConfigLoadFailed, "Failed to load %s: %v", configPath, err)
+}
+
+// run is the controller, the one goroutine owning the plugin state: it applies every update until the
+// plugin stops. Once the plugin serves it also checks the sockets, stopping the plugin when one is
+// gone, keeps the inventory Allocate serves from current and publishes device health. Rescans and
+// health checks update the state, so they run beside the controller, one at a time.
+func (p *PowerPlugin) run(c *controller) {
+	var tickers []*time.Ticker
+	var sockets, rescan, health <-chan time.Time
+	var rescanning, checking, refreshing atomic.Bool
+	stopTickers := func() {
+		for _, t := range tickers {
+			t.Stop()
+		}
+		tickers, sockets, rescan, health = nil, nil, nil, nil
+	}
+
+	for {
+		select {
+		case <-c.stop:
+			stopTickers()
+			return
+		case u := <-c.updates:
+			u.done <- p.apply(u.fn)
+		case <-c.serving:
+			stopTickers()
+			tickers = []*time.Ticker{
+				time.NewTicker(orDefault(p.SocketHealthInterval, socketHealthInterval)),
+				time.NewTicker(orDefault(p.RescanInterval, rescanInterval)),
+				time.NewTicker(healthCheckInterval),
+			}
+			sockets, rescan, health = tickers[0].C, tickers[1].C, tickers[2].C
+			// the containers allocated before the plugin started still hold their devices
+			background(&refreshing, p.RefreshUsage)
+		case <-sockets:
+			if !p.socketsPresent() {
+				// Stop waits for the requests in flight, which wait for the controller
+				go p.Stop()
+			}
+		case <-rescan:
+			background(&rescanning, func() {
+				if _, err := p.Rescan(); err != nil {
+					klog.Errorf("Background rescan failed, keeping %d devices: %v", len(p.snapshot().devices), err)
+				}
+				p.RefreshUsage()
+			})
+		case <-health:
+			background(&checking, p.CheckDeviceHealth)
+		}
+	}
+}
+
+// background runs task in its own goroutine unless the previous run is still going
+func background(running *atomic.Bool, task func()) {
+	if !running.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer running.Store(false)
+		task()
+	}()
+}
+
+// orDefault returns interval, or fallback when it is not set
+func orDefault(interval, fallback time.Duration) time.Duration {
+	if interval <= 0 {
+		return fallback
 	}
-	klog.Infof("Scan completed with %d devices found.", len(devices))
-	return devices, nil
+	return interval
 }
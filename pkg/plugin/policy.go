@@ -0,0 +1,239 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ocp-power-demos/power-dev-plugin/api"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog"
+)
+
+const (
+	PolicyGrantAll         = "grant-all"
+	PolicyRequestedIDs     = "requested-ids"
+	PolicyUpperLimitShared = "upper-limit-shared"
+	PolicyExclusive        = "exclusive"
+
+	DefaultAllocationPolicy = PolicyGrantAll
+)
+
+// AllocationRequest is what a policy decides on for one container
+type AllocationRequest struct {
+	ContainerIndex int
+	// RequestedIDs are the IDs the kubelet picked, device names or replica IDs
+	RequestedIDs []string
+	// Devices are the devices that can be allocated, the reserved devices are already left out
+	Devices  []string
+	Reserved []string
+	// Usage counts the containers holding each device by /dev path, including the containers of the
+	// same request served before this one. It must not be changed.
+	Usage map[string]int
+	// Limit is the upper limit of a device, Unlimited when it has none
+	Limit func(dev string) int
+}
+
+// AllocationDecision is the outcome of a policy for one container
+type AllocationDecision struct {
+	// Devices are granted to the container, Allocate counts them in the usage
+	Devices []string
+	// LimitSkipped are the /dev paths of devices passed over because of their upper limit
+	LimitSkipped []string
+}
+
+// AllocationPolicy picks the devices of each container. Allocate resolves permissions and container paths
+// of the devices it picks and rolls the whole request back when it rejects a container. A rejection
+// should be a gRPC status, ResourceExhausted when the container does not fit.
+type AllocationPolicy interface {
+	Name() string
+	Select(req AllocationRequest) (AllocationDecision, error)
+}
+
+var (
+	policyLock sync.RWMutex
+	policies   = map[string]AllocationPolicy{}
+)
+
+func init() {
+	for _, policy := range []AllocationPolicy{GrantAllPolicy{}, RequestedIDsPolicy{}, UpperLimitSharedPolicy{}, ExclusivePolicy{}} {
+		RegisterAllocationPolicy(policy)
+	}
+}
+
+// RegisterAllocationPolicy makes a policy selectable by its name in allocation-policy, replacing any
+// policy of the same name
+func RegisterAllocationPolicy(policy AllocationPolicy) {
+	policyLock.Lock()
+	defer policyLock.Unlock()
+	policies[policy.Name()] = policy
+}
+
+// AllocationPolicyNames lists the registered policies
+func AllocationPolicyNames() []string {
+	policyLock.RLock()
+	defer policyLock.RUnlock()
+	names := []string{}
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupAllocationPolicy returns the policy named by allocation-policy, the default when it is empty or unknown
+func LookupAllocationPolicy(config *api.DevicePluginConfig) AllocationPolicy {
+	name := DefaultAllocationPolicy
+	if config != nil && config.AllocationPolicy != "" {
+		name = config.AllocationPolicy
+	}
+	policyLock.RLock()
+	policy, ok := policies[name]
+	fallback := policies[DefaultAllocationPolicy]
+	policyLock.RUnlock()
+	if ok {
+		return policy
+	}
+	klog.Warningf("Unknown allocation-policy %q, using %s. Known policies: %s", name, DefaultAllocationPolicy, strings.Join(AllocationPolicyNames(), ", "))
+	return fallback
+}
+
+// devicePath is the /dev path usage is counted under
+func devicePath(dev string) string {
+	if strings.HasPrefix(dev, "/dev/") {
+		return dev
+	}
+	return "/dev/" + dev
+}
+
+// belowLimit splits devices into those below their upper limit and the "/dev/sda (1/1)" descriptions of the others
+func belowLimit(req AllocationRequest, devices []string) ([]string, []string, []string) {
+	below, skipped, described := []string{}, []string{}, []string{}
+	for _, dev := range devices {
+		path := devicePath(dev)
+		count, limit := req.Usage[path], req.Limit(dev)
+		klog.Infof("Evaluating device %s: current usage=%d, limit=%s", dev, count, describeLimit(limit))
+		if count < limit {
+			below = append(below, dev)
+			continue
+		}
+		klog.Infof("Device %s reached its upper limit of %d; marking skipped", dev, limit)
+		skipped = append(skipped, path)
+		described = append(described, fmt.Sprintf("%s (%d/%d)", path, count, limit))
+	}
+	return below, skipped, described
+}
+
+// requestedDevices resolves the requested IDs and rejects a container that asked for nothing or for a
+// device the node reserved since it was advertised
+func requestedDevices(req AllocationRequest) ([]string, error) {
+	requested, err := resolveRequestedDevices(req.RequestedIDs, append(append([]string{}, req.Devices...), req.Reserved...))
+	if err != nil {
+		return nil, err
+	}
+	if len(requested) == 0 {
+		return nil, noDevicesError(req)
+	}
+	for _, dev := range requested {
+		for _, reserved := range req.Reserved {
+			if dev == reserved {
+				return nil, status.Errorf(codes.ResourceExhausted, "device %s requested for container %d is reserved for the node", devicePath(dev), req.ContainerIndex)
+			}
+		}
+	}
+	return requested, nil
+}
+
+func noDevicesError(req AllocationRequest) error {
+	return status.Errorf(codes.ResourceExhausted, "not enough available devices to satisfy request for container %d: %d devices available, %d reserved for the node",
+		req.ContainerIndex, len(req.Devices), len(req.Reserved))
+}
+
+// GrantAllPolicy hands every device below its upper limit to each container, whatever IDs the kubelet
+// picked. This is how Allocate worked before requested IDs were honored.
+type GrantAllPolicy struct{}
+
+func (GrantAllPolicy) Name() string { return PolicyGrantAll }
+
+func (GrantAllPolicy) Select(req AllocationRequest) (AllocationDecision, error) {
+	below, skipped, described := belowLimit(req, req.Devices)
+	decision := AllocationDecision{Devices: below, LimitSkipped: skipped}
+	if len(below) > 0 {
+		return decision, nil
+	}
+	if len(skipped) > 0 {
+		return decision, status.Errorf(codes.ResourceExhausted, "upper limit reached for all %d devices for container %d (usage/limit): %s",
+			len(skipped), req.ContainerIndex, strings.Join(described, ", "))
+	}
+	return decision, noDevicesError(req)
+}
+
+// RequestedIDsPolicy grants exactly the requested devices, leaving the accounting to the kubelet
+type RequestedIDsPolicy struct{}
+
+func (RequestedIDsPolicy) Name() string { return PolicyRequestedIDs }
+
+func (RequestedIDsPolicy) Select(req AllocationRequest) (AllocationDecision, error) {
+	requested, err := requestedDevices(req)
+	return AllocationDecision{Devices: requested}, err
+}
+
+// UpperLimitSharedPolicy grants the requested devices as long as each is below its upper limit, so a
+// device is shared by up to upper-limit containers. A container is rejected when one of its devices is full.
+type UpperLimitSharedPolicy struct{}
+
+func (UpperLimitSharedPolicy) Name() string { return PolicyUpperLimitShared }
+
+func (UpperLimitSharedPolicy) Select(req AllocationRequest) (AllocationDecision, error) {
+	requested, err := requestedDevices(req)
+	if err != nil {
+		return AllocationDecision{}, err
+	}
+	below, skipped, described := belowLimit(req, requested)
+	if len(skipped) > 0 {
+		return AllocationDecision{LimitSkipped: skipped}, status.Errorf(codes.ResourceExhausted, "upper limit reached for %d of %d requested devices for container %d (usage/limit): %s",
+			len(skipped), len(requested), req.ContainerIndex, strings.Join(described, ", "))
+	}
+	return AllocationDecision{Devices: below}, nil
+}
+
+// ExclusivePolicy grants the requested devices only while no other container holds them, whatever the upper limits
+type ExclusivePolicy struct{}
+
+func (ExclusivePolicy) Name() string { return PolicyExclusive }
+
+func (ExclusivePolicy) Select(req AllocationRequest) (AllocationDecision, error) {
+	requested, err := requestedDevices(req)
+	if err != nil {
+		return AllocationDecision{}, err
+	}
+	inUse := []string{}
+	for _, dev := range requested {
+		if req.Usage[devicePath(dev)] > 0 {
+			inUse = append(inUse, devicePath(dev))
+		}
+	}
+	if len(inUse) > 0 {
+		return AllocationDecision{LimitSkipped: inUse}, status.Errorf(codes.ResourceExhausted, "devices already held by another container, container %d needs them exclusively: %s",
+			req.ContainerIndex, strings.Join(inUse, ", "))
+	}
+	return AllocationDecision{Devices: requested}, nil
+}
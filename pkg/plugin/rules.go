@@ -0,0 +1,223 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ocp-power-demos/power-dev-plugin/api"
+	"k8s.io/klog"
+)
+
+const (
+	RuleActionAllow = "allow"
+	RuleActionDeny  = "deny"
+)
+
+// EffectiveDeviceRules returns device-rules, or the legacy include/exclude fields translated into rules
+func EffectiveDeviceRules(config *api.DevicePluginConfig) []api.DeviceRule {
+	if len(config.DeviceRules) == 0 {
+		return LegacyDeviceRules(config)
+	}
+	if len(config.IncludeDevices) > 0 || len(config.ExcludeDevices) > 0 || len(config.IncludeSelectors) > 0 || len(config.ExcludeSelectors) > 0 {
+		klog.Warning("device-rules is set, ignoring include-devices, exclude-devices, include-selectors and exclude-selectors")
+	}
+	return config.DeviceRules
+}
+
+// LegacyDeviceRules translates the include/exclude fields: every exclude is a deny rule ahead of the
+// include allow rules, so an exclude always wins. Empty patterns are dropped.
+func LegacyDeviceRules(config *api.DevicePluginConfig) []api.DeviceRule {
+	rules := []api.DeviceRule{}
+	for i := range config.ExcludeSelectors {
+		rules = append(rules, api.DeviceRule{Comment: "exclude-selectors", Action: RuleActionDeny, Selector: &config.ExcludeSelectors[i]})
+	}
+	for _, pattern := range config.ExcludeDevices {
+		if p := strings.TrimSpace(pattern); p != "" {
+			rules = append(rules, api.DeviceRule{Comment: "exclude-devices", Action: RuleActionDeny, Glob: p})
+		}
+	}
+	for _, pattern := range config.IncludeDevices {
+		p := strings.TrimSpace(pattern)
+		if p == "" {
+			klog.Warningf("Include-devices contains an empty string. Dropping entry.")
+			continue
+		}
+		rules = append(rules, api.DeviceRule{Comment: "include-devices", Action: RuleActionAllow, Glob: p})
+	}
+	for i := range config.IncludeSelectors {
+		rules = append(rules, api.DeviceRule{Comment: "include-selectors", Action: RuleActionAllow, Selector: &config.IncludeSelectors[i]})
+	}
+	return rules
+}
+
+// deviceMatcher is the validated glob, regex and selector of a rule
+type deviceMatcher struct {
+	glob     string
+	regex    *regexp.Regexp
+	selector *api.DeviceSelector
+	// members are the /dev paths of the devices of a device class, nil unless it matches on membership
+	members map[string]bool
+}
+
+func compileDeviceMatcher(glob, regex string, selector *api.DeviceSelector) (deviceMatcher, error) {
+	matcher := deviceMatcher{glob: glob, selector: selector}
+	if glob != "" {
+		if _, err := MatchPattern(glob, ""); err != nil {
+			return matcher, fmt.Errorf("invalid glob %q: %w", glob, err)
+		}
+	}
+	if regex != "" {
+		compiled, err := regexp.Compile("^(?:" + regex + ")$")
+		if err != nil {
+			return matcher, fmt.Errorf("invalid regex %q: %w", regex, err)
+		}
+		matcher.regex = compiled
+	}
+	return matcher, nil
+}
+
+// matches reports whether every matcher that is set matches one of the device names or its attributes
+func (m *deviceMatcher) matches(names []string, attrs *DeviceAttributes) bool {
+	if m.glob != "" && !MatchesAnyName(names, []string{m.glob}) {
+		return false
+	}
+	if m.regex != nil && !matchesAnyRegex(m.regex, names) {
+		return false
+	}
+	if m.selector != nil && !MatchesSelector(attrs, *m.selector) {
+		return false
+	}
+	if m.members != nil && !slices.ContainsFunc(names, func(name string) bool { return m.members[name] }) {
+		return false
+	}
+	return true
+}
+
+func matchesAnyRegex(regex *regexp.Regexp, names []string) bool {
+	for _, name := range names {
+		if regex.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// deviceRule is a validated rule
+type deviceRule struct {
+	deviceMatcher
+	action  string
+	comment string
+	index   int
+}
+
+// DeviceRuleSet is an ordered list of validated device rules
+type DeviceRuleSet struct {
+	rules []deviceRule
+	// defaultAction applies to devices no rule matches: deny once there is an allow rule, like include-devices
+	defaultAction string
+}
+
+// NewDeviceRuleSet validates the rules, invalid rules are logged and skipped
+func NewDeviceRuleSet(rules []api.DeviceRule) *DeviceRuleSet {
+	set := &DeviceRuleSet{defaultAction: RuleActionAllow}
+	for i, rule := range rules {
+		compiled, err := compileDeviceRule(i, rule)
+		if err != nil {
+			klog.Warningf("Invalid device rule %d (%s): %v. Skipping...", i, rule.Comment, err)
+			continue
+		}
+		if compiled.action == RuleActionAllow {
+			set.defaultAction = RuleActionDeny
+		}
+		set.rules = append(set.rules, compiled)
+	}
+	return set
+}
+
+func compileDeviceRule(index int, rule api.DeviceRule) (deviceRule, error) {
+	action := strings.ToLower(strings.TrimSpace(rule.Action))
+	if action != RuleActionAllow && action != RuleActionDeny {
+		return deviceRule{}, fmt.Errorf("action must be %q or %q, got %q", RuleActionAllow, RuleActionDeny, rule.Action)
+	}
+	matcher, err := compileDeviceMatcher(rule.Glob, rule.Regex, rule.Selector)
+	if err != nil {
+		return deviceRule{}, err
+	}
+	return deviceRule{deviceMatcher: matcher, action: action, comment: rule.Comment, index: index}, nil
+}
+
+// NeedsAttributes reports whether any rule matches on device attributes
+func (s *DeviceRuleSet) NeedsAttributes() bool {
+	for _, rule := range s.rules {
+		if rule.selector != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAllowRules reports whether devices are only advertised when a rule allows them
+func (s *DeviceRuleSet) HasAllowRules() bool {
+	return s.defaultAction == RuleActionDeny
+}
+
+// Decide returns the action for a device and the index of the rule that decided, -1 for the default action
+func (s *DeviceRuleSet) Decide(dev string, aliases DeviceAliases, attrs *DeviceAttributes) (string, int) {
+	names := aliases.Names(dev)
+	for _, rule := range s.rules {
+		if rule.matches(names, attrs) {
+			return rule.action, rule.index
+		}
+	}
+	return s.defaultAction, -1
+}
+
+// ApplyDeviceRules keeps the devices the rules allow. Like include-devices, allowed devices are returned
+// without /dev/ when the rules contain an allow rule.
+func ApplyDeviceRules(devices []string, rules *DeviceRuleSet, aliases DeviceAliases, attrs map[string]*DeviceAttributes) []string {
+	allowed := []string{}
+	for _, dev := range devices {
+		name := strings.TrimPrefix(dev, "/dev/")
+		action, index := rules.Decide(dev, aliases, attrs[name])
+		if action != RuleActionAllow {
+			klog.V(4).Infof("Excluding device %s by %s", dev, describeRule(rules, index))
+			continue
+		}
+		klog.V(4).Infof("Included device %s by %s", dev, describeRule(rules, index))
+		if rules.HasAllowRules() {
+			dev = name
+		}
+		allowed = append(allowed, dev)
+	}
+	return allowed
+}
+
+func describeRule(rules *DeviceRuleSet, index int) string {
+	if index < 0 {
+		return "the default action"
+	}
+	for _, rule := range rules.rules {
+		if rule.index == index && rule.comment != "" {
+			return fmt.Sprintf("rule %d (%s)", index, rule.comment)
+		}
+	}
+	return fmt.Sprintf("rule %d", index)
+}
@@ -0,0 +1,301 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/klog"
+)
+
+// hostProcRoot is /proc of the host's PID 1, the DaemonSet runs with hostPID so this is the host mount namespace
+const hostProcRoot = "/proc/1"
+
+// SystemDeviceGuard finds the block devices the host itself depends on: devices backing mounted
+// filesystems or swap, the logical volumes of active volume groups and active md arrays, and
+// everything they are built from (LVM PVs, md members, multipath paths) or share a disk with
+// (partitions and holders).
+type SystemDeviceGuard struct {
+	SysRoot  string
+	ProcRoot string
+}
+
+// NewSystemDeviceGuard creates a guard reading the sysfs and PID 1 mounts of the host under HostRoot
+func NewSystemDeviceGuard() *SystemDeviceGuard {
+	h := NewHostScanner(HostRoot())
+	return &SystemDeviceGuard{SysRoot: h.Path("/sys"), ProcRoot: h.ProcRoot}
+}
+
+// SystemDeviceScanner is implemented by scanners that can identify host system devices.
+// Scanners without it are not guarded.
+type SystemDeviceScanner interface {
+	ProtectedDevices() (map[string]string, error)
+}
+
+// blockTopology is the relationship between block devices, keyed by kernel name (sda, sda1, dm-0)
+type blockTopology struct {
+	byDevNumber map[string]string // "8:1" -> sda1
+	byMapper    map[string]string // rhel-root -> dm-0
+	parent      map[string]string // sda1 -> sda
+	partitions  map[string][]string
+	slaves      map[string][]string
+	holders     map[string][]string
+	volumes     map[string]string // dm-2 -> why the host uses it even when nothing is mounted
+}
+
+func readBlockTopology(sysRoot string) (*blockTopology, error) {
+	blockDir := filepath.Join(sysRoot, "block")
+	entries, err := os.ReadDir(blockDir)
+	if err != nil {
+		return nil, err
+	}
+	t := &blockTopology{
+		byDevNumber: map[string]string{},
+		byMapper:    map[string]string{},
+		parent:      map[string]string{},
+		partitions:  map[string][]string{},
+		slaves:      map[string][]string{},
+		holders:     map[string][]string{},
+		volumes:     map[string]string{},
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		dir := filepath.Join(blockDir, name)
+		if dev := readSysfsString(filepath.Join(dir, "dev")); dev != "" {
+			t.byDevNumber[dev] = name
+		}
+		if mapper := readSysfsString(filepath.Join(dir, "dm", "name")); mapper != "" {
+			t.byMapper[mapper] = name
+		}
+		if reason := activeVolume(dir); reason != "" {
+			t.volumes[name] = reason
+		}
+		t.slaves[name] = readSysfsDir(filepath.Join(dir, "slaves"))
+		t.holders[name] = readSysfsDir(filepath.Join(dir, "holders"))
+
+		// partitions are subdirectories carrying a "partition" file
+		for _, sub := range readSysfsDir(dir) {
+			if _, err := os.Stat(filepath.Join(dir, sub, "partition")); err != nil {
+				continue
+			}
+			t.parent[sub] = name
+			t.partitions[name] = append(t.partitions[name], sub)
+			if dev := readSysfsString(filepath.Join(dir, sub, "dev")); dev != "" {
+				t.byDevNumber[dev] = sub
+			}
+			t.holders[sub] = readSysfsDir(filepath.Join(dir, sub, "holders"))
+		}
+	}
+	return t, nil
+}
+
+// activeVolume tells why the block device in dir is part of the host storage stack on its own:
+// a logical volume of an active volume group or an active md array, empty otherwise
+func activeVolume(dir string) string {
+	if strings.HasPrefix(readSysfsString(filepath.Join(dir, "dm", "uuid")), "LVM-") {
+		return "logical volume of an active volume group"
+	}
+	if _, err := os.Stat(filepath.Join(dir, "md")); err == nil {
+		switch readSysfsString(filepath.Join(dir, "md", "array_state")) {
+		case "inactive", "clear":
+		default:
+			return "active md array"
+		}
+	}
+	return ""
+}
+
+// resolve maps a /dev path (or /dev/mapper alias) to a kernel name, empty when unknown
+func (t *blockTopology) resolve(path string) string {
+	if !strings.HasPrefix(path, "/dev/") {
+		return ""
+	}
+	if strings.HasPrefix(path, "/dev/mapper/") {
+		return t.byMapper[strings.TrimPrefix(path, "/dev/mapper/")]
+	}
+	return filepath.Base(path)
+}
+
+// ProtectedDevices returns the kernel names of the host system devices with the reason they are protected
+func (g *SystemDeviceGuard) ProtectedDevices() (map[string]string, error) {
+	topology, err := readBlockTopology(g.SysRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	protected := map[string]string{}
+	queue := []string{}
+	protect := func(name, reason string) {
+		if name == "" {
+			return
+		}
+		if _, ok := protected[name]; ok {
+			return
+		}
+		protected[name] = reason
+		queue = append(queue, name)
+	}
+
+	mounts, err := readMountedDevices(filepath.Join(g.ProcRoot, "mountinfo"), topology)
+	if err != nil {
+		return nil, err
+	}
+	for name, mountPoint := range mounts {
+		protect(name, "mounted at "+mountPoint)
+	}
+
+	swaps, err := readSwapDevices(filepath.Join(g.ProcRoot, "swaps"), topology)
+	if err != nil {
+		klog.Warningf("Unable to read swap devices: %v", err)
+	}
+	for _, name := range swaps {
+		protect(name, "swap")
+	}
+
+	// volume groups and md arrays are the host's even when nothing on them is mounted
+	volumes := make([]string, 0, len(topology.volumes))
+	for name := range topology.volumes {
+		volumes = append(volumes, name)
+	}
+	sort.Strings(volumes)
+	for _, name := range volumes {
+		protect(name, topology.volumes[name])
+	}
+
+	// the closure: whatever a protected device is built from, its disk, and everything else on the same disks
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		reason := fmt.Sprintf("backs host device %s", name)
+		for _, slave := range topology.slaves[name] {
+			protect(slave, reason)
+		}
+		protect(topology.parent[name], reason)
+		for _, part := range topology.partitions[name] {
+			protect(part, fmt.Sprintf("on the same disk as host device %s", name))
+		}
+		for _, holder := range topology.holders[name] {
+			protect(holder, fmt.Sprintf("built on host device %s", name))
+		}
+	}
+	return protected, nil
+}
+
+// readMountedDevices returns the block devices of mountinfo, keyed by kernel name with the mount point
+func readMountedDevices(path string, topology *blockTopology) (map[string]string, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	mounts := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// 36 35 8:2 / /sysroot rw,relatime shared:1 - xfs /dev/sda2 rw
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		name := topology.byDevNumber[fields[2]]
+		if name == "" {
+			for i, field := range fields {
+				if field == "-" && i+2 < len(fields) {
+					name = topology.resolve(fields[i+2])
+					break
+				}
+			}
+		}
+		if name == "" {
+			continue
+		}
+		if _, ok := mounts[name]; !ok {
+			mounts[name] = fields[4]
+		}
+	}
+	return mounts, scanner.Err()
+}
+
+// readSwapDevices returns the kernel names of the swap partitions, swap files are covered by their mount
+func readSwapDevices(path string, topology *blockTopology) ([]string, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	swaps := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Filename Type Size Used Priority
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[1] != "partition" {
+			continue
+		}
+		if name := topology.resolve(fields[0]); name != "" {
+			swaps = append(swaps, name)
+		}
+	}
+	return swaps, scanner.Err()
+}
+
+// failClosedGuard is the guard when the host system devices cannot be determined: every device is
+// treated as protected, so only the devices listed in allow-system-devices are kept
+func failClosedGuard(devices []string, allow []string) []string {
+	protected := make(map[string]string, len(devices))
+	for _, dev := range devices {
+		protected[strings.TrimPrefix(dev, "/dev/")] = "host system devices unknown"
+	}
+	kept, _ := ApplySystemDeviceGuard(devices, protected, allow)
+	return kept
+}
+
+// ApplySystemDeviceGuard removes protected devices unless they match an allow-system-devices pattern.
+// It returns the kept devices and the devices excluded for safety with the reason.
+func ApplySystemDeviceGuard(devices []string, protected map[string]string, allow []string) ([]string, map[string]string) {
+	kept := []string{}
+	excluded := map[string]string{}
+	for _, dev := range devices {
+		name := strings.TrimPrefix(dev, "/dev/")
+		reason, ok := protected[name]
+		if !ok {
+			kept = append(kept, dev)
+			continue
+		}
+		if MatchesAny("/dev/"+name, allow) {
+			klog.Warningf("Device %s is a host system device (%s) but allowed by allow-system-devices", dev, reason)
+			kept = append(kept, dev)
+			continue
+		}
+		excluded[dev] = reason
+	}
+
+	names := make([]string, 0, len(excluded))
+	for dev := range excluded {
+		names = append(names, dev)
+	}
+	sort.Strings(names)
+	for _, dev := range names {
+		klog.Warningf("Excluding host system device %s for safety: %s", dev, excluded[dev])
+	}
+	return kept, excluded
+}
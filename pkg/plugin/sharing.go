@@ -0,0 +1,201 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ocp-power-demos/power-dev-plugin/api"
+	"k8s.io/klog"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+const (
+	// replicaSeparator joins a device name and a replica number in a replica ID, dm-3::0
+	replicaSeparator = "::"
+	// maxReplicas keeps a misconfiguration from flooding the kubelet with IDs
+	maxReplicas = 1000
+)
+
+// ReplicaID is the ID of replica i of a device
+func ReplicaID(dev string, i int) string {
+	return deviceID(dev) + replicaSeparator + strconv.Itoa(i)
+}
+
+// PhysicalDeviceID maps a replica ID back to the ID of its device, other IDs are returned unchanged
+func PhysicalDeviceID(id string) string {
+	if idx := strings.LastIndex(id, replicaSeparator); idx >= 0 {
+		if _, err := strconv.Atoi(id[idx+len(replicaSeparator):]); err == nil {
+			return id[:idx]
+		}
+	}
+	return id
+}
+
+// replicaRule is a validated replica rule
+type replicaRule struct {
+	deviceMatcher
+	replicas int
+}
+
+// ReplicaPolicy decides how many shareable IDs each device is advertised as, from the replicas of
+// its device class, the replica rules and replicas
+type ReplicaPolicy struct {
+	rules           []replicaRule
+	defaultReplicas int
+}
+
+// NewReplicaPolicy validates the replica settings of config, invalid rules are logged and skipped.
+// classes is the device class of each device by name, as the scan found them.
+func NewReplicaPolicy(config *api.DevicePluginConfig, classes map[string]string) *ReplicaPolicy {
+	policy := &ReplicaPolicy{defaultReplicas: 1}
+	if config == nil {
+		return policy
+	}
+	if config.Replicas > 1 {
+		policy.defaultReplicas = clampReplicas(config.Replicas)
+	}
+	for _, class := range compileDeviceClasses(config) {
+		switch {
+		case class.Replicas < 0:
+			klog.Warningf("Invalid replicas of device class %d (%s): %d. Skipping...", class.index, class.Name, class.Replicas)
+		case class.Replicas > 0:
+			policy.rules = append(policy.rules, replicaRule{deviceMatcher: class.membersMatcher(classes), replicas: clampReplicas(class.Replicas)})
+		}
+	}
+	for i, rule := range config.ReplicaRules {
+		if rule.Replicas < 1 {
+			klog.Warningf("Invalid replica rule %d (%s): replicas must be at least 1, got %d. Skipping...", i, rule.Comment, rule.Replicas)
+			continue
+		}
+		matcher, err := compileDeviceMatcher(rule.Glob, rule.Regex, rule.Selector)
+		if err != nil {
+			klog.Warningf("Invalid replica rule %d (%s): %v. Skipping...", i, rule.Comment, err)
+			continue
+		}
+		policy.rules = append(policy.rules, replicaRule{deviceMatcher: matcher, replicas: clampReplicas(rule.Replicas)})
+	}
+	return policy
+}
+
+func clampReplicas(replicas int) int {
+	if replicas > maxReplicas {
+		klog.Warningf("%d replicas per device is more than the maximum, using %d", replicas, maxReplicas)
+		return maxReplicas
+	}
+	return replicas
+}
+
+// Enabled reports whether any device can be shared
+func (p *ReplicaPolicy) Enabled() bool {
+	if p.defaultReplicas > 1 {
+		return true
+	}
+	for _, rule := range p.rules {
+		if rule.replicas > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// NeedsAliases reports whether any rule matches on device names
+func (p *ReplicaPolicy) NeedsAliases() bool {
+	return len(p.rules) > 0
+}
+
+// NeedsAttributes reports whether any rule matches on device attributes
+func (p *ReplicaPolicy) NeedsAttributes() bool {
+	for _, rule := range p.rules {
+		if rule.selector != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Replicas returns the number of IDs a device is advertised as
+func (p *ReplicaPolicy) Replicas(dev string, aliases DeviceAliases, attrs *DeviceAttributes) int {
+	names := aliases.Names(dev)
+	for _, rule := range p.rules {
+		if rule.matches(names, attrs) {
+			return rule.replicas
+		}
+	}
+	return p.defaultReplicas
+}
+
+// ReplicaCounts resolves the replicas of the devices, reading aliases and attributes only when the rules need them
+func (p *ReplicaPolicy) ReplicaCounts(scanner DeviceScanner, devices []string) map[string]int {
+	counts := map[string]int{}
+	aliases, attrs := deviceDetails(scanner, devices, p.NeedsAliases(), p.NeedsAttributes())
+	for _, dev := range devices {
+		counts[dev] = p.Replicas(dev, aliases, attrs[strings.TrimPrefix(dev, "/dev/")])
+	}
+	return counts
+}
+
+// AdvertisedDevices is the device list for the kubelet, without the reserved devices and with the
+// replicas of shared devices. A device is never advertised as more replicas than its upper limit.
+// classes is the device class of each device by name, as the scan found them.
+func AdvertisedDevices(devices []string, config *api.DevicePluginConfig, classes map[string]string, scanner DeviceScanner, health func(dev string) string) []*pluginapi.Device {
+	devices, _ = ReservedDevices(devices, reservedCount(config), classes)
+	policy := NewReplicaPolicy(config, classes)
+	if !policy.Enabled() {
+		return convertDeviceToPluginDevices(devices, health, nil)
+	}
+	counts := policy.ReplicaCounts(scanner, devices)
+	limits := NewUpperLimitPolicy(config, classes).Limits(scanner, devices)
+	return convertDeviceToPluginDevices(devices, health, func(dev string) int { return min(counts[dev], limits[dev]) })
+}
+
+// advertisedDevices is the device list ListAndWatch sends for a state
+func advertisedDevices(state *deviceState, scanner DeviceScanner) []*pluginapi.Device {
+	return AdvertisedDevices(state.devices, state.config, state.classes, scanner, state.deviceHealth)
+}
+
+// resolveRequestedDevices maps the requested (replica) IDs of a container to the discovered devices,
+// each device once however many of its replicas were requested
+func resolveRequestedDevices(ids []string, devices []string) ([]string, error) {
+	// index only the requested devices, the inventory can hold thousands
+	byID := make(map[string]string, len(ids))
+	for _, id := range ids {
+		byID[PhysicalDeviceID(id)] = ""
+	}
+	for _, dev := range devices {
+		if _, ok := byID[deviceID(dev)]; ok {
+			byID[deviceID(dev)] = dev
+		}
+	}
+	resolved := []string{}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		physical := PhysicalDeviceID(id)
+		dev := byID[physical]
+		if dev == "" {
+			return nil, fmt.Errorf("requested device %s is no longer available", id)
+		}
+		if !seen[dev] {
+			seen[dev] = true
+			resolved = append(resolved, dev)
+		}
+	}
+	return resolved, nil
+}
@@ -0,0 +1,304 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/ocp-power-demos/power-dev-plugin/api"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// deviceState is an immutable snapshot of the plugin state: the config it runs with, the devices it
+// advertises with what Allocate reads about them, their health and how often each is allocated. A published snapshot is never modified;
+// writers derive the next one with update, readers keep using whatever snapshot they loaded.
+type deviceState struct {
+	config  *api.DevicePluginConfig
+	devices []string
+	// info is read with the devices, from the host the config describes
+	info deviceInfo
+	// classes are the device classes of the character devices, by device name
+	classes map[string]string
+	health  map[string]string
+	// degraded are the multipath maps with some paths down, by /dev path
+	degraded map[string]bool
+	// grants are the containers holding devices, the usage is counted from them
+	grants []grant
+	// scanned is set once devices hold the result of a scan
+	scanned bool
+	// generation counts the changes of what ListAndWatch advertises: config, devices, classes and health
+	generation uint64
+	// changed is closed once the snapshot is replaced
+	changed chan struct{}
+}
+
+// deviceInfo is what Allocate reads about the devices: the multipath maps, aliases and attributes
+type deviceInfo struct {
+	maps    map[string]*MultipathMap
+	aliases DeviceAliases
+	attrs   map[string]*DeviceAttributes
+}
+
+// discovery is the devices a scan found, with the config it loaded and what it read about them
+type discovery struct {
+	config  *api.DevicePluginConfig
+	devices []string
+	// records are what the discovery backend found out about the block devices, by device name
+	records map[string]BlockDevice
+	// classes are the device classes of the character devices, by device name
+	classes map[string]string
+	info    deviceInfo
+}
+
+// discovered reads what the policies of config need to know about devices, besides their records
+func discovered(scanner DeviceScanner, config *api.DevicePluginConfig, devices []string, records map[string]BlockDevice, classes map[string]string) discovery {
+	found := discovery{config: config, devices: devices, records: records, classes: classes}
+	if config == nil {
+		config = &api.DevicePluginConfig{}
+	}
+	perms, paths, limits := NewPermissionPolicy(config, classes), NewContainerPathPolicy(config), NewUpperLimitPolicy(config, classes)
+	found.info.maps = multipathMaps(scanner, config.MultipathMode)
+	found.info.aliases, found.info.attrs = deviceDetails(scanner, devices,
+		perms.HasRules() || paths.HasTemplates() || limits.HasRules(),
+		perms.NeedsAttributes() || paths.NeedsAttributes() || limits.NeedsAttributes())
+	found.info.attrs = withBlockDeviceRecords(found.info.attrs, devices, records)
+	return found
+}
+
+// deviceHealth returns the health of dev, devices default to Healthy
+func (s *deviceState) deviceHealth(dev string) string {
+	if health, ok := s.health[dev]; ok {
+		return health
+	}
+	return pluginapi.Healthy
+}
+
+// stateUpdate is a change of the state handed to the controller, done receives the resulting snapshot
+type stateUpdate struct {
+	fn   func(next *deviceState) bool
+	done chan *deviceState
+}
+
+// controller is a run of the goroutine owning the state, see run
+type controller struct {
+	// updates carries the changes of the state to the controller
+	updates chan stateUpdate
+	// serving starts the background work of a serving plugin
+	serving chan struct{}
+	// stop is closed by Stop, it ends the controller, ListAndWatch, the scans and the inventory
+	stop     chan interface{}
+	stopOnce sync.Once
+}
+
+// serve starts the background work of the controller, unless it stopped
+func (c *controller) serve() {
+	select {
+	case c.serving <- struct{}{}:
+	case <-c.stop:
+	}
+}
+
+func (c *controller) shutdown() {
+	c.stopOnce.Do(func() { close(c.stop) })
+}
+
+func (c *controller) stopped() bool {
+	select {
+	case <-c.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// startController starts a controller owning the state, replacing the stopped one
+func (p *PowerPlugin) startController() {
+	c := &controller{updates: make(chan stateUpdate), serving: make(chan struct{}), stop: make(chan interface{})}
+	p.ctrl.Store(c)
+	go p.run(c)
+}
+
+// controller returns the current controller, starting the first one
+func (p *PowerPlugin) controller() *controller {
+	p.snapshot()
+	return p.ctrl.Load()
+}
+
+// snapshot returns the current state. The first snapshot is seeded from Config and DeviceUsage and
+// starts the controller, which owns the state from then on.
+func (p *PowerPlugin) snapshot() *deviceState {
+	p.stateOnce.Do(func() {
+		p.state.Store(&deviceState{
+			config:  p.Config,
+			devices: []string{},
+			health:  map[string]string{},
+			grants:  seedGrants(p.DeviceUsage),
+			changed: make(chan struct{}),
+		})
+		p.startController()
+	})
+	return p.state.Load()
+}
+
+// update hands fn to the controller and returns the snapshot it publishes. fn derives the next state
+// from a copy of the current one and reports whether it changed; it replaces the maps and slices it
+// changes, never modifies them, as older snapshots share them. It must not be called by the controller.
+// Once the plugin stopped, fn is dropped and the current snapshot returned.
+func (p *PowerPlugin) update(fn func(next *deviceState) bool) *deviceState {
+	c := p.controller()
+	u := stateUpdate{fn: fn, done: make(chan *deviceState, 1)}
+	select {
+	case c.updates <- u:
+		return <-u.done
+	case <-c.stop:
+		klog.V(2).Infof("The plugin stopped, dropping a state update")
+		return p.state.Load()
+	}
+}
+
+// apply publishes the state fn derives and closes the replaced snapshot's changed channel, only the
+// controller calls it
+func (p *PowerPlugin) apply(fn func(next *deviceState) bool) *deviceState {
+	current := p.state.Load()
+	next := *current
+	next.changed = make(chan struct{})
+	if !fn(&next) {
+		return current
+	}
+	p.state.Store(&next)
+	close(current.changed)
+	return &next
+}
+
+// config is the config the plugin runs with, nil before Start without a Config
+func (p *PowerPlugin) config() *api.DevicePluginConfig {
+	return p.snapshot().config
+}
+
+// setDevices publishes a scan result with its config, ListAndWatch sends the devices again only
+// when the config or the devices changed
+func (p *PowerPlugin) setDevices(found discovery) {
+	p.update(func(next *deviceState) bool {
+		if !next.scanned || !slices.Equal(next.devices, found.devices) || !reflect.DeepEqual(next.config, found.config) ||
+			!maps.Equal(next.classes, found.classes) {
+			next.generation++
+		}
+		next.config = found.config
+		next.devices = append([]string{}, found.devices...)
+		next.info = found.info
+		next.classes = found.classes
+		next.scanned = true
+		return true
+	})
+}
+
+// inventory returns the current snapshot, scanning first when nothing was discovered yet
+func (p *PowerPlugin) inventory() (*deviceState, error) {
+	if state := p.snapshot(); state.scanned {
+		return state, nil
+	}
+	if _, err := p.Rescan(); err != nil {
+		return nil, err
+	}
+	return p.snapshot(), nil
+}
+
+// setDeviceHealth records the health of dev and reports whether it changed
+func (p *PowerPlugin) setDeviceHealth(dev string, health string) bool {
+	previous := pluginapi.Healthy
+	changed := false
+	p.update(func(next *deviceState) bool {
+		previous = next.deviceHealth(dev)
+		if previous == health {
+			return false
+		}
+		healths := make(map[string]string, len(next.health)+1)
+		for d, h := range next.health {
+			healths[d] = h
+		}
+		healths[dev] = health
+		next.health = healths
+		next.generation++
+		changed = true
+		return true
+	})
+	if !changed {
+		return false
+	}
+	klog.Infof("Device %s health changed from %s to %s", dev, previous, health)
+	if health != pluginapi.Healthy {
+		p.Reporter.Event(corev1.EventTypeWarning, ReasonDeviceUnhealthy, "Device %s reported unhealthy", deviceID(dev))
+	}
+	p.Inventory.ObserveHealth(dev, health)
+	return true
+}
+
+// setDeviceDegraded records whether the multipath map dev is degraded and reports whether it changed
+func (p *PowerPlugin) setDeviceDegraded(dev string, degraded bool) bool {
+	changed := false
+	p.update(func(next *deviceState) bool {
+		if next.degraded[dev] == degraded {
+			return false
+		}
+		all := make(map[string]bool, len(next.degraded)+1)
+		for d, value := range next.degraded {
+			all[d] = value
+		}
+		all[dev] = degraded
+		next.degraded = all
+		changed = true
+		return true
+	})
+	if !changed {
+		return false
+	}
+	if !degraded {
+		klog.Infof("Multipath map %s recovered all its paths", dev)
+	}
+	p.Inventory.ObserveDegraded(dev, degraded)
+	return true
+}
+
+// getDeviceHealth returns the last known health of dev, devices default to Healthy
+func (p *PowerPlugin) getDeviceHealth(dev string) string {
+	return p.snapshot().deviceHealth(dev)
+}
+
+// commitGrants publishes the containers holding devices after an Allocate request
+func (p *PowerPlugin) commitGrants(grants []grant) {
+	p.update(func(next *deviceState) bool {
+		next.grants = grants
+		return true
+	})
+	p.Inventory.ObserveUsage(countUsage(grants))
+}
+
+// Devices returns the devices the plugin currently advertises
+func (p *PowerPlugin) Devices() []string {
+	return append([]string{}, p.snapshot().devices...)
+}
+
+// Usage returns how many containers each device is allocated to, keyed by /dev path
+func (p *PowerPlugin) Usage() map[string]int {
+	return countUsage(p.snapshot().grants)
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ocp-power-demos/power-dev-plugin/api"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+const (
+	defaultScanTimeout  = 30 * time.Second
+	defaultProbeTimeout = 5 * time.Second
+	// probeWorkers bounds the devices probed at once
+	probeWorkers = 16
+)
+
+// errProbeTimeout is returned for a device that did not answer within the probe timeout
+var errProbeTimeout = errors.New("device probe timed out")
+
+// prober probes the devices of the scans of one plugin. It holds the devices whose timed out probe
+// has not returned yet, they are not probed again until it does, so a device that hangs costs one
+// goroutine, not one per scan.
+type prober struct {
+	pending sync.Map
+}
+
+// parseTimeout parses a duration field of the config, falling back to def when it is unset or invalid
+func parseTimeout(field, value string, def time.Duration) time.Duration {
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		klog.Warningf("Invalid %s '%s', using %v: %v", field, value, def, err)
+		return def
+	}
+	return d
+}
+
+// scanTimeout is how long a caller waits for a scan, scan-timeout or 30s
+func scanTimeout(config *api.DevicePluginConfig) time.Duration {
+	if config == nil {
+		return defaultScanTimeout
+	}
+	return parseTimeout("scan-timeout", config.ScanTimeout, defaultScanTimeout)
+}
+
+// probeTimeout is how long a single device may take to answer, probe-timeout or 5s
+func probeTimeout(config *api.DevicePluginConfig) time.Duration {
+	if config == nil {
+		return defaultProbeTimeout
+	}
+	return parseTimeout("probe-timeout", config.ProbeTimeout, defaultProbeTimeout)
+}
+
+// runContext runs fn and waits for it until ctx is done. Calls into the kernel cannot be interrupted,
+// so fn keeps running in the background when ctx ends first; its result is dropped.
+func runContext[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := fn()
+		done <- result{value, err}
+	}()
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// probeDevices stats every device with the scanner, each within timeout, and returns the devices that
+// did not answer in time. Other stat errors are ignored, whether a device exists is up to discovery.
+func (p *prober) probeDevices(ctx context.Context, scanner DeviceScanner, devices []string, timeout time.Duration) []string {
+	var (
+		lock  sync.Mutex
+		stuck = map[string]bool{}
+		wg    sync.WaitGroup
+		slots = make(chan struct{}, probeWorkers)
+	)
+	for _, dev := range devices {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-slots }()
+			defer wg.Done()
+			if err := p.probe(ctx, scanner, dev, timeout); errors.Is(err, errProbeTimeout) {
+				klog.Warningf("Device %s did not answer within %v, leaving it out of this scan", dev, timeout)
+				lock.Lock()
+				stuck[dev] = true
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// keep the discovery order
+	timedOut := []string{}
+	for _, dev := range devices {
+		if stuck[dev] {
+			timedOut = append(timedOut, dev)
+		}
+	}
+	return timedOut
+}
+
+// observeScanTimeout reports a scan that did not finish within timeout, once per scan
+func (p *PowerPlugin) observeScanTimeout(call *scanCall, timeout time.Duration, state *deviceState) {
+	if !call.timedOut.CompareAndSwap(false, true) {
+		return
+	}
+	if state.scanned {
+		klog.Warningf("Device scan did not finish within %v, serving the last %d devices while it continues", timeout, len(state.devices))
+		p.Reporter.Event(corev1.EventTypeWarning, ReasonScanTimedOut, "Device scan did not finish within %v, serving the last %d devices", timeout, len(state.devices))
+	} else {
+		klog.Errorf("Device scan did not finish within %v and no devices were discovered before", timeout)
+		p.Reporter.Event(corev1.EventTypeWarning, ReasonScanTimedOut, "Device scan did not finish within %v, no devices are known yet", timeout)
+	}
+	p.Inventory.ObserveScanTimeout()
+	metrics.Add(metricScanTimeouts, 1)
+}
+
+// observeProbeTimeouts reports the devices left out of a scan because their probe timed out
+func (p *PowerPlugin) observeProbeTimeouts(devices []string) {
+	if len(devices) == 0 {
+		return
+	}
+	p.Reporter.Event(corev1.EventTypeWarning, ReasonProbeTimedOut, "Devices left out of the scan, their probe timed out: %v", devices)
+	p.Inventory.ObserveProbeTimeouts(len(devices))
+	metrics.Add(metricProbeTimeouts, int64(len(devices)))
+}
+
+// probe stats dev within timeout, returning errProbeTimeout when it does not answer in time or an
+// earlier probe of it is still pending
+func (p *prober) probe(ctx context.Context, scanner DeviceScanner, dev string, timeout time.Duration) error {
+	if _, pending := p.pending.Load(dev); pending {
+		return errProbeTimeout
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- scanner.StatDevice(dev)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+
+	p.pending.Store(dev, true)
+	go func() {
+		<-done
+		p.pending.Delete(dev)
+	}()
+	return errProbeTimeout
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+const (
+	// reconcileTimeout bounds the PodResources call that releases the devices of the containers that are gone
+	reconcileTimeout = 2 * time.Second
+	// grantGracePeriod is how long a grant the kubelet has not reported yet is kept, the kubelet
+	// records the devices of a container only after Allocate returned
+	grantGracePeriod = time.Minute
+)
+
+// AllocationLister lists the device IDs of a resource assigned to the containers the kubelet runs,
+// one entry per container
+type AllocationLister interface {
+	ListAllocations(ctx context.Context, resourceName string) ([][]string, error)
+}
+
+func (k *kubeletPodResolver) ListAllocations(ctx context.Context, resourceName string) ([][]string, error) {
+	resp, err := k.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return AssignedDeviceIDs(resp, resourceName), nil
+}
+
+// AssignedDeviceIDs returns the device IDs of resourceName of each container holding any
+func AssignedDeviceIDs(resp *podresourcesapi.ListPodResourcesResponse, resourceName string) [][]string {
+	assigned := [][]string{}
+	for _, pod := range resp.GetPodResources() {
+		for _, container := range pod.GetContainers() {
+			ids := []string{}
+			for _, dev := range container.GetDevices() {
+				if dev.GetResourceName() == resourceName {
+					ids = append(ids, dev.GetDeviceIds()...)
+				}
+			}
+			if len(ids) > 0 {
+				assigned = append(assigned, ids)
+			}
+		}
+	}
+	return assigned
+}
+
+// grant is what Allocate handed a container, so the usage can be released once the container is gone
+type grant struct {
+	// key identifies the container by the device IDs the kubelet assigned to it
+	key string
+	// devices are the granted /dev paths
+	devices []string
+	at      time.Time
+	// seen is set once the kubelet reported the container, the grant is released when it no longer does
+	seen bool
+}
+
+// grantKey identifies a container by the device IDs the kubelet assigned to it
+func grantKey(ids []string) string {
+	sorted := slices.Clone(ids)
+	slices.Sort(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// seedGrants turns the usage of PowerPlugin.DeviceUsage into grants, one per container holding a device
+func seedGrants(usage map[string]int) []grant {
+	grants := []grant{}
+	for dev, count := range usage {
+		for i := 0; i < count; i++ {
+			grants = append(grants, grant{key: deviceID(dev), devices: []string{devicePath(dev)}, seen: true})
+		}
+	}
+	return grants
+}
+
+// countUsage counts the containers holding each device of grants
+func countUsage(grants []grant) map[string]int {
+	usage := map[string]int{}
+	for _, g := range grants {
+		for _, dev := range g.devices {
+			usage[dev]++
+		}
+	}
+	return usage
+}
+
+// reconcileGrants keeps the grants of the containers in assigned and those too recent to be reported.
+// A container the plugin has no grant for, e.g. allocated before a restart, holds the devices behind its IDs.
+func reconcileGrants(grants []grant, assigned [][]string, now time.Time) []grant {
+	byKey := map[string][]int{}
+	for i, g := range grants {
+		byKey[g.key] = append(byKey[g.key], i)
+	}
+	next := []grant{}
+	matched := make([]bool, len(grants))
+	for _, ids := range assigned {
+		key := grantKey(ids)
+		if indices := byKey[key]; len(indices) > 0 {
+			byKey[key] = indices[1:]
+			matched[indices[0]] = true
+			g := grants[indices[0]]
+			g.seen = true
+			next = append(next, g)
+			continue
+		}
+		devices := []string{}
+		for _, id := range ids {
+			if dev := devicePath(PhysicalDeviceID(id)); !slices.Contains(devices, dev) {
+				devices = append(devices, dev)
+			}
+		}
+		next = append(next, grant{key: key, devices: devices, at: now, seen: true})
+	}
+	for i, g := range grants {
+		if matched[i] {
+			continue
+		}
+		if !g.seen && now.Sub(g.at) < grantGracePeriod {
+			next = append(next, g)
+			continue
+		}
+		klog.V(2).Infof("Releasing devices %v of the container with IDs %s, the kubelet no longer reports it", g.devices, g.key)
+	}
+	return next
+}
+
+// reconcileUsage rebuilds the grants from the containers the kubelet reports and reports whether the
+// usage changed. Without a lister, or when the kubelet cannot be asked, the recorded grants are kept.
+// The kubelet is asked before Allocate is locked out; the grants made meanwhile are too recent to be
+// reported and are kept.
+func (p *PowerPlugin) reconcileUsage() bool {
+	if p.Allocations == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), reconcileTimeout)
+	defer cancel()
+	assigned, err := p.Allocations.ListAllocations(ctx, resource)
+	if err != nil {
+		klog.Warningf("Unable to list the allocations of the kubelet, keeping the recorded usage: %v", err)
+		return false
+	}
+	p.allocateLock.Lock()
+	defer p.allocateLock.Unlock()
+	grants := p.snapshot().grants
+	next := reconcileGrants(grants, assigned, time.Now())
+	p.commitGrants(next)
+	return !maps.Equal(countUsage(grants), countUsage(next))
+}
+
+// RefreshUsage releases the devices of the containers the kubelet no longer reports and counts those of
+// the containers allocated before the plugin started, so Allocate and the inventory see the current
+// allocations. The controller runs it as the plugin starts serving and after each rescan.
+func (p *PowerPlugin) RefreshUsage() {
+	p.reconcileUsage()
+}
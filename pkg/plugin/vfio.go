@@ -0,0 +1,199 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog"
+)
+
+const (
+	// VFIOContainerDevice is the VFIO container node, granted with every group
+	VFIOContainerDevice = "/dev/vfio/vfio"
+	// VFIODriver is the driver a device is bound to for passthrough; binding is up to the admin
+	VFIODriver = "vfio-pci"
+	// vfioGroupRegex matches the node of an IOMMU group, /dev/vfio/12
+	vfioGroupRegex = `/dev/vfio/[0-9]+`
+)
+
+var pciAddress = regexp.MustCompile(`^[0-9a-f]{4}:[0-9a-f]{2}:[0-9a-f]{2}\.[0-7]$`)
+
+// viableDrivers are the drivers a device can have without keeping its IOMMU group from being opened:
+// vfio-pci, pci-stub, none and the PCIe port driver of a bridge sharing the group
+var viableDrivers = map[string]bool{VFIODriver: true, "pci-stub": true, "": true, "pcieport": true}
+
+// VFIODevice is a PCI device of an IOMMU group
+type VFIODevice struct {
+	// Address is the PCI address, e.g. 0000:01:00.0
+	Address string
+	// Driver is the driver the device is bound to, empty for none
+	Driver string
+	// Vendor and Device are the PCI IDs, e.g. 0x1014 / 0x0611
+	Vendor string
+	Device string
+}
+
+// VFIOGroup is an IOMMU group with a device bound to vfio-pci
+type VFIOGroup struct {
+	// Group is the IOMMU group number, its node is /dev/vfio/<Group>
+	Group   string
+	Devices []VFIODevice
+}
+
+// Path is the node of the group
+func (g *VFIOGroup) Path() string {
+	return "/dev/vfio/" + g.Group
+}
+
+// Viable reports whether the group can be opened: the kernel refuses a group while one of its
+// devices is bound to a host driver. The error names the devices that are.
+func (g *VFIOGroup) Viable() error {
+	bound := []string{}
+	for _, dev := range g.Devices {
+		if !viableDrivers[dev.Driver] {
+			bound = append(bound, dev.Address+" is bound to "+dev.Driver)
+		}
+	}
+	if len(bound) > 0 {
+		return fmt.Errorf("IOMMU group %s is not viable: %s", g.Group, strings.Join(bound, ", "))
+	}
+	return nil
+}
+
+// Addresses lists the PCI addresses of the group
+func (g *VFIOGroup) Addresses() []string {
+	addresses := make([]string, 0, len(g.Devices))
+	for _, dev := range g.Devices {
+		addresses = append(addresses, dev.Address)
+	}
+	return addresses
+}
+
+// VFIOScanner is implemented by scanners that can list the IOMMU groups of the devices bound to
+// vfio-pci. Without it, vfio device classes find no devices.
+type VFIOScanner interface {
+	VFIOGroups() ([]VFIOGroup, error)
+}
+
+// ReadVFIOGroups lists the IOMMU groups of the devices bound to vfio-pci under sysRoot, in group
+// order, each with all of its devices. Nothing is bound or unbound.
+func ReadVFIOGroups(sysRoot string) ([]VFIOGroup, error) {
+	driverDir := filepath.Join(sysRoot, "bus", "pci", "drivers", VFIODriver)
+	if _, err := os.Stat(driverDir); os.IsNotExist(err) {
+		// vfio-pci is not loaded, so nothing is bound to it
+		return nil, nil
+	}
+	seen := map[string]bool{}
+	groups := []VFIOGroup{}
+	for _, entry := range readSysfsDir(driverDir) {
+		if !pciAddress.MatchString(entry) {
+			continue
+		}
+		link, err := os.Readlink(filepath.Join(driverDir, entry, "iommu_group"))
+		if err != nil {
+			klog.Warningf("Device %s is bound to %s but has no IOMMU group: %v", entry, VFIODriver, err)
+			continue
+		}
+		group := filepath.Base(link)
+		if seen[group] {
+			continue
+		}
+		seen[group] = true
+
+		devicesDir := filepath.Join(sysRoot, "kernel", "iommu_groups", group, "devices")
+		g := VFIOGroup{Group: group}
+		for _, address := range readSysfsDir(devicesDir) {
+			dir := filepath.Join(devicesDir, address)
+			driver := ""
+			if target, err := os.Readlink(filepath.Join(dir, "driver")); err == nil {
+				driver = filepath.Base(target)
+			}
+			g.Devices = append(g.Devices, VFIODevice{
+				Address: address,
+				Driver:  driver,
+				Vendor:  readSysfsString(filepath.Join(dir, "vendor")),
+				Device:  readSysfsString(filepath.Join(dir, "device")),
+			})
+		}
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		a, _ := strconv.Atoi(groups[i].Group)
+		b, _ := strconv.Atoi(groups[j].Group)
+		return a < b
+	})
+	return groups, nil
+}
+
+// vfioCandidates are the nodes of the viable IOMMU groups, with what /sys/class lists about them,
+// and the PCI addresses of each group by device name. Groups that are not viable are logged and left out.
+func vfioCandidates(scanner DeviceScanner, chars []CharDevice) ([]CharDevice, map[string]string) {
+	vfioScanner, ok := scanner.(VFIOScanner)
+	if !ok {
+		klog.Warning("A vfio device class is configured but the scanner cannot list IOMMU groups")
+		return nil, nil
+	}
+	groups, err := vfioScanner.VFIOGroups()
+	if err != nil {
+		klog.Warningf("Unable to list the IOMMU groups of %s devices: %v", VFIODriver, err)
+		return nil, nil
+	}
+	if len(groups) == 0 {
+		return nil, nil
+	}
+	if err := scanner.StatDevice(VFIOContainerDevice); err != nil {
+		klog.Warningf("%d IOMMU groups found but %s is missing, is the vfio module loaded? %v", len(groups), VFIOContainerDevice, err)
+		return nil, nil
+	}
+
+	byPath := make(map[string]CharDevice, len(chars))
+	for _, dev := range chars {
+		byPath[dev.Path] = dev
+	}
+	candidates := []CharDevice{}
+	addresses := map[string]string{}
+	for _, g := range groups {
+		if err := g.Viable(); err != nil {
+			klog.Warningf("Skipping %s: %v", g.Path(), err)
+			continue
+		}
+		dev, ok := byPath[g.Path()]
+		if !ok {
+			dev = CharDevice{Path: g.Path(), SysfsClass: "vfio"}
+		}
+		candidates = append(candidates, dev)
+		addresses[deviceID(g.Path())] = strings.Join(g.Addresses(), ",")
+	}
+	return candidates, addresses
+}
+
+// isVFIOGroup reports whether path is the node of an IOMMU group, which is useless without the container node
+func isVFIOGroup(path string) bool {
+	group, found := strings.CutPrefix(path, "/dev/vfio/")
+	if !found {
+		return false
+	}
+	_, err := strconv.Atoi(group)
+	return err == nil
+}
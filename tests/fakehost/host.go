@@ -0,0 +1,589 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fakehost builds the filesystem tree of a fake host in a temporary directory: /sys/block
+// and /sys/class/block linking into /sys/devices, /dev nodes and aliases, the udev database and the
+// mounts of PID 1. The plugin's HostScanner pointed at the tree discovers it like a real host, ghw included.
+package fakehost
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+)
+
+// Transports of a Disk, as the plugin derives them from the sysfs device path
+const (
+	TransportFC     = "fc"
+	TransportSCSI   = "scsi"
+	TransportVSCSI  = "vscsi"
+	TransportSATA   = "sata"
+	TransportVirtio = "virtio"
+	TransportNVMe   = "nvme"
+)
+
+const sectorSize = 512
+
+// Disk is a whole disk: a SCSI LUN or path (sda), an NVMe namespace (nvme0n1) or a virtio disk (vda)
+type Disk struct {
+	Name string
+	// Transport defaults to nvme for nvme* names, virtio for vd* names and scsi otherwise
+	Transport  string
+	SizeBytes  uint64
+	Vendor     string
+	Model      string
+	Serial     string
+	WWN        string
+	Rotational bool
+	Removable  bool
+	// State is the SCSI device state of a path, running when empty
+	State      string
+	Partitions []Partition
+	// Udev holds extra udev properties, e.g. ID_FS_TYPE
+	Udev map[string]string
+}
+
+// Partition is a partition of a Disk, named sda1 or nvme0n1p1 after its position
+type Partition struct {
+	SizeBytes uint64
+	FSType    string
+	Label     string
+	Udev      map[string]string
+}
+
+// DM is a device-mapper device: a multipath map, a kpartx partition of one or an LVM volume
+type DM struct {
+	// Name is the kernel name, dm-N
+	Name string
+	// Mapper is the /dev/mapper name
+	Mapper string
+	UUID   string
+	// SizeBytes defaults to the size of the first slave
+	SizeBytes uint64
+	Slaves    []string
+	Udev      map[string]string
+}
+
+// PCIDevice is a PCI function in an IOMMU group
+type PCIDevice struct {
+	// Address is the PCI address, e.g. 0000:01:00.0
+	Address string
+	// Vendor and Device are the PCI IDs, e.g. 0x1014 / 0x0611
+	Vendor string
+	Device string
+	// Driver is the driver the function is bound to, e.g. vfio-pci or nvme, none when empty
+	Driver     string
+	IOMMUGroup int
+}
+
+// Host is a fake host tree rooted at Root
+type Host struct {
+	Root string
+
+	t          testing.TB
+	sysDirs    map[string]string // kernel name -> its directory under sys/devices
+	devNumbers map[string]string // kernel name -> major:minor
+	sizes      map[string]uint64
+	nextMinor  map[int]int
+	scsiHosts  int
+	nvmeCtrls  int
+	mounts     int
+}
+
+// New creates an empty host in a temporary directory of t
+func New(t testing.TB) *Host {
+	h := &Host{
+		Root:       t.TempDir(),
+		t:          t,
+		sysDirs:    map[string]string{},
+		devNumbers: map[string]string{},
+		sizes:      map[string]uint64{},
+		nextMinor:  map[int]int{},
+	}
+	for _, dir := range []string{"sys/block", "sys/class/block", "dev/mapper", "dev/disk/by-id", "run/udev/data", "proc/1", "proc/self"} {
+		h.mkdir(dir)
+	}
+	// a tree always has its own mounts, so nothing is read from the machine running the tests
+	h.writeFile("proc/1/mountinfo", "")
+	h.writeFile("proc/1/swaps", "Filename\t\t\t\tType\t\tSize\t\tUsed\t\tPriority\n")
+	h.writeFile("proc/self/mounts", "")
+	h.writeFile("dev/mapper/control", "")
+	return h
+}
+
+// Scanner returns the plugin's HostScanner reading this host
+func (h *Host) Scanner() *plugin.HostScanner {
+	return plugin.NewHostScanner(h.Root)
+}
+
+// Path maps a host path such as /sys/block/sda into the tree
+func (h *Host) Path(hostPath string) string {
+	return filepath.Join(h.Root, hostPath)
+}
+
+// DevNumber returns the major:minor of a device added to the host
+func (h *Host) DevNumber(name string) string {
+	return h.devNumbers[name]
+}
+
+// AddDisk adds a disk with its partitions
+func (h *Host) AddDisk(d Disk) *Host {
+	h.t.Helper()
+	transport := d.Transport
+	if transport == "" {
+		transport = defaultTransport(d.Name)
+	}
+
+	var deviceDir, blockDir string
+	switch transport {
+	case TransportNVMe:
+		deviceDir = fmt.Sprintf("sys/devices/pci0000:00/0000:00:03.0/nvme/nvme%d", h.nvmeCtrls)
+		blockDir = filepath.Join(deviceDir, d.Name)
+		h.nvmeCtrls++
+	case TransportVirtio:
+		deviceDir = fmt.Sprintf("sys/devices/pci0000:00/0000:00:04.0/virtio%d", len(h.sysDirs))
+		blockDir = filepath.Join(deviceDir, "block", d.Name)
+	default:
+		host := h.scsiHosts
+		h.scsiHosts++
+		parent := map[string]string{
+			TransportFC:    fmt.Sprintf("sys/devices/pci0000:00/0000:00:01.0/host%d/rport-%d:0-0", host, host),
+			TransportVSCSI: fmt.Sprintf("sys/devices/vio/30000002/host%d", host),
+			TransportSATA:  fmt.Sprintf("sys/devices/pci0000:00/0000:00:1f.2/ata%d/host%d", host+1, host),
+		}[transport]
+		if parent == "" {
+			parent = fmt.Sprintf("sys/devices/pci0000:00/0000:00:02.0/host%d", host)
+		}
+		deviceDir = filepath.Join(parent, fmt.Sprintf("target%d:0:0/%d:0:0:0", host, host))
+		blockDir = filepath.Join(deviceDir, "block", d.Name)
+		h.writeFile(filepath.Join(deviceDir, "state"), firstNonEmpty(d.State, "running"))
+	}
+
+	major, minors := diskNumbers(transport)
+	minor := h.allocMinor(major, minors)
+	h.addBlockDevice(d.Name, blockDir, major, minor, d.SizeBytes)
+	h.symlink(filepath.Join(blockDir, "device"), deviceDir)
+	h.writeFile(filepath.Join(blockDir, "removable"), boolFile(d.Removable))
+	h.writeFile(filepath.Join(blockDir, "queue", "rotational"), boolFile(d.Rotational))
+	h.writeFile(filepath.Join(blockDir, "queue", "physical_block_size"), strconv.Itoa(sectorSize))
+	h.writeOptional(filepath.Join(deviceDir, "vendor"), d.Vendor)
+	h.writeOptional(filepath.Join(deviceDir, "model"), d.Model)
+	h.writeOptional(filepath.Join(deviceDir, "serial"), d.Serial)
+	if transport == TransportNVMe {
+		h.writeOptional(filepath.Join(blockDir, "wwid"), d.WWN)
+	} else {
+		h.writeOptional(filepath.Join(deviceDir, "wwid"), d.WWN)
+	}
+
+	udev := map[string]string{"DEVTYPE": "disk"}
+	setOptional(udev, "ID_VENDOR", d.Vendor)
+	setOptional(udev, "ID_MODEL", d.Model)
+	setOptional(udev, "ID_SERIAL_SHORT", d.Serial)
+	setOptional(udev, "ID_WWN", d.WWN)
+	h.writeUdev(d.Name, merge(udev, d.Udev))
+	if d.WWN != "" {
+		h.Link("/dev/disk/by-id/wwn-"+d.WWN, d.Name)
+	}
+
+	for i, part := range d.Partitions {
+		n := i + 1
+		name := partitionName(d.Name, n)
+		dir := filepath.Join(blockDir, name)
+		partMinor := minor + n
+		if transport == TransportNVMe {
+			partMinor = h.allocMinor(major, 1)
+		}
+		h.addBlockDevice(name, dir, major, partMinor, part.SizeBytes)
+		h.writeFile(filepath.Join(dir, "partition"), strconv.Itoa(n))
+
+		udev := map[string]string{"DEVTYPE": "partition", "ID_PART_ENTRY_NUMBER": strconv.Itoa(n)}
+		setOptional(udev, "ID_FS_TYPE", part.FSType)
+		setOptional(udev, "ID_FS_LABEL", part.Label)
+		h.writeUdev(name, merge(udev, part.Udev))
+		if d.WWN != "" {
+			h.Link(fmt.Sprintf("/dev/disk/by-id/wwn-%s-part%d", d.WWN, n), name)
+		}
+		if part.Label != "" {
+			h.Link("/dev/disk/by-label/"+part.Label, name)
+		}
+	}
+	return h
+}
+
+// AddLoop adds a loop device, unused when sizeBytes is 0
+func (h *Host) AddLoop(name string, sizeBytes uint64, backingFile string) *Host {
+	h.t.Helper()
+	minor, err := strconv.Atoi(strings.TrimPrefix(name, "loop"))
+	if err != nil {
+		h.t.Fatalf("fakehost: loop device name %s", name)
+	}
+	dir := filepath.Join("sys/devices/virtual/block", name)
+	h.addBlockDevice(name, dir, 7, minor, sizeBytes)
+	h.writeFile(filepath.Join(dir, "queue", "rotational"), "0")
+	if backingFile != "" {
+		h.writeFile(filepath.Join(dir, "loop", "backing_file"), backingFile)
+	}
+	return h
+}
+
+// AddDM adds a device-mapper device built on its slaves, which must already exist
+func (h *Host) AddDM(dm DM) *Host {
+	h.t.Helper()
+	minor, err := strconv.Atoi(strings.TrimPrefix(dm.Name, "dm-"))
+	if err != nil {
+		h.t.Fatalf("fakehost: device-mapper device name %s", dm.Name)
+	}
+	size := dm.SizeBytes
+	if size == 0 && len(dm.Slaves) > 0 {
+		size = h.sizes[dm.Slaves[0]]
+	}
+	dir := filepath.Join("sys/devices/virtual/block", dm.Name)
+	h.addBlockDevice(dm.Name, dir, 253, minor, size)
+	h.writeFile(filepath.Join(dir, "dm", "name"), dm.Mapper)
+	h.writeFile(filepath.Join(dir, "dm", "uuid"), dm.UUID)
+	h.writeFile(filepath.Join(dir, "dm", "suspended"), "0")
+	h.writeFile(filepath.Join(dir, "queue", "rotational"), "0")
+	for _, slave := range dm.Slaves {
+		slaveDir, ok := h.sysDirs[slave]
+		if !ok {
+			h.t.Fatalf("fakehost: slave %s of %s does not exist", slave, dm.Name)
+		}
+		h.symlink(filepath.Join(dir, "slaves", slave), slaveDir)
+		h.symlink(filepath.Join(slaveDir, "holders", dm.Name), dir)
+	}
+
+	h.writeUdev(dm.Name, merge(map[string]string{"DEVTYPE": "disk", "DM_NAME": dm.Mapper, "DM_UUID": dm.UUID}, dm.Udev))
+	if dm.Mapper != "" {
+		h.Link("/dev/mapper/"+dm.Mapper, dm.Name)
+		h.Link("/dev/disk/by-id/dm-name-"+dm.Mapper, dm.Name)
+	}
+	if dm.UUID != "" {
+		h.Link("/dev/disk/by-id/dm-uuid-"+dm.UUID, dm.Name)
+	}
+	return h
+}
+
+// AddMultipath adds a multipath map named alias over the given paths, like multipathd with
+// user_friendly_names would
+func (h *Host) AddMultipath(name, alias, wwid string, paths ...string) *Host {
+	h.t.Helper()
+	return h.AddDM(DM{Name: name, Mapper: alias, UUID: "mpath-" + wwid, Slaves: paths, Udev: map[string]string{"DM_WWN": "0x" + wwid}})
+}
+
+// AddMultipathPartition adds partition n of a multipath map, like kpartx would
+func (h *Host) AddMultipathPartition(name, mpath string, n int, sizeBytes uint64) *Host {
+	h.t.Helper()
+	uuid := strings.TrimSpace(h.read(filepath.Join(h.sysDirs[mpath], "dm", "uuid")))
+	mapper := strings.TrimSpace(h.read(filepath.Join(h.sysDirs[mpath], "dm", "name")))
+	return h.AddDM(DM{Name: name, Mapper: fmt.Sprintf("%s%d", mapper, n), UUID: fmt.Sprintf("part%d-%s", n, uuid), SizeBytes: sizeBytes, Slaves: []string{mpath}})
+}
+
+// AddLogicalVolume adds the logical volume lv of the active volume group vg over the given PVs, like
+// vgchange -ay would
+func (h *Host) AddLogicalVolume(name, vg, lv string, pvs ...string) *Host {
+	h.t.Helper()
+	return h.AddDM(DM{Name: name, Mapper: vg + "-" + lv, UUID: "LVM-" + vg + lv, Slaves: pvs})
+}
+
+// AddMDArray adds the md array name over the given members, in the given array_state, e.g. clean
+func (h *Host) AddMDArray(name, state string, members ...string) *Host {
+	h.t.Helper()
+	minor, err := strconv.Atoi(strings.TrimPrefix(name, "md"))
+	if err != nil {
+		h.t.Fatalf("fakehost: md device name %s", name)
+	}
+	dir := filepath.Join("sys/devices/virtual/block", name)
+	h.addBlockDevice(name, dir, 9, minor, h.sizes[members[0]])
+	h.writeFile(filepath.Join(dir, "md", "level"), "raid1")
+	h.writeFile(filepath.Join(dir, "md", "array_state"), state)
+	for _, member := range members {
+		memberDir, ok := h.sysDirs[member]
+		if !ok {
+			h.t.Fatalf("fakehost: member %s of %s does not exist", member, name)
+		}
+		h.symlink(filepath.Join(dir, "slaves", member), memberDir)
+		h.symlink(filepath.Join(memberDir, "holders", name), dir)
+	}
+	h.writeUdev(name, map[string]string{"DEVTYPE": "disk", "MD_LEVEL": "raid1"})
+	return h
+}
+
+// SetPathState sets the SCSI device state of a disk, e.g. offline for a failed multipath path
+func (h *Host) SetPathState(name, state string) *Host {
+	h.t.Helper()
+	dir, ok := h.sysDirs[name]
+	if !ok {
+		h.t.Fatalf("fakehost: device %s does not exist", name)
+	}
+	h.writeFile(filepath.Join(dir, "device", "state"), state)
+	return h
+}
+
+// AddNxGzip adds the Power nx-gzip accelerator character device
+func (h *Host) AddNxGzip() *Host {
+	h.t.Helper()
+	return h.AddCharDevice("nx-gzip", "nx-gzip", "crypto/nx-gzip", 10, 121)
+}
+
+// AddCharDevice adds a character device listed in /sys/class/<class> as name, with its node at
+// /dev/<devName>, e.g. AddCharDevice("vfio", "12", "vfio/12", 241, 0)
+func (h *Host) AddCharDevice(class, name, devName string, major, minor int) *Host {
+	h.t.Helper()
+	dir := filepath.Join("sys/devices/virtual", class, name)
+	h.writeFile(filepath.Join(dir, "dev"), fmt.Sprintf("%d:%d", major, minor))
+	h.writeFile(filepath.Join(dir, "uevent"), fmt.Sprintf("MAJOR=%d\nMINOR=%d\nDEVNAME=%s", major, minor, devName))
+	h.symlink(filepath.Join("sys/class", class, name), dir)
+	h.writeFile(filepath.Join("dev", devName), "")
+	return h
+}
+
+// AddPCIDevice adds a PCI function to its IOMMU group. Once a function of the group is bound to
+// vfio-pci, the group gets its /dev/vfio node and the host the /dev/vfio/vfio container node.
+func (h *Host) AddPCIDevice(d PCIDevice) *Host {
+	h.t.Helper()
+	dir := filepath.Join("sys/devices/pci0000:00", d.Address)
+	group := strconv.Itoa(d.IOMMUGroup)
+	groupDir := filepath.Join("sys/kernel/iommu_groups", group)
+	h.writeFile(filepath.Join(dir, "vendor"), d.Vendor)
+	h.writeFile(filepath.Join(dir, "device"), d.Device)
+	h.mkdir(filepath.Join(groupDir, "devices"))
+	h.symlink(filepath.Join(dir, "iommu_group"), groupDir)
+	h.symlink(filepath.Join(groupDir, "devices", d.Address), dir)
+	h.symlink(filepath.Join("sys/bus/pci/devices", d.Address), dir)
+	if d.Driver == "" {
+		return h
+	}
+	driverDir := filepath.Join("sys/bus/pci/drivers", d.Driver)
+	h.writeFile(filepath.Join(driverDir, "bind"), "")
+	h.symlink(filepath.Join(dir, "driver"), driverDir)
+	h.symlink(filepath.Join(driverDir, d.Address), dir)
+	if d.Driver == "vfio-pci" {
+		if !h.exists("dev/vfio/vfio") {
+			h.AddCharDevice("misc", "vfio", "vfio/vfio", 10, 196)
+		}
+		if !h.exists(filepath.Join("dev/vfio", group)) {
+			h.AddCharDevice("vfio", group, "vfio/"+group, 241, d.IOMMUGroup)
+		}
+	}
+	return h
+}
+
+// Mount records a filesystem on a device as mounted by the host
+func (h *Host) Mount(name, mountPoint, fsType string) *Host {
+	h.t.Helper()
+	source := "/dev/" + name
+	if mapper := strings.TrimSpace(h.read(filepath.Join(h.sysDirs[name], "dm", "name"))); mapper != "" {
+		source = "/dev/mapper/" + mapper
+	}
+	h.mounts++
+	h.appendFile("proc/1/mountinfo", fmt.Sprintf("%d 1 %s / %s rw,relatime shared:%d - %s %s rw\n",
+		h.mounts+20, h.devNumbers[name], mountPoint, h.mounts, fsType, source))
+	h.appendFile("proc/self/mounts", fmt.Sprintf("%s %s %s rw,relatime 0 0\n", source, mountPoint, fsType))
+	return h
+}
+
+// Swap records a device as a swap partition of the host
+func (h *Host) Swap(name string) *Host {
+	h.t.Helper()
+	h.appendFile("proc/1/swaps", fmt.Sprintf("/dev/%s\t\t\t\tpartition\t%d\t\t0\t\t-2\n", name, h.sizes[name]/1024))
+	return h
+}
+
+// Link adds a /dev alias such as /dev/disk/by-id/wwn-0x600... pointing at a device. Like udev,
+// the last device claiming an alias gets it, e.g. the wwn- link of a LUN seen through several paths.
+func (h *Host) Link(alias, name string) *Host {
+	h.t.Helper()
+	if err := os.Remove(h.Path(alias)); err != nil && !os.IsNotExist(err) {
+		h.t.Fatalf("fakehost: %v", err)
+	}
+	h.symlink(strings.TrimPrefix(alias, "/"), filepath.Join("dev", name))
+	return h
+}
+
+// addBlockDevice creates the sysfs directory, the /sys/block and /sys/class/block links and the /dev node
+func (h *Host) addBlockDevice(name, dir string, major, minor int, sizeBytes uint64) {
+	h.t.Helper()
+	if _, ok := h.sysDirs[name]; ok {
+		h.t.Fatalf("fakehost: device %s already exists", name)
+	}
+	devNumber := fmt.Sprintf("%d:%d", major, minor)
+	h.sysDirs[name] = dir
+	h.devNumbers[name] = devNumber
+	h.sizes[name] = sizeBytes
+
+	h.writeFile(filepath.Join(dir, "dev"), devNumber)
+	h.writeFile(filepath.Join(dir, "size"), strconv.FormatUint(sizeBytes/sectorSize, 10))
+	h.writeFile(filepath.Join(dir, "ro"), "0")
+	h.mkdir(filepath.Join(dir, "holders"))
+	h.mkdir(filepath.Join(dir, "slaves"))
+	// partitions live in their disk's directory and are not in /sys/block
+	if !h.isPartitionDir(dir) {
+		h.symlink(filepath.Join("sys/block", name), dir)
+	}
+	h.symlink(filepath.Join("sys/class/block", name), dir)
+	h.writeFile(filepath.Join("dev", name), "")
+}
+
+// isPartitionDir reports whether dir is inside the directory of another block device
+func (h *Host) isPartitionDir(dir string) bool {
+	parent := filepath.Dir(dir)
+	for _, d := range h.sysDirs {
+		if d == parent {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Host) allocMinor(major, count int) int {
+	minor := h.nextMinor[major]
+	h.nextMinor[major] = minor + count
+	return minor
+}
+
+func (h *Host) writeUdev(name string, properties map[string]string) {
+	h.t.Helper()
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString("S:" + strings.TrimPrefix(name, "/dev/") + "\n")
+	for _, key := range keys {
+		fmt.Fprintf(&b, "E:%s=%s\n", key, properties[key])
+	}
+	h.writeFile(filepath.Join("run/udev/data", "b"+h.devNumbers[name]), b.String())
+}
+
+func (h *Host) mkdir(dir string) {
+	h.t.Helper()
+	if err := os.MkdirAll(filepath.Join(h.Root, dir), 0o755); err != nil {
+		h.t.Fatalf("fakehost: %v", err)
+	}
+}
+
+func (h *Host) writeFile(path, content string) {
+	h.t.Helper()
+	h.mkdir(filepath.Dir(path))
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	if err := os.WriteFile(filepath.Join(h.Root, path), []byte(content), 0o644); err != nil {
+		h.t.Fatalf("fakehost: %v", err)
+	}
+}
+
+func (h *Host) writeOptional(path, content string) {
+	h.t.Helper()
+	if content != "" {
+		h.writeFile(path, content)
+	}
+}
+
+func (h *Host) appendFile(path, content string) {
+	h.t.Helper()
+	h.writeFile(path, h.read(path)+content)
+}
+
+func (h *Host) read(path string) string {
+	data, err := os.ReadFile(filepath.Join(h.Root, path))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func (h *Host) exists(path string) bool {
+	_, err := os.Lstat(filepath.Join(h.Root, path))
+	return err == nil
+}
+
+// symlink links path to target relatively, as sysfs and udev do, both relative to Root
+func (h *Host) symlink(path, target string) {
+	h.t.Helper()
+	h.mkdir(filepath.Dir(path))
+	rel, err := filepath.Rel(filepath.Dir(path), target)
+	if err == nil {
+		err = os.Symlink(rel, filepath.Join(h.Root, path))
+	}
+	if err != nil {
+		h.t.Fatalf("fakehost: %v", err)
+	}
+}
+
+func defaultTransport(name string) string {
+	switch {
+	case strings.HasPrefix(name, "nvme"):
+		return TransportNVMe
+	case strings.HasPrefix(name, "vd"):
+		return TransportVirtio
+	}
+	return TransportSCSI
+}
+
+// diskNumbers returns the major of a disk and the minors it and its partitions take
+func diskNumbers(transport string) (int, int) {
+	switch transport {
+	case TransportNVMe:
+		return 259, 1
+	case TransportVirtio:
+		return 252, 16
+	}
+	return 8, 16
+}
+
+func partitionName(disk string, n int) string {
+	if last := disk[len(disk)-1]; last >= '0' && last <= '9' {
+		return fmt.Sprintf("%sp%d", disk, n)
+	}
+	return fmt.Sprintf("%s%d", disk, n)
+}
+
+func boolFile(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func setOptional(properties map[string]string, key, value string) {
+	if value != "" {
+		properties[key] = value
+	}
+}
+
+func merge(properties, extra map[string]string) map[string]string {
+	for key, value := range extra {
+		properties[key] = value
+	}
+	return properties
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
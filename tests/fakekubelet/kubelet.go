@@ -0,0 +1,253 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fakekubelet runs the kubelet side of the device plugin protocol in-process: a Registration
+// server on a unix socket in a temporary directory, and a client for the plugins that register with it.
+// It lets tests drive Start, Register, ListAndWatch and Allocate end to end and simulate kubelet restarts.
+package fakekubelet
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// Kubelet is a fake kubelet serving the Registration API from Dir/kubelet.sock
+type Kubelet struct {
+	Dir string
+
+	mutex         sync.Mutex
+	server        *grpc.Server
+	registrations chan *pluginapi.RegisterRequest
+}
+
+// New starts a fake kubelet in dir
+func New(dir string) (*Kubelet, error) {
+	k := &Kubelet{Dir: dir, registrations: make(chan *pluginapi.RegisterRequest, 16)}
+	if err := k.start(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// SocketPath is the registration socket plugins dial
+func (k *Kubelet) SocketPath() string {
+	return filepath.Join(k.Dir, filepath.Base(pluginapi.KubeletSocket))
+}
+
+func (k *Kubelet) start() error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if err := os.Remove(k.SocketPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	listener, err := net.Listen("unix", k.SocketPath())
+	if err != nil {
+		return err
+	}
+	k.server = grpc.NewServer()
+	pluginapi.RegisterRegistrationServer(k.server, &registration{kubelet: k})
+	go k.server.Serve(listener)
+	return nil
+}
+
+// Stop shuts the registration server down and removes its socket
+func (k *Kubelet) Stop() {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if k.server != nil {
+		k.server.Stop()
+		k.server = nil
+	}
+	// already gone when a test deleted it
+	os.Remove(k.SocketPath())
+}
+
+// Restart simulates a kubelet restart. Like the kubelet's device manager, the new instance wipes every
+// socket in Dir, the plugins' included, which plugins are expected to notice and re-register.
+func (k *Kubelet) Restart() error {
+	k.Stop()
+	entries, err := os.ReadDir(k.Dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Type()&os.ModeSocket != 0 {
+			if err := os.Remove(filepath.Join(k.Dir, entry.Name())); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return k.start()
+}
+
+// DeleteSocket removes a socket file without stopping anything, like a kubelet wiping its plugin
+// directory. A relative path is taken relative to Dir.
+func (k *Kubelet) DeleteSocket(path string) error {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(k.Dir, path)
+	}
+	return os.Remove(path)
+}
+
+// WaitForRegistration returns the next registration request a plugin sent
+func (k *Kubelet) WaitForRegistration(timeout time.Duration) (*pluginapi.RegisterRequest, error) {
+	select {
+	case req := <-k.registrations:
+		return req, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("no plugin registered within %v", timeout)
+	}
+}
+
+// Connect dials the endpoint of a registered plugin, like the kubelet does after Register
+func (k *Kubelet) Connect(req *pluginapi.RegisterRequest) (*Plugin, error) {
+	endpoint := req.Endpoint
+	if !filepath.IsAbs(endpoint) {
+		endpoint = filepath.Join(k.Dir, endpoint)
+	}
+	conn, err := grpc.NewClient("unix:"+endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	return &Plugin{ResourceName: req.ResourceName, conn: conn, client: pluginapi.NewDevicePluginClient(conn)}, nil
+}
+
+// registration is the Registration server of the fake kubelet
+type registration struct {
+	pluginapi.UnimplementedRegistrationServer
+	kubelet *Kubelet
+}
+
+func (r *registration) Register(ctx context.Context, req *pluginapi.RegisterRequest) (*pluginapi.Empty, error) {
+	if req.Version != pluginapi.Version {
+		return nil, fmt.Errorf("unsupported device plugin API version %s, expected %s", req.Version, pluginapi.Version)
+	}
+	select {
+	case r.kubelet.registrations <- req:
+	default:
+		return nil, fmt.Errorf("too many pending registrations")
+	}
+	return &pluginapi.Empty{}, nil
+}
+
+// Plugin is the kubelet's client of a registered device plugin
+type Plugin struct {
+	ResourceName string
+
+	conn   *grpc.ClientConn
+	client pluginapi.DevicePluginClient
+}
+
+// Close closes the connection to the plugin
+func (p *Plugin) Close() error {
+	return p.conn.Close()
+}
+
+// Options calls GetDevicePluginOptions
+func (p *Plugin) Options(ctx context.Context) (*pluginapi.DevicePluginOptions, error) {
+	return p.client.GetDevicePluginOptions(ctx, &pluginapi.Empty{})
+}
+
+// Allocate asks the plugin for the devices of one container per list of IDs
+func (p *Plugin) Allocate(ctx context.Context, ids ...[]string) (*pluginapi.AllocateResponse, error) {
+	req := &pluginapi.AllocateRequest{}
+	for _, devicesIDs := range ids {
+		req.ContainerRequests = append(req.ContainerRequests, &pluginapi.ContainerAllocateRequest{DevicesIds: devicesIDs})
+	}
+	return p.client.Allocate(ctx, req)
+}
+
+// ListAndWatch opens the device stream. The updates are read in the background until the stream ends
+// or ctx is cancelled.
+func (p *Plugin) ListAndWatch(ctx context.Context) (*Watch, error) {
+	stream, err := p.client.ListAndWatch(ctx, &pluginapi.Empty{})
+	if err != nil {
+		return nil, err
+	}
+	w := &Watch{updates: make(chan []*pluginapi.Device, 16), done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		for {
+			resp, err := stream.Recv()
+			if err != nil {
+				w.err = err
+				return
+			}
+			select {
+			case w.updates <- resp.Devices:
+			case <-ctx.Done():
+				w.err = ctx.Err()
+				return
+			}
+		}
+	}()
+	return w, nil
+}
+
+// Watch is an open ListAndWatch stream
+type Watch struct {
+	updates chan []*pluginapi.Device
+	done    chan struct{}
+	err     error
+}
+
+// Next returns the next device list the plugin sent
+func (w *Watch) Next(timeout time.Duration) ([]*pluginapi.Device, error) {
+	select {
+	case devices := <-w.updates:
+		return devices, nil
+	default:
+	}
+	select {
+	case devices := <-w.updates:
+		return devices, nil
+	case <-w.done:
+		return nil, fmt.Errorf("ListAndWatch ended: %w", w.err)
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("no device list within %v", timeout)
+	}
+}
+
+// WaitClosed waits for the plugin to end the stream and reports whether it did within timeout
+func (w *Watch) WaitClosed(timeout time.Duration) bool {
+	select {
+	case <-w.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Err is why the stream ended, io.EOF when the plugin returned from ListAndWatch. It is only set once
+// WaitClosed returned true.
+func (w *Watch) Err() error {
+	select {
+	case <-w.done:
+		return w.err
+	default:
+		return nil
+	}
+}
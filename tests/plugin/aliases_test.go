@@ -0,0 +1,141 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockAliasScanner struct {
+	mockScanner
+	aliases plugin.DeviceAliases
+}
+
+func (m mockAliasScanner) DeviceAliases() (plugin.DeviceAliases, error) {
+	return m.aliases, nil
+}
+
+// fakeAliases is a host where the data LUN oradata_01 is dm-3 after this boot and the boot disk is sda
+var fakeAliases = plugin.DeviceAliases{
+	"dm-3": {"/dev/disk/by-id/dm-uuid-mpath-36005076810810261f800000000000a1b", "/dev/disk/by-id/wwn-0x6005076810810261f800000000000a1b", "/dev/mapper/oradata_01"},
+	"dm-4": {"/dev/disk/by-id/wwn-0x6005076810810261f800000000000a1c", "/dev/mapper/oradata_02"},
+	"sda":  {"/dev/disk/by-path/vio-30000002-lun-0"},
+	"sda1": {"/dev/disk/by-label/boot", "/dev/disk/by-uuid/1b2c"},
+}
+
+func TestReadDeviceAliases(t *testing.T) {
+	devRoot := t.TempDir()
+	writeSysfs(t, devRoot, map[string]string{"mapper/control": ""})
+	links := map[string]string{
+		"disk/by-id/wwn-0x6005076810810261f800000000000a1b": "../../dm-3",
+		"disk/by-label/boot":              "../../sda1",
+		"disk/by-path/vio-30000002-lun-0": "../../sda",
+		"mapper/oradata_01":               "../dm-3",
+	}
+	for link, target := range links {
+		path := filepath.Join(devRoot, link)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.Symlink(target, path))
+	}
+
+	aliases, err := plugin.ReadDeviceAliases(devRoot)
+	assert.NoError(t, err)
+	assert.Equal(t, plugin.DeviceAliases{
+		"dm-3": {"/dev/disk/by-id/wwn-0x6005076810810261f800000000000a1b", "/dev/mapper/oradata_01"},
+		"sda":  {"/dev/disk/by-path/vio-30000002-lun-0"},
+		"sda1": {"/dev/disk/by-label/boot"},
+	}, aliases)
+
+	_, err = plugin.ReadDeviceAliases(filepath.Join(devRoot, "missing"))
+	assert.Error(t, err)
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"/dev/dm-*", "/dev/dm-3", true},
+		{"/dev/*", "/dev/disk/by-id/wwn-0x1", false},
+		{"/dev/disk/**/wwn-0x6005076*", "/dev/disk/by-id/wwn-0x6005076810810261f800000000000a1b", true},
+		{"/dev/**", "/dev/disk/by-id/wwn-0x1", true},
+		{"/dev/**/dm-3", "/dev/dm-3", true},
+		{"/dev/**/by-label/*", "/dev/disk/by-id/boot", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			matched, err := plugin.MatchPattern(tt.pattern, tt.path)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, matched)
+		})
+	}
+
+	_, err := plugin.MatchPattern("/dev/**/[", "/dev/disk/x")
+	assert.Error(t, err)
+}
+
+func TestScanRootForDevicesWithDeps_Aliases(t *testing.T) {
+	devices := []string{"/dev/sda", "/dev/sda1", "/dev/dm-3", "/dev/dm-4"}
+
+	tests := []struct {
+		name     string
+		config   *api.DevicePluginConfig
+		expected []string
+	}{
+		{
+			name:     "Include by mapper name",
+			config:   &api.DevicePluginConfig{IncludeDevices: []string{"/dev/mapper/oradata_*"}},
+			expected: []string{"dm-3", "dm-4"},
+		},
+		{
+			name:     "Include by WWN with a recursive pattern",
+			config:   &api.DevicePluginConfig{IncludeDevices: []string{"/dev/disk/**/wwn-0x6005076810810261f800000000000a1b"}},
+			expected: []string{"dm-3"},
+		},
+		{
+			name:     "Exclude by label and path",
+			config:   &api.DevicePluginConfig{ExcludeDevices: []string{"/dev/disk/by-label/boot", "/dev/disk/by-path/vio-*"}},
+			expected: []string{"/dev/dm-3", "/dev/dm-4"},
+		},
+		{
+			name: "Exclude alias wins over an include of the kernel name",
+			config: &api.DevicePluginConfig{
+				IncludeDevices: []string{"/dev/dm-*"},
+				ExcludeDevices: []string{"/dev/mapper/oradata_02"},
+			},
+			expected: []string{"dm-3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := mockAliasScanner{
+				mockScanner: mockScanner{devices: devices, config: tt.config},
+				aliases:     fakeAliases,
+			}
+			got, err := plugin.ScanRootForDevicesWithDeps(scanner, false)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
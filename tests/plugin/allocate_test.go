@@ -0,0 +1,222 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/ocp-power-demos/power-dev-plugin/tests/fakekubelet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/klog"
+)
+
+// countingScanner counts the scans and blocks each until release is closed, when set
+type countingScanner struct {
+	mockScanner
+	scans   *atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func newCountingScanner(devices []string, config *api.DevicePluginConfig) countingScanner {
+	return countingScanner{mockScanner: mockScanner{devices: devices, config: config}, scans: &atomic.Int32{}}
+}
+
+func (s countingScanner) GetBlockDevices() ([]string, error) {
+	if s.scans.Add(1) == 1 && s.started != nil {
+		close(s.started)
+	}
+	if s.release != nil {
+		<-s.release
+	}
+	return s.mockScanner.GetBlockDevices()
+}
+
+func TestAllocate_ServesFromInventory(t *testing.T) {
+	config := &api.DevicePluginConfig{AllocationPolicy: plugin.PolicyUpperLimitShared}
+	scanner := newCountingScanner([]string{"/dev/dm-3", "/dev/dm-4"}, config)
+	p := &plugin.PowerPlugin{Scanner: scanner, Config: config, DeviceUsage: map[string]int{}}
+
+	for i := 0; i < 10; i++ {
+		resp, err := p.Allocate(context.Background(), containerRequests([]string{"dm-4"}))
+		require.NoError(t, err)
+		assert.Equal(t, "/dev/dm-4", resp.ContainerResponses[0].Devices[0].HostPath)
+	}
+	assert.Equal(t, int32(1), scanner.scans.Load(), "only the first Allocate scans, the rest use the inventory")
+	assert.Equal(t, map[string]int{"/dev/dm-4": 10}, p.Usage())
+}
+
+func TestRescan_SharesInFlightScan(t *testing.T) {
+	scanner := newCountingScanner([]string{"/dev/dm-3"}, &api.DevicePluginConfig{})
+	scanner.started, scanner.release = make(chan struct{}), make(chan struct{})
+	p := &plugin.PowerPlugin{Scanner: scanner, DeviceUsage: map[string]int{}}
+
+	var wg sync.WaitGroup
+	results := make([][]string, 8)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0], _ = p.Rescan()
+	}()
+	<-scanner.started
+	for i := 1; i < len(results); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := p.Allocate(context.Background(), containerRequests([]string{"dm-3"}))
+			if assert.NoError(t, err) {
+				results[i] = []string{resp.ContainerResponses[0].Devices[0].HostPath}
+			}
+		}()
+	}
+	// give the callers time to join the scan in flight
+	time.Sleep(100 * time.Millisecond)
+	close(scanner.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), scanner.scans.Load(), "callers waiting for a scan share it")
+	for _, result := range results {
+		assert.Equal(t, []string{"/dev/dm-3"}, result)
+	}
+}
+
+// switchScanner is a scanner whose devices change between scans
+type switchScanner struct {
+	mockScanner
+	lock    sync.Mutex
+	current []string
+}
+
+func (s *switchScanner) set(devices []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.current = devices
+}
+
+func (s *switchScanner) GetBlockDevices() ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.current, nil
+}
+
+func TestLifecycle_BackgroundRescan(t *testing.T) {
+	dir := t.TempDir()
+	kubelet, err := fakekubelet.New(dir)
+	require.NoError(t, err)
+	t.Cleanup(kubelet.Stop)
+
+	scanner := &switchScanner{current: []string{"/dev/dm-3"}}
+	p, err := plugin.NewWithPluginDir(dir)
+	require.NoError(t, err)
+	p.Scanner = scanner
+	p.Policy = plugin.UpperLimitSharedPolicy{}
+	p.RescanInterval = 20 * time.Millisecond
+	require.NoError(t, p.Serve())
+	t.Cleanup(func() { p.Stop() })
+
+	req, err := kubelet.WaitForRegistration(lifecycleTimeout)
+	require.NoError(t, err)
+	client, err := kubelet.Connect(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watch, err := client.ListAndWatch(ctx)
+	require.NoError(t, err)
+	devices, err := watch.Next(lifecycleTimeout)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dm-3"}, deviceIDs(devices))
+
+	scanner.set([]string{"/dev/dm-3", "/dev/dm-4"})
+	devices, err = watch.Next(lifecycleTimeout)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dm-3", "dm-4"}, deviceIDs(devices), "the controller publishes new devices")
+
+	resp, err := client.Allocate(ctx, []string{"dm-4"})
+	require.NoError(t, err)
+	assert.Equal(t, "/dev/dm-4", resp.ContainerResponses[0].Devices[0].HostPath)
+}
+
+// quietLogs discards the klog output of a benchmark
+func quietLogs(b *testing.B) {
+	flags := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(flags)
+	require.NoError(b, flags.Set("logtostderr", "false"))
+	klog.SetOutput(io.Discard)
+	b.Cleanup(func() {
+		flags.Set("logtostderr", "true")
+		klog.SetOutput(os.Stderr)
+	})
+}
+
+func benchmarkDevices(n int) []string {
+	devices := make([]string, n)
+	for i := range devices {
+		devices[i] = fmt.Sprintf("/dev/dm-%d", i)
+	}
+	return devices
+}
+
+// BenchmarkAllocate measures the latency of Allocate against an inventory of n devices
+func BenchmarkAllocate(b *testing.B) {
+	quietLogs(b)
+	for _, n := range []int{100, 1000, 5000} {
+		b.Run(fmt.Sprintf("devices=%d", n), func(b *testing.B) {
+			config := &api.DevicePluginConfig{}
+			p := &plugin.PowerPlugin{Scanner: mockScanner{devices: benchmarkDevices(n), config: config}, Config: config, DeviceUsage: map[string]int{}}
+			_, err := p.Rescan()
+			require.NoError(b, err)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := p.Allocate(context.Background(), containerRequests([]string{fmt.Sprintf("dm-%d", i%n)})); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkRescan measures the scan Allocate no longer waits for
+func BenchmarkRescan(b *testing.B) {
+	quietLogs(b)
+	for _, n := range []int{100, 1000, 5000} {
+		b.Run(fmt.Sprintf("devices=%d", n), func(b *testing.B) {
+			config := &api.DevicePluginConfig{}
+			p := &plugin.PowerPlugin{Scanner: mockScanner{devices: benchmarkDevices(n), config: config}, Config: config, DeviceUsage: map[string]int{}}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := p.Rescan(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	vioDisk = "sys/devices/vio/30000002/host0/target0:0:1/0:0:1:0/block/sda"
+	fcDisk  = "sys/devices/pci0000:00/0000:00:01.0/host1/rport-1:0-2/target1:0:0/1:0:0:1/block/sdb"
+	dmDisk  = "sys/devices/virtual/block/dm-0"
+)
+
+// fakeAttributeHost has a 20Gi vSCSI boot disk sda with an xfs sda1, and a 100Gi IBM 2145
+// fibre channel LUN sdb under multipath map dm-0 (mpatha)
+func fakeAttributeHost(t *testing.T) *plugin.AttributeReader {
+	root := t.TempDir()
+	writeSysfs(t, root, map[string]string{
+		vioDisk + "/dev":              "8:0",
+		vioDisk + "/size":             "41943040",
+		vioDisk + "/queue/rotational": "1",
+		vioDisk + "/device/vendor":    "AIX     ",
+		vioDisk + "/device/model":     "VDASD           ",
+		vioDisk + "/sda1/dev":         "8:1",
+		vioDisk + "/sda1/size":        "2097152",
+		vioDisk + "/sda1/partition":   "1",
+		fcDisk + "/dev":               "8:16",
+		fcDisk + "/size":              "209715200",
+		fcDisk + "/queue/rotational":  "0",
+		fcDisk + "/device/vendor":     "IBM     ",
+		fcDisk + "/device/model":      "2145            ",
+		fcDisk + "/device/wwid":       "naa.6005076810810261f800000000000a1b",
+		fcDisk + "/holders/dm-0/x":    "",
+		dmDisk + "/dev":               "253:0",
+		dmDisk + "/size":              "209715200",
+		dmDisk + "/dm/name":           "mpatha",
+		dmDisk + "/dm/uuid":           "mpath-36005076810810261f800000000000a1b",
+		dmDisk + "/slaves/sdb/x":      "",
+		"run/udev/data/b8:1":          "S:disk/by-label/boot\nE:ID_FS_TYPE=xfs\nE:ID_FS_LABEL=boot\n",
+		"run/udev/data/b8:16":         "E:ID_SERIAL=36005076810810261f800000000000a1b\n",
+	})
+
+	classBlock := filepath.Join(root, "sys", "class", "block")
+	assert.NoError(t, os.MkdirAll(classBlock, 0755))
+	for name, target := range map[string]string{
+		"sda":  vioDisk,
+		"sda1": vioDisk + "/sda1",
+		"sdb":  fcDisk,
+		"dm-0": dmDisk,
+	} {
+		assert.NoError(t, os.Symlink(filepath.Join(root, target), filepath.Join(classBlock, name)))
+	}
+	return &plugin.AttributeReader{SysRoot: filepath.Join(root, "sys"), UdevRoot: filepath.Join(root, "run", "udev", "data")}
+}
+
+type mockAttributeScanner struct {
+	mockScanner
+	attrs map[string]*plugin.DeviceAttributes
+}
+
+func (m mockAttributeScanner) DeviceAttributes(devices []string) (map[string]*plugin.DeviceAttributes, error) {
+	return m.attrs, nil
+}
+
+func TestAttributeReader(t *testing.T) {
+	attrs := fakeAttributeHost(t).Read([]string{"/dev/sda", "/dev/sda1", "/dev/dm-0", "/dev/missing"})
+	assert.Len(t, attrs, 3)
+
+	sda := attrs["sda"]
+	assert.Equal(t, plugin.DeviceTypeDisk, sda.Type)
+	assert.Equal(t, uint64(20<<30), sda.SizeBytes)
+	assert.Equal(t, "AIX", sda.Vendor)
+	assert.Equal(t, "VDASD", sda.Model)
+	assert.Equal(t, "vscsi", sda.Transport)
+	assert.True(t, sda.Rotational)
+	assert.Empty(t, sda.FSType)
+
+	sda1 := attrs["sda1"]
+	assert.Equal(t, plugin.DeviceTypePartition, sda1.Type)
+	assert.Equal(t, "xfs", sda1.FSType)
+	assert.Equal(t, "boot", sda1.Label)
+	assert.Equal(t, "AIX", sda1.Vendor, "a partition has the attributes of its disk")
+
+	dm := attrs["dm-0"]
+	assert.Equal(t, "mpatha", dm.DMName)
+	assert.Equal(t, "mpath-36005076810810261f800000000000a1b", dm.DMUUID)
+	assert.Equal(t, "IBM", dm.Vendor, "a dm device is described by its first slave")
+	assert.Equal(t, "2145", dm.Model)
+	assert.Equal(t, "fc", dm.Transport)
+	assert.Equal(t, "naa.6005076810810261f800000000000a1b", dm.WWN)
+	assert.Equal(t, "36005076810810261f800000000000a1b", dm.Serial)
+	assert.False(t, dm.Rotational)
+}
+
+func TestMatchesSelector(t *testing.T) {
+	yes, no := true, false
+	lun := &plugin.DeviceAttributes{
+		Name:      "dm-0",
+		Type:      plugin.DeviceTypeDisk,
+		SizeBytes: 100 << 30,
+		Vendor:    "IBM",
+		Model:     "2145",
+		DMName:    "mpatha",
+		DMUUID:    "mpath-36005076810810261f800000000000a1b",
+		Transport: "fc",
+	}
+
+	tests := []struct {
+		name     string
+		selector api.DeviceSelector
+		expected bool
+	}{
+		{"Empty selector matches everything", api.DeviceSelector{}, true},
+		{"Vendor and model", api.DeviceSelector{Vendor: "IBM", Model: "2145"}, true},
+		{"Case-insensitive", api.DeviceSelector{Vendor: "ibm"}, true},
+		{"Glob", api.DeviceSelector{DMUUID: "mpath-3600507681*"}, true},
+		{"One field differs", api.DeviceSelector{Vendor: "IBM", Model: "FlashSystem"}, false},
+		{"Transport", api.DeviceSelector{Transport: "iscsi"}, false},
+		{"No filesystem", api.DeviceSelector{FSType: "none"}, true},
+		{"Filesystem required", api.DeviceSelector{FSType: "xfs"}, false},
+		{"Within size range", api.DeviceSelector{MinSize: "50Gi", MaxSize: "100Gi"}, true},
+		{"Too small", api.DeviceSelector{MinSize: "1Ti"}, false},
+		{"Too large", api.DeviceSelector{MaxSize: "10Gi"}, false},
+		{"Invalid size never matches", api.DeviceSelector{MinSize: "big"}, false},
+		{"Not rotational", api.DeviceSelector{Rotational: &no}, true},
+		{"Rotational", api.DeviceSelector{Rotational: &yes}, false},
+		{"Partition", api.DeviceSelector{Type: plugin.DeviceTypePartition}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, plugin.MatchesSelector(lun, tt.selector))
+		})
+	}
+	assert.False(t, plugin.MatchesSelector(nil, api.DeviceSelector{}), "a device without attributes never matches")
+}
+
+func TestScanRootForDevicesWithDeps_Selectors(t *testing.T) {
+	attrs := map[string]*plugin.DeviceAttributes{
+		"sda":  {Name: "sda", Vendor: "AIX", Model: "VDASD", Transport: "vscsi"},
+		"sda1": {Name: "sda1", Vendor: "AIX", Model: "VDASD", FSType: "xfs", Type: plugin.DeviceTypePartition},
+		"dm-0": {Name: "dm-0", Vendor: "IBM", Model: "2145", Transport: "fc"},
+		"dm-1": {Name: "dm-1", Vendor: "IBM", Model: "2145", Transport: "fc", FSType: "ext4"},
+		"dm-2": {Name: "dm-2", Vendor: "NETAPP", Model: "LUN", Transport: "iscsi"},
+	}
+	devices := []string{"/dev/sda", "/dev/sda1", "/dev/dm-0", "/dev/dm-1", "/dev/dm-2"}
+
+	tests := []struct {
+		name     string
+		config   *api.DevicePluginConfig
+		expected []string
+	}{
+		{
+			name:     "Include by vendor and model",
+			config:   &api.DevicePluginConfig{IncludeSelectors: []api.DeviceSelector{{Vendor: "IBM", Model: "2145"}}},
+			expected: []string{"dm-0", "dm-1"},
+		},
+		{
+			name: "Exclude selector wins over include",
+			config: &api.DevicePluginConfig{
+				IncludeSelectors: []api.DeviceSelector{{Vendor: "IBM", Model: "2145"}},
+				ExcludeSelectors: []api.DeviceSelector{{FSType: "ext4"}},
+			},
+			expected: []string{"dm-0"},
+		},
+		{
+			name: "Union with include patterns",
+			config: &api.DevicePluginConfig{
+				IncludeDevices:   []string{"/dev/dm-2"},
+				IncludeSelectors: []api.DeviceSelector{{Transport: "fc"}},
+			},
+			expected: []string{"dm-0", "dm-1", "dm-2"},
+		},
+		{
+			name:     "Exclude only",
+			config:   &api.DevicePluginConfig{ExcludeSelectors: []api.DeviceSelector{{Vendor: "AIX"}}},
+			expected: []string{"/dev/dm-0", "/dev/dm-1", "/dev/dm-2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := mockAttributeScanner{
+				mockScanner: mockScanner{
+					devices:     devices,
+					config:      tt.config,
+					findResults: map[string][]string{"/dev/dm-2": {"/dev/dm-2"}},
+				},
+				attrs: attrs,
+			}
+			got, err := plugin.ScanRootForDevicesWithDeps(scanner, false)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
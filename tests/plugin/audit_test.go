@@ -0,0 +1,212 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+func readAuditRecords(t *testing.T, path string) []plugin.AuditRecord {
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	records := []plugin.AuditRecord{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record plugin.AuditRecord
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestAuditLogger_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.log")
+	audit, err := plugin.NewAuditLogger(path, 1, 2)
+	assert.NoError(t, err)
+	defer audit.Close()
+
+	// ~100KiB per record, so 1MiB rotates roughly every 10 records
+	big := []string{strings.Repeat("x", 100*1024)}
+	for i := 0; i < 35; i++ {
+		assert.NoError(t, audit.Write(plugin.AuditRecord{Event: plugin.AuditEventAllocate, RequestedIDs: big}))
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, info.Size(), int64(1024*1024))
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err), "only 2 backups are kept")
+}
+
+func TestAuditLogger_FailedRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := plugin.NewAuditLogger(path, 1, 1)
+	require.NoError(t, err)
+	defer audit.Close()
+	// a directory in the way of the backup makes the rotation fail
+	require.NoError(t, os.MkdirAll(filepath.Join(path+".1", "busy"), 0750))
+
+	big := []string{strings.Repeat("x", 100*1024)}
+	failed := false
+	for i := 0; i < 12 && !failed; i++ {
+		failed = audit.Write(plugin.AuditRecord{Event: plugin.AuditEventAllocate, RequestedIDs: big}) != nil
+	}
+	require.True(t, failed, "the rotation failed")
+
+	require.NoError(t, os.RemoveAll(path+".1"))
+	assert.NoError(t, audit.Write(plugin.AuditRecord{Event: plugin.AuditEventAllocate, RequestedIDs: big}), "the next write opens the log again")
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Less(t, info.Size(), int64(200*1024), "the log was rotated before the record was written")
+	assert.FileExists(t, path+".1")
+
+	require.NoError(t, audit.Close())
+	assert.ErrorIs(t, audit.Write(plugin.AuditRecord{}), os.ErrClosed)
+}
+
+func TestAuditLogger_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := plugin.NewAuditLogger(path, 10, 1)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, audit.Write(plugin.AuditRecord{Event: plugin.AuditEventAllocate, ID: audit.NextID()}))
+		}()
+	}
+	wg.Wait()
+	assert.NoError(t, audit.Close())
+
+	records := readAuditRecords(t, path)
+	assert.Len(t, records, 50)
+	ids := map[string]bool{}
+	for _, r := range records {
+		ids[r.ID] = true
+	}
+	assert.Len(t, ids, 50)
+}
+
+func TestAllocate_WritesAuditRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := plugin.NewAuditLogger(path, 10, 1)
+	assert.NoError(t, err)
+
+	scanner := mockScanner{devices: []string{"/dev/sda"}, config: &api.DevicePluginConfig{}}
+	p := &plugin.PowerPlugin{
+		Scanner:     scanner,
+		Config:      scanner.config,
+		DeviceUsage: map[string]int{},
+		Audit:       audit,
+	}
+
+	_, err = p.Allocate(context.Background(), &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIds: []string{"sda"}}},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, audit.Close())
+
+	records := readAuditRecords(t, path)
+	assert.Len(t, records, 1)
+	assert.Equal(t, plugin.AuditEventAllocate, records[0].Event)
+	assert.Equal(t, plugin.AuditResultGranted, records[0].Result)
+	assert.Equal(t, []string{"sda"}, records[0].RequestedIDs)
+	assert.NotEmpty(t, records[0].ID)
+	assert.Len(t, records[0].Devices, 1)
+	assert.Equal(t, "/dev/sda", records[0].Devices[0].HostPath)
+	assert.NotEmpty(t, records[0].Devices[0].Permissions)
+	assert.Equal(t, plugin.PermissionSourceDefault, records[0].Devices[0].PermissionSource)
+}
+
+func TestAllocate_AuditLogFollowsTheConfig(t *testing.T) {
+	dir := t.TempDir()
+	config := &api.DevicePluginConfig{}
+	p := &plugin.PowerPlugin{
+		Scanner:     mockScanner{devices: []string{"/dev/sda"}, config: config},
+		Config:      config,
+		DeviceUsage: map[string]int{},
+	}
+	allocate := func() {
+		_, err := p.Rescan()
+		require.NoError(t, err)
+		_, err = p.Allocate(context.Background(), containerRequests([]string{"sda"}))
+		require.NoError(t, err)
+	}
+
+	allocate()
+	assert.NoFileExists(t, filepath.Join(dir, "a.log"))
+
+	config.AuditLog = filepath.Join(dir, "a.log")
+	allocate()
+	allocate()
+	assert.Len(t, readAuditRecords(t, filepath.Join(dir, "a.log")), 2, "audit-log is enabled by the next scan")
+
+	config.AuditLog = filepath.Join(dir, "b.log")
+	allocate()
+	assert.Len(t, readAuditRecords(t, filepath.Join(dir, "a.log")), 2)
+	assert.Len(t, readAuditRecords(t, filepath.Join(dir, "b.log")), 1, "a changed audit-log is used from the next scan")
+
+	config.AuditLog = ""
+	allocate()
+	assert.Len(t, readAuditRecords(t, filepath.Join(dir, "b.log")), 1, "audit-log is disabled by the next scan")
+}
+
+func TestFindPodForDevices(t *testing.T) {
+	resp := &podresourcesapi.ListPodResourcesResponse{
+		PodResources: []*podresourcesapi.PodResources{
+			{
+				Name:      "db-0",
+				Namespace: "oracle",
+				Containers: []*podresourcesapi.ContainerResources{
+					{
+						Name: "db",
+						Devices: []*podresourcesapi.ContainerDevices{
+							{ResourceName: "power-dev-plugin/dev", DeviceIds: []string{"1", "2"}},
+							{ResourceName: "other/dev", DeviceIds: []string{"3"}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, &plugin.PodIdentity{Namespace: "oracle", Name: "db-0", Container: "db"},
+		plugin.FindPodForDevices(resp, "power-dev-plugin/dev", []string{"2"}))
+	assert.Nil(t, plugin.FindPodForDevices(resp, "power-dev-plugin/dev", []string{"3"}))
+	assert.Nil(t, plugin.FindPodForDevices(resp, "power-dev-plugin/dev", []string{}))
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	inventoryfake "github.com/ocp-power-demos/power-dev-plugin/pkg/client/clientset/versioned/fake"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/ocp-power-demos/power-dev-plugin/tests/fakehost"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// lparHost is powerHost with the character devices of a PowerVM LPAR: a vTPM, the PAPR
+// firmware interfaces, two hypervisor consoles and a VFIO group
+func lparHost(t *testing.T) *fakehost.Host {
+	return powerHost(t).
+		AddCharDevice("tpm", "tpm0", "tpm0", 10, 224).
+		AddCharDevice("tpmrm", "tpmrm0", "tpmrm0", 253, 65536).
+		AddCharDevice("misc", "papr-vpd", "papr-vpd", 10, 123).
+		AddCharDevice("misc", "papr-sysparm", "papr-sysparm", 10, 124).
+		AddCharDevice("hvcs", "hvcs0", "hvcs0", 229, 0).
+		AddCharDevice("hvcs", "hvcs1", "hvcs1", 229, 1).
+		AddCharDevice("vfio", "12", "vfio/12", 241, 0)
+}
+
+func TestReadCharDevices(t *testing.T) {
+	devices, err := lparHost(t).Scanner().CharDevices()
+	require.NoError(t, err)
+	assert.Contains(t, devices, plugin.CharDevice{Path: "/dev/tpmrm0", SysfsClass: "tpmrm", Major: 253, Minor: 65536})
+	assert.Contains(t, devices, plugin.CharDevice{Path: "/dev/vfio/12", SysfsClass: "vfio", Major: 241, Minor: 0})
+	assert.Contains(t, devices, plugin.CharDevice{Path: "/dev/crypto/nx-gzip", SysfsClass: "nx-gzip", Major: 10, Minor: 121})
+	for _, dev := range devices {
+		assert.NotEqual(t, "block", dev.SysfsClass, "block devices are not character devices")
+	}
+}
+
+func TestScanRootForDevices_DeviceClasses(t *testing.T) {
+	tests := []struct {
+		name     string
+		classes  []api.DeviceClass
+		expected []string
+	}{
+		{"by glob", []api.DeviceClass{{Name: "console", Glob: "/dev/hvcs*"}},
+			[]string{"dm-0", "/dev/hvcs0", "/dev/hvcs1"}},
+		{"by sysfs class", []api.DeviceClass{{Name: "tpm", SysfsClass: "tpmrm"}},
+			[]string{"dm-0", "/dev/tpmrm0"}},
+		{"by major", []api.DeviceClass{{Name: "misc", Major: 10}},
+			[]string{"dm-0", "/dev/papr-sysparm", "/dev/papr-vpd", "/dev/crypto/nx-gzip", "/dev/tpm0"}},
+		{"every matcher must match", []api.DeviceClass{{Name: "papr", Glob: "/dev/papr-*", Major: 10}},
+			[]string{"dm-0", "/dev/papr-sysparm", "/dev/papr-vpd"}},
+		{"node in a subdirectory", []api.DeviceClass{{Name: "vfio", SysfsClass: "vfio"}},
+			[]string{"dm-0", "/dev/vfio/12"}},
+		{"a device belongs to the first class", []api.DeviceClass{{Name: "papr", Glob: "/dev/papr-*"}, {Name: "misc", Major: 10}},
+			[]string{"dm-0", "/dev/papr-sysparm", "/dev/papr-vpd", "/dev/crypto/nx-gzip", "/dev/tpm0"}},
+		{"block devices are left to the rules", []api.DeviceClass{{Name: "dm", Glob: "/dev/dm-*"}},
+			[]string{"dm-0"}},
+		{"invalid classes are skipped", []api.DeviceClass{{Name: "all"}, {Glob: "/dev/tpm*"}},
+			[]string{"dm-0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &api.DevicePluginConfig{IncludeDevices: []string{"/dev/dm-0"}, DeviceClasses: tt.classes}
+			scanner := hostConfigScanner{HostScanner: lparHost(t).Scanner(), config: config}
+			devices, err := plugin.ScanRootForDevicesWithDeps(scanner, false)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, devices)
+		})
+	}
+}
+
+func TestDeviceClasses_Semantics(t *testing.T) {
+	config := &api.DevicePluginConfig{
+		Permissions:      "r",
+		IncludeDevices:   []string{"/dev/dm-0"},
+		AllocationPolicy: plugin.PolicyUpperLimitShared,
+		DeviceClasses: []api.DeviceClass{
+			{Name: "tpm", SysfsClass: "tpmrm", Permissions: "rw", UpperLimit: 1},
+			{Name: "console", Glob: "/dev/hvcs*", Replicas: 2},
+		},
+		PermissionRules: []api.PermissionRule{
+			{Comment: "consoles", Selector: &api.DeviceSelector{SysfsClass: "hvcs"}, Permissions: "rw"},
+			{Comment: "everything else", Permissions: "rwm"},
+		},
+	}
+	scanner := hostConfigScanner{HostScanner: lparHost(t).Scanner(), config: config}
+	p := &plugin.PowerPlugin{
+		Scanner:     scanner,
+		Config:      config,
+		DeviceUsage: map[string]int{},
+		Inventory:   plugin.NewInventoryReporter(inventoryfake.NewSimpleClientset(), "worker-0"),
+	}
+	devices, err := p.Rescan()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dm-0", "/dev/tpmrm0", "/dev/hvcs0", "/dev/hvcs1"}, devices)
+
+	members := map[string]string{"tpmrm0": "tpm", "hvcs0": "console", "hvcs1": "console"}
+	assert.Equal(t, []string{"dm-0", "tpmrm0", "hvcs0::0", "hvcs0::1", "hvcs1::0", "hvcs1::1"},
+		deviceIDs(plugin.AdvertisedDevices(devices, config, members, scanner, healthy)))
+
+	perms, sources := plugin.NewPermissionPolicy(config, members).ResolveAll(scanner, devices)
+	assert.Equal(t, map[string]string{"dm-0": "rwm", "/dev/tpmrm0": "rw", "/dev/hvcs0": "rw", "/dev/hvcs1": "rw"}, perms)
+	assert.Equal(t, "device-classes[0] (tpm)", sources["/dev/tpmrm0"], "the class applies ahead of the rules")
+	assert.Equal(t, "permission-rules[0] (consoles)", sources["/dev/hvcs0"], "rules apply what the class leaves unset")
+
+	limits := plugin.NewUpperLimitPolicy(config, members).Limits(scanner, devices)
+	assert.Equal(t, 1, limits["/dev/tpmrm0"])
+	assert.Equal(t, plugin.Unlimited, limits["/dev/hvcs0"])
+
+	resp, err := p.Allocate(context.Background(), containerRequests([]string{"tpmrm0"}))
+	require.NoError(t, err)
+	assert.Equal(t, "/dev/tpmrm0", resp.ContainerResponses[0].Devices[0].HostPath)
+	assert.Equal(t, "rw", resp.ContainerResponses[0].Devices[0].Permissions)
+
+	classes := map[string]string{}
+	for _, dev := range p.Inventory.Status().Devices {
+		classes[dev.Name] = dev.Class
+	}
+	assert.Equal(t, map[string]string{"dm-0": "", "tpmrm0": "tpm", "hvcs0": "console", "hvcs1": "console"}, classes)
+}
+
+func TestDeviceClasses_MembersOnly(t *testing.T) {
+	config := &api.DevicePluginConfig{
+		Permissions:      "r",
+		IncludeDevices:   []string{"/dev/dm-0"},
+		AllocationPolicy: plugin.PolicyUpperLimitShared,
+		DeviceClasses:    []api.DeviceClass{{Name: "any", Glob: "/dev/*", Permissions: "rw", UpperLimit: 1, Replicas: 2}},
+	}
+	scanner := hostConfigScanner{HostScanner: lparHost(t).Scanner(), config: config}
+	p := &plugin.PowerPlugin{
+		Scanner:     scanner,
+		Config:      config,
+		DeviceUsage: map[string]int{},
+		Inventory:   plugin.NewInventoryReporter(inventoryfake.NewSimpleClientset(), "worker-0"),
+	}
+	devices, err := p.Rescan()
+	require.NoError(t, err)
+	require.Contains(t, devices, "dm-0")
+
+	members := map[string]string{}
+	for _, dev := range p.Inventory.Status().Devices {
+		if dev.Class != "" {
+			members[dev.Name] = dev.Class
+		}
+	}
+	require.NotEmpty(t, members)
+	assert.NotContains(t, members, "dm-0", "a class only discovers character devices")
+
+	ids := deviceIDs(plugin.AdvertisedDevices(devices, config, members, scanner, healthy))
+	assert.Contains(t, ids, "dm-0", "the class replicas only apply to its devices")
+	assert.NotContains(t, ids, "dm-0::0")
+
+	perms, sources := plugin.NewPermissionPolicy(config, members).ResolveAll(scanner, devices)
+	assert.Equal(t, "r", perms["dm-0"], "the glob of a class does not reach the block devices")
+	assert.Equal(t, "permissions", sources["dm-0"])
+	limits := plugin.NewUpperLimitPolicy(config, members).Limits(scanner, devices)
+	assert.Equal(t, plugin.Unlimited, limits["dm-0"])
+	for name := range members {
+		assert.Equal(t, "rw", perms["/dev/"+name], name)
+		assert.Equal(t, 1, limits["/dev/"+name], name)
+	}
+
+	for range 2 {
+		resp, err := p.Allocate(context.Background(), containerRequests([]string{"dm-0"}))
+		require.NoError(t, err, "the block device is not held to the upper-limit of the class")
+		assert.Equal(t, "r", resp.ContainerResponses[0].Devices[0].Permissions)
+	}
+}
+
+func TestDeviceClasses_Reserved(t *testing.T) {
+	config := &api.DevicePluginConfig{
+		IncludeDevices:   []string{"/dev/dm-0"},
+		ReservedDevices:  1,
+		AllocationPolicy: plugin.PolicyUpperLimitShared,
+		DeviceClasses:    []api.DeviceClass{{Name: "tpm", SysfsClass: "tpmrm"}, {Name: "console", Glob: "/dev/hvcs*"}},
+	}
+	p := &plugin.PowerPlugin{
+		Scanner:     hostConfigScanner{HostScanner: lparHost(t).Scanner(), config: config},
+		Config:      config,
+		DeviceUsage: map[string]int{},
+		Inventory:   plugin.NewInventoryReporter(inventoryfake.NewSimpleClientset(), "worker-0"),
+	}
+	_, err := p.Rescan()
+	require.NoError(t, err)
+
+	pools := map[string]string{}
+	for _, dev := range p.Inventory.Status().Devices {
+		pools[dev.Name] = dev.Pool
+	}
+	assert.Equal(t, map[string]string{"dm-0": plugin.PoolReserved, "tpmrm0": "power-dev-plugin/dev",
+		"hvcs0": "power-dev-plugin/dev", "hvcs1": "power-dev-plugin/dev"}, pools, "the reserve holds back block devices, whatever the class device names")
+
+	_, err = p.Allocate(context.Background(), containerRequests([]string{"tpmrm0"}))
+	assert.NoError(t, err)
+	_, err = p.Allocate(context.Background(), containerRequests([]string{"dm-0"}))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// These tests are meant to run with go test -race
+
+func TestAllocate_ConcurrentRequestsRespectLimits(t *testing.T) {
+	config := &api.DevicePluginConfig{Replicas: 8, UpperLimitPerDevice: 5, AllocationPolicy: plugin.PolicyUpperLimitShared}
+	p := &plugin.PowerPlugin{
+		Scanner:     mockScanner{devices: []string{"/dev/dm-3", "/dev/dm-4"}, config: config},
+		Config:      config,
+		DeviceUsage: map[string]int{},
+	}
+
+	var granted atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.Allocate(context.Background(), containerRequests([]string{"dm-3::0"})); err == nil {
+				granted.Add(1)
+			}
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := p.Rescan()
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(5), granted.Load(), "exactly upper-limit containers get the device")
+	assert.Equal(t, map[string]int{"/dev/dm-3": 5}, p.Usage())
+	assert.Equal(t, []string{"/dev/dm-3", "/dev/dm-4"}, p.Devices())
+}
+
+func TestLifecycle_ConcurrentAllocateRescanAndRestart(t *testing.T) {
+	kubelet, p, client := servePlugin(t, []string{"/dev/dm-3", "/dev/dm-4"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watches := []interface {
+		WaitClosed(timeout time.Duration) bool
+	}{}
+	for i := 0; i < 3; i++ {
+		watch, err := client.ListAndWatch(ctx)
+		require.NoError(t, err)
+		_, err = watch.Next(lifecycleTimeout)
+		require.NoError(t, err)
+		watches = append(watches, watch)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			// requests racing the restart may fail, they must not race
+			client.Allocate(ctx, []string{"dm-3"})
+		}()
+		go func() {
+			defer wg.Done()
+			p.Rescan()
+		}()
+		go func() {
+			defer wg.Done()
+			p.Usage()
+			p.Devices()
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, kubelet.Restart())
+	}()
+	wg.Wait()
+
+	for _, watch := range watches {
+		assert.True(t, watch.WaitClosed(lifecycleTimeout), "every stream ends when the plugin stops")
+	}
+	// the controller, the test cleanup and this call all stop the plugin
+	var stops sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		stops.Add(1)
+		go func() {
+			defer stops.Done()
+			assert.NoError(t, p.Stop())
+		}()
+	}
+	stops.Wait()
+	assert.NoFileExists(t, p.SocketPath())
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"testing"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func TestRenderContainerPath(t *testing.T) {
+	vars := plugin.NewContainerPathVars("/dev/dm-3", 27, fakeAliases, nil)
+	assert.Equal(t, plugin.ContainerPathVars{
+		Name:       "dm-3",
+		MapperName: "oradata_01",
+		ByID:       "wwn-0x6005076810810261f800000000000a1b",
+		Index:      27,
+	}, vars)
+
+	tests := []struct {
+		template string
+		expected string
+		valid    bool
+	}{
+		{"/dev/power/{mapper-name}", "/dev/power/oradata_01", true},
+		{"/dev/xvd{letter}", "/dev/xvdab", true},
+		{"/dev/data{index}", "/dev/data27", true},
+		{"/dev/disk/by-id/{by-id}", "/dev/disk/by-id/wwn-0x6005076810810261f800000000000a1b", true},
+		{"/dev/{name}", "/dev/dm-3", true},
+		{"/dev/power/../{name}", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			got, err := plugin.RenderContainerPath(tt.template, vars)
+			assert.Equal(t, tt.expected, got)
+			assert.Equal(t, tt.valid, err == nil)
+		})
+	}
+
+	_, err := plugin.RenderContainerPath("/dev/power/{mapper-name}", plugin.NewContainerPathVars("/dev/sdb", 0, fakeAliases, nil))
+	assert.Error(t, err, "sdb has no mapper name")
+
+	vars = plugin.NewContainerPathVars("/dev/dm-9", 0, nil, &plugin.MultipathMap{Name: "dm-9", Alias: "mpathc"})
+	assert.Equal(t, "mpathc", vars.MapperName, "falls back to the multipath alias")
+}
+
+func TestValidateContainerPathTemplate(t *testing.T) {
+	assert.NoError(t, plugin.ValidateContainerPathTemplate("/dev/power/{mapper-name}"))
+	assert.Error(t, plugin.ValidateContainerPathTemplate("power/{name}"))
+	assert.Error(t, plugin.ValidateContainerPathTemplate("/dev/{wwid}"))
+}
+
+func TestContainerPathPolicy_Template(t *testing.T) {
+	policy := plugin.NewContainerPathPolicy(&api.DevicePluginConfig{
+		ContainerPath: "/dev/xvd{letter}",
+		ContainerPathRules: []api.ContainerPathRule{
+			{Comment: "Oracle LUNs", Glob: "/dev/mapper/oradata_*", Template: "/dev/oracle/{mapper-name}"},
+			{Comment: "invalid", Glob: "/dev/sda", Template: "/dev/{unknown}"},
+		},
+	})
+	assert.True(t, policy.HasTemplates())
+	assert.Equal(t, "/dev/oracle/{mapper-name}", policy.Template("/dev/dm-3", fakeAliases, nil))
+	assert.Equal(t, "/dev/xvd{letter}", policy.Template("/dev/sda", fakeAliases, nil), "the invalid rule is skipped")
+
+	assert.False(t, plugin.NewContainerPathPolicy(&api.DevicePluginConfig{}).HasTemplates())
+}
+
+func TestCheckContainerPathCollisions(t *testing.T) {
+	specs := []*pluginapi.DeviceSpec{
+		{HostPath: "/dev/dm-3", ContainerPath: "/dev/power/data"},
+		{HostPath: "/dev/dm-4", ContainerPath: "/dev/power/logs"},
+	}
+	assert.NoError(t, plugin.CheckContainerPathCollisions(specs))
+
+	specs = append(specs, &pluginapi.DeviceSpec{HostPath: "/dev/dm-5", ContainerPath: "/dev/power/data"})
+	assert.EqualError(t, plugin.CheckContainerPathCollisions(specs), "container path /dev/power/data collides for host devices /dev/dm-3 and /dev/dm-5")
+}
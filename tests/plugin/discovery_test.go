@@ -0,0 +1,220 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"fmt"
+	"testing"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/ocp-power-demos/power-dev-plugin/tests/fakehost"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func findBlockDevice(devices []plugin.BlockDevice, name string) *plugin.BlockDevice {
+	for i := range devices {
+		if devices[i].Name == name {
+			return &devices[i]
+		}
+	}
+	return nil
+}
+
+func TestDiscoveryBackends_FakeHost(t *testing.T) {
+	host := powerHost(t)
+	fs := plugin.HostFS{Root: host.Root}
+
+	ghwDevices, err := (&plugin.GhwBackend{HostFS: fs}).Discover()
+	require.NoError(t, err)
+	sysfsDevices, err := (&plugin.SysfsBackend{HostFS: fs}).Discover()
+	require.NoError(t, err)
+	// the sysfs walker leaves the identity of the disks to the attribute reader
+	anonymous := []plugin.BlockDevice{}
+	for _, dev := range ghwDevices {
+		dev.Vendor, dev.Model, dev.Serial, dev.WWN = "", "", "", ""
+		anonymous = append(anonymous, dev)
+	}
+	assert.Equal(t, anonymous, sysfsDevices, "the sysfs walker finds what ghw finds")
+	assert.Equal(t, "IBM", findBlockDevice(ghwDevices, "sdb").Vendor)
+	assert.Equal(t, "2145", findBlockDevice(ghwDevices, "sdb").Model)
+
+	tests := []struct {
+		name     string
+		expected plugin.BlockDevice
+	}{
+		{"sda2", plugin.BlockDevice{Name: "sda2", Path: "/dev/sda2", MajMin: host.DevNumber("sda2"), SizeBytes: 1 * gi,
+			Type: plugin.DeviceTypePartition, Parents: []string{"sda"}, Children: []string{}}},
+		{"sda", plugin.BlockDevice{Name: "sda", Path: "/dev/sda", MajMin: host.DevNumber("sda"), SizeBytes: 100 * gi,
+			Type: plugin.DeviceTypeDisk, Parents: []string{}, Children: []string{"sda1", "sda2", "sda3", "sda4"}}},
+		{"sdb", plugin.BlockDevice{Name: "sdb", Path: "/dev/sdb", MajMin: host.DevNumber("sdb"), SizeBytes: 500 * gi,
+			Type: plugin.DeviceTypeDisk, Parents: []string{}, Children: []string{"dm-0"}}},
+		{"dm-0", plugin.BlockDevice{Name: "dm-0", Path: "/dev/dm-0", MajMin: host.DevNumber("dm-0"), SizeBytes: 500 * gi,
+			Type: plugin.DeviceTypeDisk, Parents: []string{"sdb", "sdc"}, Children: []string{"dm-1"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dev := findBlockDevice(sysfsDevices, tt.name)
+			require.NotNil(t, dev)
+			assert.Equal(t, tt.expected, *dev)
+		})
+	}
+	assert.Nil(t, findBlockDevice(sysfsDevices, "loop1"), "unused loop devices are skipped")
+}
+
+const lsblkMultipath = `{
+   "blockdevices": [
+      {"kname":"sda", "maj:min":"8:0", "size":107374182400, "type":"disk", "pkname":null},
+      {"kname":"sda1", "maj:min":"8:1", "size":"4194304", "type":"part", "pkname":"sda"},
+      {"kname":"sda3", "maj:min":"8:3", "size":4194304, "type":"part", "pkname":"sda"},
+      {"kname":"dm-5", "maj:min":"253:5", "size":4194304, "type":"lvm", "pkname":"sda3"},
+      {"kname":"dm-6", "maj:min":"253:6", "size":4194304, "type":"crypt", "pkname":"dm-5"},
+      {"kname":"sr0", "maj:min":"11:0", "size":1073741312, "type":"rom", "pkname":null},
+      {"kname":"sdb", "maj:min":"8:16", "size":536870912000, "type":"disk", "pkname":null, "vendor":"IBM     ", "model":"2145            ", "serial":null, "wwn":"0x6005076810810261f800000000000a1b"},
+      {"kname":"dm-0", "maj:min":"253:0", "size":536870912000, "type":"mpath", "pkname":"sdb"},
+      {"kname":"dm-1", "maj:min":"253:1", "size":536870912000, "type":"part", "pkname":"dm-0"},
+      {"kname":"sdc", "maj:min":"8:32", "size":536870912000, "type":"disk", "pkname":null},
+      {"kname":"dm-0", "maj:min":"253:0", "size":536870912000, "type":"mpath", "pkname":"sdc"},
+      {"kname":"dm-1", "maj:min":"253:1", "size":536870912000, "type":"part", "pkname":"dm-0"}
+   ]
+}`
+
+func TestParseLsblk(t *testing.T) {
+	devices, err := plugin.ParseLsblk([]byte(lsblkMultipath))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dev/sda", "/dev/sda1", "/dev/sda3", "/dev/sdb", "/dev/dm-0", "/dev/dm-1", "/dev/sdc"}, plugin.DevicePaths(devices),
+		"a device listed once per parent is one device, CD-ROMs, logical volumes and encrypted devices are left out")
+	assert.Equal(t, plugin.BlockDevice{Name: "sdb", Path: "/dev/sdb", MajMin: "8:16", SizeBytes: 500 * gi, Type: plugin.DeviceTypeDisk,
+		Parents: []string{}, Children: []string{"dm-0"}, Vendor: "IBM", Model: "2145", WWN: "0x6005076810810261f800000000000a1b"},
+		*findBlockDevice(devices, "sdb"))
+	assert.Empty(t, findBlockDevice(devices, "sda3").Children)
+	assert.Equal(t, plugin.BlockDevice{Name: "dm-0", Path: "/dev/dm-0", MajMin: "253:0", SizeBytes: 500 * gi,
+		Type: plugin.DeviceTypeDisk, Parents: []string{"sdb", "sdc"}, Children: []string{"dm-1"}}, *findBlockDevice(devices, "dm-0"))
+	assert.Equal(t, uint64(4<<20), findBlockDevice(devices, "sda1").SizeBytes, "older lsblk prints sizes as strings")
+	assert.Equal(t, plugin.DeviceTypePartition, findBlockDevice(devices, "sda1").Type)
+
+	_, err = plugin.ParseLsblk([]byte("lsblk: unknown column"))
+	assert.Error(t, err)
+}
+
+func TestLsblkBackend_ReadsHostRoot(t *testing.T) {
+	var args []string
+	backend := &plugin.LsblkBackend{HostFS: plugin.HostFS{Root: "/host"}, Run: func(a ...string) ([]byte, error) {
+		args = a
+		return []byte(lsblkMultipath), nil
+	}}
+	devices, err := backend.Discover()
+	require.NoError(t, err)
+	assert.Len(t, devices, 7)
+	assert.Equal(t, []string{"--json", "--list", "--bytes", "--output", "KNAME,MAJ:MIN,SIZE,TYPE,PKNAME,VENDOR,MODEL,SERIAL,WWN", "--sysroot", "/host"}, args)
+}
+
+func TestStaticBackend(t *testing.T) {
+	host := powerHost(t)
+	backend := &plugin.StaticBackend{HostFS: plugin.HostFS{Root: host.Root}, Devices: []string{"/dev/dm-0", "/dev/nvme0n1p2", "/dev/vdz"}}
+
+	devices, err := backend.Discover()
+	require.NoError(t, err)
+	assert.Equal(t, []plugin.BlockDevice{
+		{Name: "dm-0", Path: "/dev/dm-0", MajMin: host.DevNumber("dm-0"), SizeBytes: 500 * gi, Type: plugin.DeviceTypeDisk,
+			Parents: []string{"sdb", "sdc"}, Children: []string{"dm-1"}},
+		{Name: "nvme0n1p2", Path: "/dev/nvme0n1p2", MajMin: host.DevNumber("nvme0n1p2"), SizeBytes: 512 * gi, Type: plugin.DeviceTypePartition,
+			Parents: []string{"nvme0n1"}, Children: []string{}},
+		{Name: "vdz", Path: "/dev/vdz", Type: plugin.DeviceTypeDisk, Parents: []string{}, Children: []string{}},
+	}, devices, "listed devices are kept, sysfs fills in what it knows")
+}
+
+func TestScanRootForDevices_DiscoveryBackend(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *api.DevicePluginConfig
+		expected []string
+	}{
+		{"ghw", &api.DevicePluginConfig{DiscoveryBackend: "ghw", IncludeDevices: []string{"/dev/dm-*", "/dev/nvme*"}},
+			[]string{"dm-0", "dm-1", "nvme0n1p1", "nvme0n1p2", "nvme0n1"}},
+		{"sysfs", &api.DevicePluginConfig{DiscoveryBackend: "sysfs", IncludeDevices: []string{"/dev/dm-*", "/dev/nvme*"}},
+			[]string{"dm-0", "dm-1", "nvme0n1p1", "nvme0n1p2", "nvme0n1"}},
+		{"unknown backend falls back to ghw", &api.DevicePluginConfig{DiscoveryBackend: "udev", IncludeDevices: []string{"/dev/dm-*"}},
+			[]string{"dm-0", "dm-1"}},
+		{"static", &api.DevicePluginConfig{DiscoveryBackend: "static", StaticDevices: []string{"/dev/dm-1", "/dev/sda3"}},
+			[]string{"/dev/dm-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := hostConfigScanner{HostScanner: powerHost(t).Scanner(), config: tt.config}
+			devices, err := plugin.ScanRootForDevicesWithDeps(scanner, false)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, devices)
+		})
+	}
+}
+
+// BenchmarkDiscoveryBackend compares the backends reading sysfs on a host with 400 disks and
+// 1600 partitions, run with -benchmem
+func BenchmarkDiscoveryBackend(b *testing.B) {
+	quietLogs(b)
+	host := fakehost.New(b)
+	for i := 0; i < 400; i++ {
+		host.AddDisk(fakehost.Disk{
+			Name: fmt.Sprintf("sd%c%c", 'a'+i/26, 'a'+i%26), Transport: fakehost.TransportFC, SizeBytes: 100 * gi,
+			Partitions: []fakehost.Partition{{SizeBytes: gi}, {SizeBytes: gi}, {SizeBytes: gi}, {SizeBytes: gi}},
+		})
+	}
+	fs := plugin.HostFS{Root: host.Root}
+	for _, backend := range []plugin.DiscoveryBackend{&plugin.GhwBackend{HostFS: fs}, &plugin.SysfsBackend{HostFS: fs}} {
+		b.Run(backend.Name(), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				devices, err := backend.Discover()
+				if err != nil || len(devices) != 2000 {
+					b.Fatalf("discovered %d devices: %v", len(devices), err)
+				}
+			}
+		})
+	}
+}
+
+// recordScanner discovers with a fixed backend and reads attributes without an identity
+type recordScanner struct {
+	mockAttributeScanner
+	backend plugin.DiscoveryBackend
+}
+
+func (s recordScanner) DiscoveryBackend(config *api.DevicePluginConfig) plugin.DiscoveryBackend {
+	return s.backend
+}
+
+func TestScanRootForDevices_UsesDiscoveryRecords(t *testing.T) {
+	backend := &plugin.LsblkBackend{Run: func(a ...string) ([]byte, error) {
+		return []byte(lsblkMultipath), nil
+	}}
+	config := &api.DevicePluginConfig{DeviceRules: []api.DeviceRule{
+		{Action: "allow", Selector: &api.DeviceSelector{Vendor: "ibm", Model: "2145"}},
+	}}
+	scanner := recordScanner{
+		mockAttributeScanner: mockAttributeScanner{
+			mockScanner: mockScanner{config: config},
+			attrs:       map[string]*plugin.DeviceAttributes{"sdb": {Name: "sdb", Type: plugin.DeviceTypeDisk}},
+		},
+		backend: backend,
+	}
+
+	devices, err := plugin.ScanRootForDevicesWithDeps(scanner, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sdb"}, devices, "the vendor lsblk reported is matched")
+}
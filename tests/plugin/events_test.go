@@ -0,0 +1,198 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func newFakeNode(name string) *corev1.Node {
+	return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, UID: "node-uid"}}
+}
+
+func listEvents(t *testing.T, client *fake.Clientset) []corev1.Event {
+	events, err := client.CoreV1().Events("default").List(context.Background(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	return events.Items
+}
+
+func TestNodeReporter_EventDedup(t *testing.T) {
+	client := fake.NewSimpleClientset(newFakeNode("worker-0"))
+	r := plugin.NewNodeReporter(client, "worker-0", 10, 10)
+
+	r.Event(corev1.EventTypeWarning, plugin.ReasonAllocationRejected, "limit %d", 1)
+	r.Event(corev1.EventTypeWarning, plugin.ReasonAllocationRejected, "limit %d", 1)
+	r.Event(corev1.EventTypeWarning, plugin.ReasonAllocationRejected, "limit %d", 2)
+	r.Flush()
+
+	events := listEvents(t, client)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "Node", events[0].InvolvedObject.Kind)
+	assert.Equal(t, "worker-0", events[0].InvolvedObject.Name)
+	assert.Equal(t, "node-uid", string(events[0].InvolvedObject.UID))
+}
+
+func TestNodeReporter_EventDoesNotWaitForTheAPIServer(t *testing.T) {
+	client := fake.NewSimpleClientset(newFakeNode("worker-0"))
+	written := make(chan struct{})
+	client.PrependReactor("create", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		<-written
+		return false, nil, nil
+	})
+	r := plugin.NewNodeReporter(client, "worker-0", 10, 10)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		r.Event(corev1.EventTypeWarning, plugin.ReasonAllocationRejected, "rejected %d", i)
+	}
+	assert.Less(t, time.Since(start), time.Second, "the events are queued while the API server hangs")
+	close(written)
+	r.Flush()
+
+	assert.Len(t, listEvents(t, client), 3)
+	gets := 0
+	for _, action := range client.Actions() {
+		if action.Matches("get", "nodes") {
+			gets++
+		}
+	}
+	assert.Equal(t, 1, gets, "the node UID is looked up once")
+}
+
+func TestNodeReporter_DedupIsPruned(t *testing.T) {
+	client := fake.NewSimpleClientset(newFakeNode("worker-0"))
+	r := plugin.NewNodeReporter(client, "worker-0", 100, 100)
+	r.DedupInterval = 20 * time.Millisecond
+
+	r.Event(corev1.EventTypeNormal, plugin.ReasonDeviceAdded, "Devices added: [dm-0]")
+	r.Event(corev1.EventTypeNormal, plugin.ReasonDeviceAdded, "Devices added: [dm-0]")
+	time.Sleep(30 * time.Millisecond)
+	r.Event(corev1.EventTypeNormal, plugin.ReasonDeviceAdded, "Devices added: [dm-0]")
+	r.Flush()
+	assert.Len(t, listEvents(t, client), 2, "an event is recorded again once the window passed")
+}
+
+func TestNodeReporter_RateLimit(t *testing.T) {
+	client := fake.NewSimpleClientset(newFakeNode("worker-0"))
+	r := plugin.NewNodeReporter(client, "worker-0", 0.001, 3)
+
+	for i := 0; i < 10; i++ {
+		r.Event(corev1.EventTypeNormal, plugin.ReasonDeviceAdded, "event %d", i)
+	}
+	r.Flush()
+	assert.Len(t, listEvents(t, client), 3)
+}
+
+func TestNodeReporter_ObserveDevices(t *testing.T) {
+	client := fake.NewSimpleClientset(newFakeNode("worker-0"))
+	r := plugin.NewNodeReporter(client, "worker-0", 10, 10)
+
+	// first observation seeds the known devices
+	r.ObserveDevices([]string{"dm-0", "dm-1"})
+	assert.Empty(t, listEvents(t, client))
+
+	r.ObserveDevices([]string{"dm-1", "dm-2"})
+	r.Flush()
+	reasons := map[string]string{}
+	for _, e := range listEvents(t, client) {
+		reasons[e.Reason] = e.Message
+	}
+	assert.Equal(t, "Devices added: [dm-2]", reasons[plugin.ReasonDeviceAdded])
+	assert.Equal(t, "Devices removed: [dm-0]", reasons[plugin.ReasonDeviceRemoved])
+}
+
+func TestNodeReporter_SetReady(t *testing.T) {
+	client := fake.NewSimpleClientset(newFakeNode("worker-0"))
+	r := plugin.NewNodeReporter(client, "worker-0", 10, 10)
+
+	r.SetReady(true, plugin.ReasonPluginRegistered, "registered")
+	node, err := client.CoreV1().Nodes().Get(context.Background(), "worker-0", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, node.Status.Conditions, 1)
+	assert.Equal(t, plugin.ReadyCondition, node.Status.Conditions[0].Type)
+	assert.Equal(t, corev1.ConditionTrue, node.Status.Conditions[0].Status)
+
+	r.SetReady(false, plugin.ReasonPluginStopped, "stopped")
+	node, _ = client.CoreV1().Nodes().Get(context.Background(), "worker-0", metav1.GetOptions{})
+	assert.Len(t, node.Status.Conditions, 1)
+	assert.Equal(t, corev1.ConditionFalse, node.Status.Conditions[0].Status)
+	assert.Equal(t, plugin.ReasonPluginStopped, node.Status.Conditions[0].Reason)
+}
+
+func TestNodeReporter_SetReadyRetriesConflicts(t *testing.T) {
+	client := fake.NewSimpleClientset(newFakeNode("worker-0"))
+	conflicts := 2
+	client.PrependReactor("update", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "status" || conflicts == 0 {
+			return false, nil, nil
+		}
+		conflicts--
+		return true, nil, apierrors.NewConflict(corev1.Resource("nodes"), "worker-0", errors.New("the node status changed"))
+	})
+	r := plugin.NewNodeReporter(client, "worker-0", 10, 10)
+
+	r.SetReady(true, plugin.ReasonPluginRegistered, "registered")
+	node, err := client.CoreV1().Nodes().Get(context.Background(), "worker-0", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Zero(t, conflicts)
+	assert.Len(t, node.Status.Conditions, 1, "the condition is written once the kubelet's updates are read")
+	assert.Equal(t, corev1.ConditionTrue, node.Status.Conditions[0].Status)
+}
+
+func TestNodeReporter_Nil(t *testing.T) {
+	var r *plugin.NodeReporter
+	r.Event(corev1.EventTypeNormal, plugin.ReasonDeviceAdded, "ignored")
+	r.ObserveDevices([]string{"dm-0"})
+	r.SetReady(true, plugin.ReasonPluginRegistered, "ignored")
+	r.Flush()
+}
+
+func TestAllocate_RecordsRejectionEvent(t *testing.T) {
+	client := fake.NewSimpleClientset(newFakeNode("worker-0"))
+	scanner := mockScanner{config: &api.DevicePluginConfig{}}
+	p := &plugin.PowerPlugin{
+		Scanner:     scanner,
+		Config:      scanner.config,
+		DeviceUsage: map[string]int{},
+		Reporter:    plugin.NewNodeReporter(client, "worker-0", 10, 10),
+	}
+
+	_, err := p.Allocate(context.Background(), &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIds: []string{"sda"}}},
+	})
+	assert.Error(t, err)
+	p.Reporter.Flush()
+
+	events := listEvents(t, client)
+	assert.Len(t, events, 1)
+	assert.Equal(t, plugin.ReasonAllocationRejected, events[0].Reason)
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	inventoryfake "github.com/ocp-power-demos/power-dev-plugin/pkg/client/clientset/versioned/fake"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// hookModeEnv selects how the test binary behaves when it runs as the discovery hook
+const hookModeEnv = "POWER_DEV_TEST_HOOK"
+
+// TestDiscoveryHookProcess is not a test: the other tests run the test binary as the discovery hook,
+// which then behaves as hookModeEnv says. It acts as a CMDB filter accepting the mpatha LUN.
+func TestDiscoveryHookProcess(t *testing.T) {
+	mode := os.Getenv(hookModeEnv)
+	if mode == "" {
+		return
+	}
+	var input plugin.HookDevices
+	if err := json.NewDecoder(os.Stdin).Decode(&input); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid input: %v\n", err)
+		os.Exit(2)
+	}
+
+	output := plugin.HookDevices{Devices: []plugin.HookDevice{}}
+	switch mode {
+	case "cmdb":
+		for _, dev := range input.Devices {
+			if dev.Attributes != nil && dev.Attributes.DMName == "mpatha" {
+				dev.Annotations = map[string]string{"cmdb-id": "LUN-0042", "owner": "db-team"}
+				output.Devices = append(output.Devices, dev)
+			}
+		}
+		// a hook cannot add devices the rules did not allow
+		output.Devices = append(output.Devices, plugin.HookDevice{Path: "/dev/sda3"}, plugin.HookDevice{Path: "/dev/dm-7"})
+	case "fail":
+		fmt.Fprintln(os.Stderr, "CMDB export /etc/cmdb/luns.csv not found")
+		os.Exit(3)
+	case "hang":
+		time.Sleep(time.Minute)
+	case "garbage":
+		fmt.Print("dm-0 dm-1")
+		os.Exit(0)
+	case "env":
+		output.Devices = append(output.Devices, plugin.HookDevice{
+			Path: input.Devices[0].Path, Annotations: map[string]string{"host-root": os.Getenv("POWER_DEV_HOST_ROOT")},
+		})
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(output); err != nil {
+		os.Exit(2)
+	}
+	os.Exit(0)
+}
+
+// hookConfig allows the dm and NVMe devices of powerHost and runs the test binary as the hook in mode
+func hookConfig(t *testing.T, mode string, timeout string) *api.DevicePluginConfig {
+	t.Setenv(hookModeEnv, mode)
+	return &api.DevicePluginConfig{
+		IncludeDevices: []string{"/dev/dm-*", "/dev/nvme*"},
+		DiscoveryHook: &api.DiscoveryHook{
+			Command: []string{os.Args[0], "-test.run=^TestDiscoveryHookProcess$"},
+			Timeout: timeout,
+		},
+	}
+}
+
+func TestDiscoveryHook_Scan(t *testing.T) {
+	allowed := []string{"dm-0", "dm-1", "nvme0n1p1", "nvme0n1p2", "nvme0n1"}
+	tests := []struct {
+		name     string
+		mode     string
+		timeout  string
+		expected []string
+	}{
+		{"accepts and annotates a subset", "cmdb", "", []string{"dm-0"}},
+		{"non-zero exit keeps the rules result", "fail", "", allowed},
+		{"timeout keeps the rules result", "hang", "200ms", allowed},
+		{"invalid output keeps the rules result", "garbage", "", allowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := hostConfigScanner{HostScanner: powerHost(t).Scanner(), config: hookConfig(t, tt.mode, tt.timeout)}
+			start := time.Now()
+			devices, err := plugin.ScanRootForDevicesWithDeps(scanner, false)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, devices)
+			assert.Less(t, time.Since(start), 10*time.Second)
+		})
+	}
+}
+
+func TestRunDiscoveryHook(t *testing.T) {
+	config := hookConfig(t, "fail", "")
+	_, err := plugin.RunDiscoveryHook(context.Background(), config.DiscoveryHook, []plugin.HookDevice{{Path: "/dev/dm-0"}})
+	assert.ErrorContains(t, err, "exited with status 3: CMDB export /etc/cmdb/luns.csv not found")
+
+	t.Setenv(hookModeEnv, "hang")
+	config.DiscoveryHook.Timeout = "100ms"
+	_, err = plugin.RunDiscoveryHook(context.Background(), config.DiscoveryHook, []plugin.HookDevice{{Path: "/dev/dm-0"}})
+	assert.ErrorContains(t, err, "did not finish within 100ms")
+
+	t.Setenv(hookModeEnv, "env")
+	config.DiscoveryHook.Timeout = ""
+	plugin.SetHostRoot("/host")
+	t.Cleanup(func() { plugin.SetHostRoot("") })
+	devices, err := plugin.RunDiscoveryHook(context.Background(), config.DiscoveryHook, []plugin.HookDevice{{Path: "/dev/dm-0"}})
+	require.NoError(t, err)
+	assert.Equal(t, []plugin.HookDevice{{Path: "/dev/dm-0", Annotations: map[string]string{"host-root": "/host"}}}, devices)
+
+	_, err = plugin.RunDiscoveryHook(context.Background(), &api.DiscoveryHook{Command: []string{"/nonexistent/hook"}}, nil)
+	assert.ErrorContains(t, err, "unable to run discovery hook")
+}
+
+func TestDiscoveryHook_Plugin(t *testing.T) {
+	config := hookConfig(t, "cmdb", "")
+	client := fake.NewSimpleClientset(newFakeNode("worker-0"))
+	p := &plugin.PowerPlugin{
+		Scanner:     hostConfigScanner{HostScanner: powerHost(t).Scanner(), config: config},
+		Config:      config,
+		DeviceUsage: map[string]int{},
+		Reporter:    plugin.NewNodeReporter(client, "worker-0", 10, 10),
+		Inventory:   plugin.NewInventoryReporter(inventoryfake.NewSimpleClientset(), "worker-0"),
+	}
+
+	devices, err := p.Rescan()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dm-0"}, devices)
+	status := p.Inventory.Status()
+	require.Len(t, status.Devices, 1)
+	assert.Equal(t, map[string]string{"cmdb-id": "LUN-0042", "owner": "db-team"}, status.Devices[0].Annotations)
+
+	t.Setenv(hookModeEnv, "fail")
+	devices, err = p.Rescan()
+	require.NoError(t, err)
+	assert.Len(t, devices, 5, "the devices the rules allowed are advertised when the hook fails")
+	p.Reporter.Flush()
+	assert.Contains(t, eventReasons(t, client), plugin.ReasonDiscoveryHookFailed)
+	for _, dev := range p.Inventory.Status().Devices {
+		assert.Empty(t, dev.Annotations)
+	}
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"errors"
+	"testing"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/ocp-power-demos/power-dev-plugin/tests/fakehost"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	gi         = 1 << 30
+	mpathaWWID = "36005076810810261f800000000000a1b"
+)
+
+// powerHost is a Power LPAR: a vSCSI boot disk the host runs on, an FC LUN with two paths
+// grouped into mpatha and partitioned by kpartx, an NVMe scratch disk, loop devices and nx-gzip
+func powerHost(t *testing.T) *fakehost.Host {
+	return fakehost.New(t).
+		AddDisk(fakehost.Disk{
+			Name: "sda", Transport: fakehost.TransportVSCSI, SizeBytes: 100 * gi, Vendor: "AIX", Model: "VDASD", Rotational: true,
+			Partitions: []fakehost.Partition{
+				{SizeBytes: 4 << 20},
+				{SizeBytes: 1 * gi, FSType: "xfs", Label: "boot"},
+				{SizeBytes: 95 * gi, FSType: "xfs", Label: "root"},
+				{SizeBytes: 4 * gi, FSType: "swap"},
+			},
+		}).
+		AddDisk(fakehost.Disk{Name: "sdb", Transport: fakehost.TransportFC, SizeBytes: 500 * gi, Vendor: "IBM", Model: "2145", WWN: "0x" + mpathaWWID}).
+		AddDisk(fakehost.Disk{Name: "sdc", Transport: fakehost.TransportFC, SizeBytes: 500 * gi, Vendor: "IBM", Model: "2145", WWN: "0x" + mpathaWWID}).
+		AddMultipath("dm-0", "mpatha", mpathaWWID, "sdb", "sdc").
+		AddMultipathPartition("dm-1", "dm-0", 1, 500*gi).
+		AddDisk(fakehost.Disk{
+			Name: "nvme0n1", SizeBytes: 1024 * gi, Model: "Micron_7450", Serial: "MSN123",
+			Partitions: []fakehost.Partition{{SizeBytes: 512 * gi}, {SizeBytes: 512 * gi, FSType: "xfs", Label: "scratch"}},
+		}).
+		AddLoop("loop0", 1*gi, "/var/lib/images/disk.img").
+		AddLoop("loop1", 0, "").
+		AddNxGzip().
+		Mount("sda2", "/boot", "xfs").
+		Mount("sda3", "/", "xfs").
+		Swap("sda4")
+}
+
+// hostConfigScanner is a HostScanner with an in-memory config
+type hostConfigScanner struct {
+	*plugin.HostScanner
+	config *api.DevicePluginConfig
+}
+
+func (s hostConfigScanner) LoadConfig() (*api.DevicePluginConfig, error) {
+	return s.config, nil
+}
+
+func TestHostScanner_GetBlockDevices(t *testing.T) {
+	devices, err := powerHost(t).Scanner().GetBlockDevices()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"/dev/dm-0", "/dev/dm-1", "/dev/loop0",
+		"/dev/nvme0n1p1", "/dev/nvme0n1p2", "/dev/nvme0n1",
+		"/dev/sda1", "/dev/sda2", "/dev/sda3", "/dev/sda4", "/dev/sda",
+		"/dev/sdb", "/dev/sdc",
+	}, devices, "the unused loop1 is skipped")
+}
+
+func TestHostScanner_FindAndStatDevices(t *testing.T) {
+	scanner := powerHost(t).Scanner()
+
+	found, err := scanner.FindDevices("/dev/dm-*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dev/dm-0", "/dev/dm-1"}, found, "host paths, not paths in the tree")
+
+	assert.NoError(t, scanner.StatDevice("/dev/crypto/nx-gzip"))
+	assert.Error(t, scanner.StatDevice("/dev/sdz"))
+}
+
+func TestScanRootForDevices_FakeHost(t *testing.T) {
+	host := powerHost(t)
+	config := &api.DevicePluginConfig{
+		IncludeDevices: []string{"/dev/dm-*", "/dev/sd*", "/dev/nvme*"},
+		ExcludeDevices: []string{"/dev/disk/by-label/scratch"},
+		MultipathMode:  plugin.MultipathModeDM,
+	}
+
+	devices, err := plugin.ScanRootForDevicesWithDeps(hostConfigScanner{HostScanner: host.Scanner(), config: config}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dm-0", "nvme0n1p1", "nvme0n1"}, devices,
+		"the boot disk is guarded, the paths and partition of mpatha are grouped and the scratch partition is excluded by label")
+}
+
+func TestHostScanner_MultipathMaps(t *testing.T) {
+	host := powerHost(t).SetPathState("sdc", "offline")
+
+	maps, err := host.Scanner().MultipathMaps()
+	require.NoError(t, err)
+	require.Len(t, maps, 1)
+	m := maps["dm-0"]
+	assert.Equal(t, "mpatha", m.Alias)
+	assert.Equal(t, "mpath-"+mpathaWWID, m.UUID)
+	assert.Equal(t, []plugin.MultipathPath{{Name: "sdb", State: "running"}, {Name: "sdc", State: "offline"}}, m.Paths)
+	assert.Equal(t, []string{"dm-1"}, m.Holders)
+	assert.Equal(t, 1, m.ActivePaths())
+}
+
+func TestHostScanner_ProtectedDevices(t *testing.T) {
+	protected, err := powerHost(t).Scanner().ProtectedDevices()
+	require.NoError(t, err)
+	assert.Equal(t, "mounted at /", protected["sda3"])
+	assert.Equal(t, "swap", protected["sda4"])
+	for _, name := range []string{"sda", "sda1", "sda2"} {
+		assert.Contains(t, protected, name)
+	}
+	for _, name := range []string{"sdb", "dm-0", "nvme0n1"} {
+		assert.NotContains(t, protected, name)
+	}
+}
+
+func TestHostScanner_ProtectedDevices_Volumes(t *testing.T) {
+	host := fakehost.New(t).
+		AddDisk(fakehost.Disk{Name: "sda", SizeBytes: 100 * gi, Partitions: []fakehost.Partition{{SizeBytes: 100 * gi, FSType: "xfs"}}}).
+		AddDisk(fakehost.Disk{Name: "sdb", SizeBytes: 100 * gi, Partitions: []fakehost.Partition{{SizeBytes: 100 * gi, FSType: "LVM2_member"}}}).
+		AddDisk(fakehost.Disk{Name: "sdc", SizeBytes: 100 * gi}).
+		AddDisk(fakehost.Disk{Name: "sdd", SizeBytes: 100 * gi}).
+		AddDisk(fakehost.Disk{Name: "sde", SizeBytes: 100 * gi}).
+		AddDisk(fakehost.Disk{Name: "sdf", SizeBytes: 100 * gi}).
+		AddDisk(fakehost.Disk{Name: "sdg", SizeBytes: 100 * gi}).
+		AddLogicalVolume("dm-0", "datavg", "backup", "sdb1").
+		AddMDArray("md0", "clean", "sdc", "sdd").
+		AddMDArray("md1", "inactive", "sde", "sdf").
+		Mount("sda1", "/", "xfs")
+
+	protected, err := host.Scanner().ProtectedDevices()
+	require.NoError(t, err)
+	assert.Equal(t, "logical volume of an active volume group", protected["dm-0"], "nothing on datavg is mounted")
+	assert.Equal(t, "backs host device dm-0", protected["sdb1"])
+	assert.Contains(t, protected, "sdb", "the disk of the PV")
+	assert.Equal(t, "active md array", protected["md0"])
+	for _, name := range []string{"sdc", "sdd"} {
+		assert.Equal(t, "backs host device md0", protected[name])
+	}
+	for _, name := range []string{"md1", "sde", "sdf", "sdg"} {
+		assert.NotContains(t, protected, name)
+	}
+}
+
+// unknownSystemDevicesScanner is a host whose system devices cannot be determined
+type unknownSystemDevicesScanner struct {
+	hostConfigScanner
+}
+
+func (s unknownSystemDevicesScanner) ProtectedDevices() (map[string]string, error) {
+	return nil, errors.New("mountinfo: permission denied")
+}
+
+func TestScanRootForDevices_GuardFailsClosed(t *testing.T) {
+	config := &api.DevicePluginConfig{
+		IncludeDevices:     []string{"/dev/dm-*", "/dev/nvme*"},
+		AllowSystemDevices: []string{"/dev/nvme0n1"},
+	}
+	client := fake.NewSimpleClientset(newFakeNode("worker-0"))
+	p := &plugin.PowerPlugin{
+		Scanner:     unknownSystemDevicesScanner{hostConfigScanner{HostScanner: powerHost(t).Scanner(), config: config}},
+		Config:      config,
+		DeviceUsage: map[string]int{},
+		Reporter:    plugin.NewNodeReporter(client, "worker-0", 100, 100),
+	}
+
+	devices, err := p.Rescan()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"nvme0n1"}, devices, "only allow-system-devices without knowing the host system devices")
+
+	p.Reporter.Flush()
+	events := listEvents(t, client)
+	require.Len(t, events, 1)
+	assert.Equal(t, plugin.ReasonSystemDevicesUnknown, events[0].Reason)
+}
+
+func TestHostScanner_DeviceAliases(t *testing.T) {
+	aliases, err := powerHost(t).Scanner().DeviceAliases()
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"/dev/disk/by-id/dm-name-mpatha",
+		"/dev/disk/by-id/dm-uuid-mpath-" + mpathaWWID,
+		"/dev/mapper/mpatha",
+	}, aliases["dm-0"])
+	assert.Equal(t, []string{"/dev/disk/by-label/scratch"}, aliases["nvme0n1p2"])
+}
+
+func TestHostScanner_DeviceAttributes(t *testing.T) {
+	attrs, err := powerHost(t).Scanner().DeviceAttributes([]string{"/dev/sda", "/dev/sdb", "/dev/dm-0", "/dev/nvme0n1", "/dev/nvme0n1p2", "/dev/sdz"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		expected plugin.DeviceAttributes
+	}{
+		{"sda", plugin.DeviceAttributes{Name: "sda", Type: plugin.DeviceTypeDisk, SizeBytes: 100 * gi, Vendor: "AIX", Model: "VDASD", Transport: "vscsi", Rotational: true}},
+		{"sdb", plugin.DeviceAttributes{Name: "sdb", Type: plugin.DeviceTypeDisk, SizeBytes: 500 * gi, Vendor: "IBM", Model: "2145", WWN: "0x" + mpathaWWID, Transport: "fc"}},
+		{"dm-0", plugin.DeviceAttributes{Name: "dm-0", Type: plugin.DeviceTypeDisk, SizeBytes: 500 * gi, Vendor: "IBM", Model: "2145", WWN: "0x" + mpathaWWID,
+			DMName: "mpatha", DMUUID: "mpath-" + mpathaWWID, Transport: "fc"}},
+		{"nvme0n1", plugin.DeviceAttributes{Name: "nvme0n1", Type: plugin.DeviceTypeDisk, SizeBytes: 1024 * gi, Model: "Micron_7450", Serial: "MSN123", Transport: "nvme"}},
+		{"nvme0n1p2", plugin.DeviceAttributes{Name: "nvme0n1p2", Type: plugin.DeviceTypePartition, SizeBytes: 512 * gi, Model: "Micron_7450", Serial: "MSN123",
+			FSType: "xfs", Label: "scratch", Transport: "nvme"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Contains(t, attrs, tt.name)
+			assert.Equal(t, tt.expected, *attrs[tt.name])
+		})
+	}
+	assert.NotContains(t, attrs, "sdz")
+}
+
+func TestHostRoot(t *testing.T) {
+	t.Cleanup(func() { plugin.SetHostRoot("") })
+
+	t.Setenv("GHW_CHROOT", "")
+	assert.Equal(t, "/", plugin.HostRoot())
+	t.Setenv("GHW_CHROOT", "/host")
+	assert.Equal(t, "/host", plugin.HostRoot())
+	plugin.SetHostRoot("/mnt/host/")
+	assert.Equal(t, "/mnt/host", plugin.HostRoot(), "the flag wins over GHW_CHROOT")
+}
+
+func TestNewDeviceScanner_ReadsHostRoot(t *testing.T) {
+	host := powerHost(t)
+	plugin.SetHostRoot(host.Root)
+	t.Cleanup(func() { plugin.SetHostRoot("") })
+
+	scanner := plugin.NewDeviceScanner()
+	found, err := scanner.FindDevices("/dev/dm-*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dev/dm-0", "/dev/dm-1"}, found, "include patterns are globbed on the host")
+	assert.NoError(t, scanner.StatDevice("/dev/crypto/nx-gzip"), "and stat'ed on the host")
+	assert.Error(t, scanner.StatDevice("/dev/sdz"))
+
+	protected, err := plugin.NewSystemDeviceGuard().ProtectedDevices()
+	require.NoError(t, err)
+	assert.Equal(t, "mounted at /", protected["sda3"], "the guard reads the mounts of the host tree")
+
+	fs := plugin.HostFS{Root: host.Root}
+	assert.Equal(t, host.Path("/dev/dm-0"), fs.Path("/dev/dm-0"))
+	assert.Equal(t, "/dev/dm-0", fs.HostPath(host.Path("/dev/dm-0")))
+}
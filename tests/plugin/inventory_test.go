@@ -0,0 +1,117 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ocp-power-demos/power-dev-plugin/api/v1alpha1"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/client/clientset/versioned/fake"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func getInventory(t *testing.T, client *fake.Clientset, name string) *v1alpha1.PowerDeviceInventory {
+	inventory, err := client.PowerV1alpha1().PowerDeviceInventories().Get(context.Background(), name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	return inventory
+}
+
+func countUpdates(client *fake.Clientset) int {
+	updates := 0
+	for _, action := range client.Actions() {
+		if action.Matches("update", "powerdeviceinventories") {
+			if action.(k8stesting.UpdateAction).GetSubresource() == "status" {
+				updates++
+			}
+		}
+	}
+	return updates
+}
+
+func TestInventoryReporter_Status(t *testing.T) {
+	r := plugin.NewInventoryReporter(fake.NewSimpleClientset(), "worker-0")
+	r.ObserveScan([]string{"dm-1", "/dev/dm-0", "sda"}, time.Now())
+	r.ObserveUsage(map[string]int{"/dev/dm-0": 2, "/dev/sdz": 1})
+	r.ObserveHealth("sda", "Unhealthy")
+	r.ObserveReserved([]string{"/dev/sda"})
+
+	status := r.Status()
+	assert.Equal(t, 3, status.DeviceCount)
+	assert.Equal(t, 1, status.AllocatedCount)
+	assert.Equal(t, []v1alpha1.DeviceStatus{
+		{Name: "dm-0", Path: "/dev/dm-0", Health: "Healthy", Pool: "power-dev-plugin/dev", Allocations: 2},
+		{Name: "dm-1", Path: "/dev/dm-1", Health: "Healthy", Pool: "power-dev-plugin/dev", Allocations: 0},
+		{Name: "sda", Path: "/dev/sda", Health: "Unhealthy", Pool: plugin.PoolReserved, Allocations: 0},
+	}, status.Devices)
+}
+
+func TestInventoryReporter_Sync(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	r := plugin.NewInventoryReporter(client, "worker-0")
+	r.ObserveScan([]string{"dm-0"}, time.Now())
+
+	// creates the inventory for the node
+	assert.NoError(t, r.Sync(false))
+	inventory := getInventory(t, client, "worker-0")
+	assert.Equal(t, "worker-0", inventory.Spec.NodeName)
+	assert.Equal(t, 1, inventory.Status.DeviceCount)
+	assert.Equal(t, 1, countUpdates(client))
+
+	// unchanged state is not written again unless forced
+	assert.NoError(t, r.Sync(false))
+	assert.Equal(t, 1, countUpdates(client))
+	assert.NoError(t, r.Sync(true))
+	assert.Equal(t, 2, countUpdates(client))
+
+	// allocations are reflected on change
+	r.ObserveUsage(map[string]int{"/dev/dm-0": 1})
+	assert.NoError(t, r.Sync(false))
+	assert.Equal(t, 1, getInventory(t, client, "worker-0").Status.AllocatedCount)
+
+	// a deleted inventory is recreated on the next sync
+	assert.NoError(t, client.PowerV1alpha1().PowerDeviceInventories().Delete(context.Background(), "worker-0", metav1.DeleteOptions{}))
+	assert.NoError(t, r.Sync(true))
+	assert.Equal(t, 1, getInventory(t, client, "worker-0").Status.DeviceCount)
+}
+
+func TestInventoryReporter_Run(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	r := plugin.NewInventoryReporter(client, "worker-0")
+	stop := make(chan interface{})
+	defer close(stop)
+	go r.Run(stop)
+
+	r.ObserveScan([]string{"dm-0", "dm-1"}, time.Now())
+	assert.Eventually(t, func() bool {
+		inventory, err := client.PowerV1alpha1().PowerDeviceInventories().Get(context.Background(), "worker-0", metav1.GetOptions{})
+		return err == nil && inventory.Status.DeviceCount == 2
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestInventoryReporter_Nil(t *testing.T) {
+	var r *plugin.InventoryReporter
+	r.ObserveScan([]string{"dm-0"}, time.Now())
+	r.ObserveUsage(map[string]int{})
+	r.ObserveHealth("dm-0", "Healthy")
+	r.ObserveReserved([]string{"dm-0"})
+	assert.NoError(t, r.Sync(true))
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/ocp-power-demos/power-dev-plugin/tests/fakekubelet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const lifecycleTimeout = 5 * time.Second
+
+// servePlugin starts a fake kubelet and a plugin registered with it, and connects to the plugin
+func servePlugin(t *testing.T, devices []string) (*fakekubelet.Kubelet, *plugin.PowerPlugin, *fakekubelet.Plugin) {
+	dir := t.TempDir()
+	kubelet, err := fakekubelet.New(dir)
+	require.NoError(t, err)
+	t.Cleanup(kubelet.Stop)
+
+	p, err := plugin.NewWithPluginDir(dir)
+	require.NoError(t, err)
+	p.Scanner = mockScanner{devices: devices}
+	p.Policy = plugin.UpperLimitSharedPolicy{}
+	p.SocketHealthInterval = 20 * time.Millisecond
+	require.NoError(t, p.Serve())
+	t.Cleanup(func() { p.Stop() })
+
+	req, err := kubelet.WaitForRegistration(lifecycleTimeout)
+	require.NoError(t, err)
+	client, err := kubelet.Connect(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return kubelet, p, client
+}
+
+// noLeakedGoroutines fails t when goroutines started by the test outlive its cleanup, e.g. a
+// controller left running by Stop. It must be called first, so its check runs after the other cleanups.
+func noLeakedGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+	t.Cleanup(func() {
+		// polled here, assert.Eventually would add a goroutine of its own
+		deadline := time.Now().Add(lifecycleTimeout)
+		for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.LessOrEqual(t, runtime.NumGoroutine(), before, "goroutines leaked")
+	})
+}
+
+func TestLifecycle_RegisterListAndAllocate(t *testing.T) {
+	noLeakedGoroutines(t)
+	_, p, client := servePlugin(t, []string{"/dev/dm-3", "/dev/dm-4"})
+	assert.Equal(t, "power-dev-plugin/dev", client.ResourceName)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watch, err := client.ListAndWatch(ctx)
+	require.NoError(t, err)
+	devices, err := watch.Next(lifecycleTimeout)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dm-3", "dm-4"}, deviceIDs(devices))
+
+	resp, err := client.Allocate(ctx, []string{"dm-4"})
+	require.NoError(t, err)
+	require.Len(t, resp.ContainerResponses, 1)
+	assert.Equal(t, "/dev/dm-4", resp.ContainerResponses[0].Devices[0].HostPath)
+
+	require.NoError(t, p.Stop())
+	assert.True(t, watch.WaitClosed(lifecycleTimeout), "stopping the plugin ends ListAndWatch")
+	assert.NoFileExists(t, p.SocketPath())
+}
+
+func TestLifecycle_SocketDeleted(t *testing.T) {
+	tests := []struct {
+		name   string
+		delete func(kubelet *fakekubelet.Kubelet, p *plugin.PowerPlugin) error
+	}{
+		{
+			name:   "Kubelet restart",
+			delete: func(kubelet *fakekubelet.Kubelet, _ *plugin.PowerPlugin) error { return kubelet.Restart() },
+		},
+		{
+			name: "Plugin socket removed",
+			delete: func(kubelet *fakekubelet.Kubelet, p *plugin.PowerPlugin) error {
+				return kubelet.DeleteSocket(p.SocketPath())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			noLeakedGoroutines(t)
+			kubelet, p, client := servePlugin(t, []string{"/dev/dm-3"})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			watch, err := client.ListAndWatch(ctx)
+			require.NoError(t, err)
+			_, err = watch.Next(lifecycleTimeout)
+			require.NoError(t, err)
+
+			require.NoError(t, tt.delete(kubelet, p))
+			assert.True(t, watch.WaitClosed(lifecycleTimeout), "the plugin stops once a socket is gone")
+			assert.NoFileExists(t, p.SocketPath())
+		})
+	}
+}
+
+func TestLifecycle_ServeAfterStop(t *testing.T) {
+	noLeakedGoroutines(t)
+	kubelet, p, client := servePlugin(t, []string{"/dev/dm-3"})
+	require.NoError(t, p.Stop())
+	client.Close()
+
+	require.NoError(t, p.Serve(), "a stopped plugin serves again")
+	req, err := kubelet.WaitForRegistration(lifecycleTimeout)
+	require.NoError(t, err)
+	client, err = kubelet.Connect(req)
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watch, err := client.ListAndWatch(ctx)
+	require.NoError(t, err)
+	devices, err := watch.Next(lifecycleTimeout)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dm-3"}, deviceIDs(devices))
+	assert.False(t, watch.WaitClosed(100*time.Millisecond), "ListAndWatch waits for the next change")
+
+	resp, err := client.Allocate(ctx, []string{"dm-3"})
+	require.NoError(t, err)
+	assert.Equal(t, "/dev/dm-3", resp.ContainerResponses[0].Devices[0].HostPath)
+	assert.Equal(t, map[string]int{"/dev/dm-3": 1}, p.Usage(), "the new controller records the grants")
+
+	require.NoError(t, p.Stop())
+	assert.True(t, watch.WaitClosed(lifecycleTimeout), "stopping the plugin again ends ListAndWatch")
+}
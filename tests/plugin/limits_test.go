@@ -0,0 +1,178 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func TestUpperLimitPolicy_Limit(t *testing.T) {
+	config := &api.DevicePluginConfig{
+		UpperLimitPerDevice: 2,
+		UpperLimitRules: []api.UpperLimitRule{
+			{Comment: "oracle data", Glob: "/dev/mapper/oradata_*", UpperLimit: 8},
+			{Comment: "broken", Regex: "(", UpperLimit: 1},
+			{Comment: "fenced", Glob: "/dev/sdz", UpperLimit: -3},
+			{Comment: "scratch", Selector: &api.DeviceSelector{Model: "scratch"}, UpperLimit: 0},
+		},
+	}
+	aliases := plugin.DeviceAliases{"dm-3": {"/dev/mapper/oradata_01"}}
+	attrs := map[string]*plugin.DeviceAttributes{"sdc": {Model: "scratch"}}
+
+	tests := []struct {
+		dev      string
+		expected int
+	}{
+		{"/dev/dm-3", 8},
+		{"/dev/dm-4", 2},
+		{"/dev/sdz", 2},
+		{"/dev/sdc", plugin.Unlimited},
+	}
+	policy := plugin.NewUpperLimitPolicy(config, nil)
+	for _, tt := range tests {
+		t.Run(tt.dev, func(t *testing.T) {
+			name := tt.dev[len("/dev/"):]
+			assert.Equal(t, tt.expected, policy.Limit(tt.dev, aliases, attrs[name]))
+		})
+	}
+
+	assert.Equal(t, plugin.Unlimited, plugin.NewUpperLimitPolicy(nil, nil).Default())
+	assert.Equal(t, plugin.Unlimited, plugin.NewUpperLimitPolicy(&api.DevicePluginConfig{UpperLimitPerDevice: -1}, nil).Default(),
+		"a negative upper-limit is ignored")
+
+	classes := plugin.NewUpperLimitPolicy(&api.DevicePluginConfig{
+		UpperLimitPerDevice: 2,
+		DeviceClasses:       []api.DeviceClass{{Name: "console", Glob: "/dev/hvcs*", UpperLimit: -1}},
+	}, map[string]string{"hvcs0": "console"})
+	assert.False(t, classes.HasRules(), "a class with a negative upper-limit gets no limit rule")
+	assert.Equal(t, 2, classes.Limit("/dev/hvcs0", nil, nil))
+	assert.Equal(t, plugin.Unlimited, plugin.NewUpperLimitPolicy(&api.DevicePluginConfig{}, nil).Default())
+}
+
+func TestReservedDevices(t *testing.T) {
+	devices := []string{"/dev/dm-4", "/dev/dm-1", "sdb", "/dev/dm-3"}
+
+	available, reserved := plugin.ReservedDevices(devices, 2, nil)
+	assert.Equal(t, []string{"/dev/dm-1", "/dev/dm-3"}, available, "order of the remaining devices is kept")
+	assert.Equal(t, []string{"/dev/dm-4", "sdb"}, reserved, "the last devices in name order are reserved")
+
+	available, reserved = plugin.ReservedDevices(devices, 0, nil)
+	assert.Equal(t, devices, available)
+	assert.Empty(t, reserved)
+
+	available, reserved = plugin.ReservedDevices(devices, 10, nil)
+	assert.Empty(t, available)
+	assert.Equal(t, devices, reserved)
+
+	devices = []string{"/dev/dm-4", "/dev/vfio/12", "/dev/dm-1", "/dev/tpmrm0", "sdb"}
+	classes := map[string]string{"vfio/12": "passthrough", "tpmrm0": "tpm"}
+	available, reserved = plugin.ReservedDevices(devices, 2, classes)
+	assert.Equal(t, []string{"/dev/vfio/12", "/dev/dm-1", "/dev/tpmrm0"}, available)
+	assert.Equal(t, []string{"/dev/dm-4", "sdb"}, reserved, "the reserve is taken from the block devices")
+
+	available, reserved = plugin.ReservedDevices(devices, 10, classes)
+	assert.Equal(t, []string{"/dev/vfio/12", "/dev/tpmrm0"}, available, "class devices are never reserved")
+	assert.Equal(t, []string{"/dev/dm-4", "/dev/dm-1", "sdb"}, reserved)
+}
+
+func TestAdvertisedDevices_Capacity(t *testing.T) {
+	devices := []string{"/dev/dm-3", "/dev/dm-4", "sdb"}
+	config := &api.DevicePluginConfig{
+		Replicas:            4,
+		UpperLimitPerDevice: 3,
+		UpperLimitRules:     []api.UpperLimitRule{{Glob: "/dev/mapper/oradata_01", UpperLimit: 1}},
+		ReservedDevices:     1,
+	}
+	scanner := mockRuleScanner{aliases: plugin.DeviceAliases{"dm-3": {"/dev/mapper/oradata_01"}}}
+
+	advertised := plugin.AdvertisedDevices(devices, config, nil, scanner, healthy)
+	assert.Equal(t, []string{"dm-3", "dm-4::0", "dm-4::1", "dm-4::2"}, deviceIDs(advertised),
+		"sdb is reserved and no device is advertised as more replicas than its upper limit")
+}
+
+func TestAllocate_UpperLimitRejection(t *testing.T) {
+	config := &api.DevicePluginConfig{
+		UpperLimitPerDevice: 1,
+		UpperLimitRules:     []api.UpperLimitRule{{Glob: "/dev/dm-3", UpperLimit: 2}},
+		AllocationPolicy:    plugin.PolicyUpperLimitShared,
+	}
+	scanner := mockScanner{devices: []string{"/dev/dm-3", "/dev/dm-4"}, config: config}
+	p := &plugin.PowerPlugin{
+		Scanner:     scanner,
+		Config:      config,
+		DeviceUsage: map[string]int{},
+	}
+	req := &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIds: []string{"dm-3"}}},
+	}
+
+	_, err := p.Allocate(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"/dev/dm-3": 1}, p.Usage())
+
+	resp, err := p.Allocate(context.Background(), req)
+	assert.NoError(t, err, "dm-3 has a limit of 2")
+	assert.Len(t, resp.ContainerResponses[0].Devices, 1)
+	assert.Equal(t, "/dev/dm-3", resp.ContainerResponses[0].Devices[0].HostPath)
+
+	_, err = p.Allocate(context.Background(), &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIds: []string{"dm-4", "dm-3"}}},
+	})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Contains(t, err.Error(), "/dev/dm-3 (2/2)")
+	assert.Equal(t, map[string]int{"/dev/dm-3": 2}, p.Usage(), "a rejection takes nothing")
+}
+
+func TestAllocate_ReservedDevices(t *testing.T) {
+	config := &api.DevicePluginConfig{ReservedDevices: 1, AllocationPolicy: plugin.PolicyUpperLimitShared}
+	scanner := mockScanner{devices: []string{"/dev/dm-3", "/dev/dm-4"}, config: config}
+	p := &plugin.PowerPlugin{
+		Scanner:     scanner,
+		Config:      config,
+		DeviceUsage: map[string]int{},
+	}
+
+	resp, err := p.Allocate(context.Background(), &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIds: []string{"dm-3"}}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, resp.ContainerResponses[0].Devices, 1)
+	assert.Equal(t, "/dev/dm-3", resp.ContainerResponses[0].Devices[0].HostPath)
+
+	_, err = p.Allocate(context.Background(), &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIds: []string{"dm-4"}}},
+	})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Contains(t, err.Error(), "/dev/dm-4 requested for container 0 is reserved")
+
+	config.ReservedDevices = 2
+	config.AllocationPolicy = plugin.PolicyGrantAll
+	_, err = p.Allocate(context.Background(), &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIds: []string{"dm-3"}}},
+	})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Contains(t, err.Error(), "2 reserved")
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	inventoryfake "github.com/ocp-power-demos/power-dev-plugin/pkg/client/clientset/versioned/fake"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// writeSysfs creates files under root, mapping relative path to content
+func writeSysfs(t *testing.T, root string, files map[string]string) {
+	for path, content := range files {
+		full := filepath.Join(root, path)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(full), 0755))
+		assert.NoError(t, os.WriteFile(full, []byte(content), 0644))
+	}
+}
+
+// fakeMultipathSysfs has mpatha (dm-0) over sda/sdb with partition dm-1 holding the lvm dm-3,
+// and a non-multipath dm-2 (lvm)
+func fakeMultipathSysfs(t *testing.T, sdbState string) string {
+	root := t.TempDir()
+	writeSysfs(t, root, map[string]string{
+		"block/dm-0/dm/uuid":        "mpath-36005076810810261f800000000000a1b\n",
+		"block/dm-0/dm/name":        "mpatha\n",
+		"block/dm-0/slaves/sda/dev": "8:0",
+		"block/dm-0/slaves/sdb/dev": "8:16",
+		"block/dm-0/holders/dm-1/x": "",
+		"block/dm-1/dm/uuid":        "part1-mpath-36005076810810261f800000000000a1b\n",
+		"block/dm-1/dm/name":        "mpatha1\n",
+		"block/dm-1/holders/dm-3/x": "",
+		"block/dm-3/dm/uuid":        "LVM-def\n",
+		"block/dm-3/dm/name":        "data-lv\n",
+		"block/dm-2/dm/uuid":        "LVM-abc\n",
+		"block/dm-2/dm/name":        "rhel-root\n",
+		"block/sda/device/state":    "running\n",
+		"block/sdb/device/state":    sdbState + "\n",
+	})
+	return root
+}
+
+type mockMultipathScanner struct {
+	mockScanner
+	maps map[string]*plugin.MultipathMap
+}
+
+func (m mockMultipathScanner) MultipathMaps() (map[string]*plugin.MultipathMap, error) {
+	return m.maps, nil
+}
+
+func TestReadMultipathMaps(t *testing.T) {
+	maps, err := plugin.ReadMultipathMaps(fakeMultipathSysfs(t, "running"))
+	assert.NoError(t, err)
+	assert.Len(t, maps, 1)
+
+	m := maps["dm-0"]
+	assert.Equal(t, "mpatha", m.Alias)
+	assert.Equal(t, []plugin.MultipathPath{{Name: "sda", State: "running"}, {Name: "sdb", State: "running"}}, m.Paths)
+	assert.Equal(t, []string{"dm-1", "dm-3"}, m.Holders, "holders of holders belong to the map too")
+	assert.Equal(t, 2, m.ActivePaths())
+	assert.Equal(t, "Healthy", m.Health())
+
+	_, err = plugin.ReadMultipathMaps(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestMultipathHealth(t *testing.T) {
+	maps, err := plugin.ReadMultipathMaps(fakeMultipathSysfs(t, "offline"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, maps["dm-0"].ActivePaths())
+	assert.Equal(t, "Healthy", maps["dm-0"].Health(), "a degraded map is still usable")
+	assert.True(t, maps["dm-0"].Degraded())
+
+	maps["dm-0"].Paths[0].State = "offline"
+	assert.Equal(t, "Unhealthy", maps["dm-0"].Health())
+	assert.False(t, maps["dm-0"].Degraded(), "a map without paths is down, not degraded")
+}
+
+func TestMultipathDevicePaths(t *testing.T) {
+	maps, err := plugin.ReadMultipathMaps(fakeMultipathSysfs(t, "running"))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		mode     string
+		expected []string
+	}{
+		{plugin.MultipathModeDM, []string{"/dev/dm-0"}},
+		{plugin.MultipathModeDMAndPaths, []string{"/dev/dm-0", "/dev/sda", "/dev/sdb", "/dev/dm-1", "/dev/dm-3"}},
+		{plugin.MultipathModeMapper, []string{"/dev/mapper/mpatha"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			assert.Equal(t, tt.expected, plugin.MultipathDevicePaths(maps["dm-0"], tt.mode))
+		})
+	}
+}
+
+func TestScanRootForDevicesWithDeps_Multipath(t *testing.T) {
+	maps, err := plugin.ReadMultipathMaps(fakeMultipathSysfs(t, "running"))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		mode     string
+		expected []string
+	}{
+		{"Grouping disabled", "", []string{"/dev/dm-0", "/dev/dm-1", "/dev/dm-3", "/dev/sda", "/dev/sdb", "/dev/sdc"}},
+		{"Paths and holders folded into their map", plugin.MultipathModeDM, []string{"/dev/dm-0", "/dev/sdc"}},
+		{"Holders never handed out twice", plugin.MultipathModeDMAndPaths, []string{"/dev/dm-0", "/dev/sdc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &api.DevicePluginConfig{MultipathMode: tt.mode}
+			scanner := mockMultipathScanner{
+				mockScanner: mockScanner{
+					devices: []string{"/dev/dm-0", "/dev/dm-1", "/dev/dm-3", "/dev/sda", "/dev/sdb", "/dev/sdc"},
+					config:  config,
+				},
+				maps: maps,
+			}
+			got, err := plugin.ScanRootForDevicesWithDeps(scanner, false)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestCheckDeviceHealth_ReportsDegradedMaps(t *testing.T) {
+	maps, err := plugin.ReadMultipathMaps(fakeMultipathSysfs(t, "running"))
+	require.NoError(t, err)
+	client := fake.NewSimpleClientset(newFakeNode("worker-0"))
+	config := &api.DevicePluginConfig{MultipathMode: plugin.MultipathModeDM}
+	p := &plugin.PowerPlugin{
+		Scanner: mockMultipathScanner{
+			mockScanner: mockScanner{devices: []string{"/dev/dm-0", "/dev/sda", "/dev/sdb"}, config: config},
+			maps:        maps,
+		},
+		Config:      config,
+		DeviceUsage: map[string]int{},
+		Reporter:    plugin.NewNodeReporter(client, "worker-0", 100, 100),
+		Inventory:   plugin.NewInventoryReporter(inventoryfake.NewSimpleClientset(), "worker-0"),
+	}
+	_, err = p.Rescan()
+	require.NoError(t, err)
+
+	degraded := func() bool {
+		for _, dev := range p.Inventory.Status().Devices {
+			if dev.Name == "dm-0" {
+				return dev.Degraded
+			}
+		}
+		return false
+	}
+	reasons := func() []string {
+		p.Reporter.Flush()
+		var reasons []string
+		for _, e := range listEvents(t, client) {
+			if e.Type == corev1.EventTypeWarning {
+				reasons = append(reasons, e.Reason)
+			}
+		}
+		return reasons
+	}
+
+	p.CheckDeviceHealth()
+	assert.Empty(t, reasons(), "all paths are running")
+	assert.False(t, degraded())
+
+	maps["dm-0"].Paths[1].State = "offline"
+	p.CheckDeviceHealth()
+	p.CheckDeviceHealth()
+	assert.Equal(t, []string{plugin.ReasonMultipathDegraded}, reasons(), "reported once, a degraded map stays healthy")
+	assert.True(t, degraded(), "the inventory shows the map is degraded as long as it is")
+
+	maps["dm-0"].Paths[0].State = "offline"
+	p.CheckDeviceHealth()
+	assert.ElementsMatch(t, []string{plugin.ReasonMultipathDegraded, plugin.ReasonDeviceUnhealthy}, reasons(),
+		"a map without paths is unhealthy")
+	assert.False(t, degraded(), "a map without paths is down, not degraded")
+}
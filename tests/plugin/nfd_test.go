@@ -0,0 +1,146 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildNodeFeatures(t *testing.T) {
+	attrs := map[string]*plugin.DeviceAttributes{
+		"dm-0":    {Vendor: "IBM", Model: "2145", Transport: "fc", SizeBytes: 500 * gi},
+		"dm-1":    {Vendor: "IBM", Model: "2145", Transport: "fc", SizeBytes: 100 * gi},
+		"nvme0n1": {Model: "Micron_7450", Transport: "nvme", SizeBytes: 1024 * gi},
+		"sda":     {Vendor: "AIX     ", Model: "VDASD", Transport: "vscsi", SizeBytes: 100*gi + 512},
+	}
+	tests := []struct {
+		name     string
+		devices  []string
+		nxGzip   bool
+		attrs    map[string]*plugin.DeviceAttributes
+		expected map[string]string
+	}{
+		{
+			name:    "Mixed devices with nx-gzip",
+			devices: []string{"dm-0", "dm-1", "/dev/sda", "sda1", "nvme0n1", "/dev/crypto/nx-gzip"},
+			nxGzip:  true,
+			expected: map[string]string{
+				"power-dev-plugin.ibm.com/dev.count":      "5",
+				"power-dev-plugin.ibm.com/dev.dm.count":   "2",
+				"power-dev-plugin.ibm.com/dev.sd.count":   "2",
+				"power-dev-plugin.ibm.com/dev.nvme.count": "1",
+				"power-dev-plugin.ibm.com/nx-gzip":        "true",
+			},
+		},
+		{
+			name:    "Attribute summaries",
+			devices: []string{"dm-0", "dm-1", "/dev/sda", "nvme0n1", "/dev/crypto/nx-gzip"},
+			nxGzip:  true,
+			attrs:   attrs,
+			expected: map[string]string{
+				"power-dev-plugin.ibm.com/dev.count":                   "4",
+				"power-dev-plugin.ibm.com/dev.dm.count":                "2",
+				"power-dev-plugin.ibm.com/dev.sd.count":                "1",
+				"power-dev-plugin.ibm.com/dev.nvme.count":              "1",
+				"power-dev-plugin.ibm.com/dev.vendor.ibm.count":        "2",
+				"power-dev-plugin.ibm.com/dev.vendor.aix.count":        "1",
+				"power-dev-plugin.ibm.com/dev.model.2145.count":        "2",
+				"power-dev-plugin.ibm.com/dev.model.vdasd.count":       "1",
+				"power-dev-plugin.ibm.com/dev.model.micron_7450.count": "1",
+				"power-dev-plugin.ibm.com/dev.transport.fc.count":      "2",
+				"power-dev-plugin.ibm.com/dev.transport.vscsi.count":   "1",
+				"power-dev-plugin.ibm.com/dev.transport.nvme.count":    "1",
+				"power-dev-plugin.ibm.com/dev.size-gi.total":           "1724",
+				"power-dev-plugin.ibm.com/dev.size-gi.max":             "1024",
+				"power-dev-plugin.ibm.com/nx-gzip":                     "true",
+			},
+		},
+		{
+			name:    "nx-gzip enabled but not discovered",
+			devices: []string{"dm-0"},
+			nxGzip:  true,
+			expected: map[string]string{
+				"power-dev-plugin.ibm.com/dev.count":    "1",
+				"power-dev-plugin.ibm.com/dev.dm.count": "1",
+				"power-dev-plugin.ibm.com/nx-gzip":      "false",
+			},
+		},
+		{
+			name:    "No devices",
+			devices: []string{},
+			expected: map[string]string{
+				"power-dev-plugin.ibm.com/dev.count": "0",
+				"power-dev-plugin.ibm.com/nx-gzip":   "false",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := plugin.BuildNodeFeatures(tt.devices, tt.nxGzip, tt.attrs)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestWriteNodeFeatureFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "power-device-plugin")
+
+	err := plugin.WriteNodeFeatureFile(path, map[string]string{"b": "2", "a": "1"})
+	assert.NoError(t, err)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "# Generated by power-device-plugin. Do not edit.\na=1\nb=2\n", string(data))
+
+	// unchanged content must not rewrite the file
+	before, _ := os.Stat(path)
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, plugin.WriteNodeFeatureFile(path, map[string]string{"a": "1", "b": "2"}))
+	after, _ := os.Stat(path)
+	assert.Equal(t, before.ModTime(), after.ModTime())
+
+	assert.Error(t, plugin.WriteNodeFeatureFile(filepath.Join(t.TempDir(), "missing", "file"), map[string]string{}))
+}
+
+func TestGetDiscoveredDevices_ExportsNodeFeatures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "power-device-plugin")
+	config := &api.DevicePluginConfig{NodeFeatures: true}
+	p := &plugin.PowerPlugin{
+		Config:          config,
+		Cache:           &plugin.DeviceCache{},
+		NodeFeatureFile: path,
+		Scanner: mockScanner{
+			devices: []string{"/dev/dm-0", "/dev/dm-1"},
+			config:  config,
+		},
+	}
+
+	_, err := p.GetDiscoveredDevices()
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "power-dev-plugin.ibm.com/dev.count=2\n")
+	assert.Contains(t, string(data), "power-dev-plugin.ibm.com/dev.dm.count=2\n")
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePermissions(t *testing.T) {
+	tests := []struct {
+		perm     string
+		expected string
+		valid    bool
+	}{
+		{"rw", "rw", true},
+		{"RWM", "rwm", true},
+		{"wr", "rw", true},
+		{"m", "m", true},
+		{"", "", false},
+		{"rx", "", false},
+		{"rr", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.perm, func(t *testing.T) {
+			got, err := plugin.ValidatePermissions(tt.perm)
+			assert.Equal(t, tt.expected, got)
+			assert.Equal(t, tt.valid, err == nil)
+		})
+	}
+}
+
+func TestPermissionPolicy_Resolve(t *testing.T) {
+	config := &api.DevicePluginConfig{
+		Permissions: "rw",
+		PermissionRules: []api.PermissionRule{
+			{Comment: "backup LUNs", Glob: "/dev/mapper/backup_*", Permissions: "r"},
+			{Comment: "nx-gzip", Glob: "/dev/crypto/nx-gzip", Permissions: "rwm"},
+			{Comment: "broken", Glob: "/dev/sda", Permissions: "rx"},
+			{Comment: "spinning disks", Selector: &api.DeviceSelector{Vendor: "AIX"}, Permissions: "r"},
+		},
+	}
+	aliases := plugin.DeviceAliases{
+		"dm-5": {"/dev/mapper/backup_01"},
+		"dm-3": {"/dev/mapper/oradata_01"},
+	}
+	attrs := map[string]*plugin.DeviceAttributes{"sda": {Vendor: "AIX"}}
+
+	tests := []struct {
+		dev    string
+		perm   string
+		source string
+	}{
+		{"/dev/dm-5", "r", "permission-rules[0] (backup LUNs)"},
+		{"dm-5", "r", "permission-rules[0] (backup LUNs)"},
+		{"/dev/dm-3", "rw", plugin.PermissionSourceDefault},
+		{"/dev/crypto/nx-gzip", "rwm", "permission-rules[1] (nx-gzip)"},
+		{"/dev/sda", "r", "permission-rules[3] (spinning disks)"},
+	}
+	policy := plugin.NewPermissionPolicy(config, nil)
+	for _, tt := range tests {
+		t.Run(tt.dev, func(t *testing.T) {
+			perm, source := policy.Resolve(tt.dev, aliases, attrs[strings.TrimPrefix(tt.dev, "/dev/")])
+			assert.Equal(t, tt.perm, perm)
+			assert.Equal(t, tt.source, source)
+		})
+	}
+}
+
+func TestPermissionPolicy_ResolveAll(t *testing.T) {
+	scanner := mockRuleScanner{
+		aliases: plugin.DeviceAliases{"dm-5": {"/dev/mapper/backup_01"}},
+		attrs:   map[string]*plugin.DeviceAttributes{"dm-3": {Vendor: "IBM", Model: "2145"}},
+	}
+	config := &api.DevicePluginConfig{
+		PermissionRules: []api.PermissionRule{
+			{Glob: "/dev/mapper/backup_*", Permissions: "r"},
+			{Selector: &api.DeviceSelector{Model: "2145"}, Permissions: "rwm"},
+		},
+	}
+	perms, sources := plugin.NewPermissionPolicy(config, nil).ResolveAll(scanner, []string{"/dev/dm-3", "/dev/dm-5", "/dev/sdb"})
+	assert.Equal(t, map[string]string{"/dev/dm-3": "rwm", "/dev/dm-5": "r", "/dev/sdb": "rw"}, perms)
+	assert.Equal(t, "permission-rules[0]", sources["/dev/dm-5"])
+
+	perms, _ = plugin.NewPermissionPolicy(nil, nil).ResolveAll(scanner, []string{"/dev/sdb"})
+	assert.Equal(t, "rwm", perms["/dev/sdb"], "no config keeps the historical default")
+}
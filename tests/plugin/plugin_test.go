@@ -19,12 +19,15 @@ package plugin_test
 import (
 	"context"
 	"errors"
+	"sync"
 	"testing"
 	"time"
 
 	api "github.com/ocp-power-demos/power-dev-plugin/api"
 	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
 
 	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 )
@@ -161,42 +164,6 @@ func TestScanRootForDevicesWithDeps(t *testing.T) {
 	}
 }
 
-func TestApplyExcludeFilters(t *testing.T) {
-	devices := []string{"/dev/sda", "/dev/sdb", "/dev/nvme0n1"}
-	excludes := []string{"/dev/sdb", "/dev/nvme0n1"}
-	result := plugin.ApplyExcludeFilters(devices, excludes)
-	assert.Equal(t, []string{"/dev/sda"}, result)
-}
-
-func TestApplyIncludeFilters_Empty(t *testing.T) {
-	scanner := mockScanner{}
-	devices := []string{"/dev/sda", "/dev/sdb"}
-	result := plugin.ApplyIncludeFilters(scanner, devices, []string{})
-	assert.Equal(t, []string{"sda", "sdb"}, result)
-}
-
-func TestApplyIncludeFilters_ValidPattern(t *testing.T) {
-	scanner := mockScanner{
-		findResults: map[string][]string{
-			"/dev/sda": {"/dev/sda"},
-		},
-	}
-	devices := []string{"/dev/sda", "/dev/sdb"}
-	includes := []string{"/dev/sda"}
-	result := plugin.ApplyIncludeFilters(scanner, devices, includes)
-	assert.Equal(t, []string{"sda"}, result)
-}
-
-func TestApplyIncludeFilters_InvalidPattern(t *testing.T) {
-	scanner := mockScanner{
-		findResults: map[string][]string{},
-	}
-	devices := []string{"/dev/sda"}
-	patterns := []string{"["} // invalid
-	result := plugin.ApplyIncludeFilters(scanner, devices, patterns)
-	assert.Empty(t, result)
-}
-
 func TestGetValidatedPermission(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -372,6 +339,7 @@ func TestAllocateUpperLimit(t *testing.T) {
 		devices: []string{"/dev/sda", "/dev/sdb"},
 		config: &api.DevicePluginConfig{
 			UpperLimitPerDevice: 1,
+			AllocationPolicy:    plugin.PolicyUpperLimitShared,
 		},
 		findResults: map[string][]string{
 			"*": {"/dev/sda", "/dev/sdb"},
@@ -435,12 +403,12 @@ func TestAllocate_UpperLimitScenarios(t *testing.T) {
 			expectAllocated:  1,
 		},
 		{
-			name:             "Negative upper limit defaults to 1",
+			name:             "Negative upper limit is ignored",
 			upperLimit:       -1,
 			availableDevices: []string{"/dev/sda"},
 			requested:        [][]string{{"sda"}, {"sda"}},
-			expectError:      true,
-			expectAllocated:  1,
+			expectError:      false,
+			expectAllocated:  2,
 		},
 		{
 			name:             "Mixed success with multiple requests",
@@ -479,6 +447,7 @@ func TestAllocate_UpperLimitScenarios(t *testing.T) {
 				devices: tt.availableDevices,
 				config: &api.DevicePluginConfig{
 					UpperLimitPerDevice: tt.upperLimit,
+					AllocationPolicy:    plugin.PolicyUpperLimitShared,
 				},
 				findResults: map[string][]string{
 					"*": tt.availableDevices,
@@ -519,3 +488,58 @@ func TestAllocate_UpperLimitScenarios(t *testing.T) {
 		})
 	}
 }
+
+// reloadingScanner is a mockScanner whose config file changes
+type reloadingScanner struct {
+	mockScanner
+	mutex  *sync.Mutex
+	config **api.DevicePluginConfig
+	err    *error
+}
+
+func (s reloadingScanner) LoadConfig() (*api.DevicePluginConfig, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return *s.config, *s.err
+}
+
+func TestAllocate_UsesTheConfigOfTheLastScan(t *testing.T) {
+	config := &api.DevicePluginConfig{Permissions: "r"}
+	var loadErr error
+	mutex := &sync.Mutex{}
+	reload := func(next *api.DevicePluginConfig, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		config, loadErr = next, err
+	}
+	client := fake.NewSimpleClientset(newFakeNode("worker-0"))
+	p := &plugin.PowerPlugin{
+		Scanner:     reloadingScanner{mockScanner: mockScanner{devices: []string{"/dev/dm-3"}}, mutex: mutex, config: &config, err: &loadErr},
+		DeviceUsage: map[string]int{},
+		Reporter:    plugin.NewNodeReporter(client, "worker-0", 10, 10),
+	}
+	permissions := func() string {
+		resp, err := p.Allocate(context.Background(), containerRequests([]string{"dm-3"}))
+		require.NoError(t, err)
+		return resp.ContainerResponses[0].Devices[0].Permissions
+	}
+
+	_, err := p.Rescan()
+	require.NoError(t, err)
+	assert.Equal(t, "r", permissions())
+
+	reload(&api.DevicePluginConfig{Permissions: "rw"}, nil)
+	assert.Equal(t, "r", permissions(), "Allocate does not read the config file")
+	_, err = p.Rescan()
+	require.NoError(t, err)
+	assert.Equal(t, "rw", permissions(), "a rescan loads the config")
+
+	reload(nil, errors.New("invalid character '}' looking for beginning of object key string"))
+	_, err = p.Rescan()
+	require.NoError(t, err)
+	assert.Equal(t, "rw", permissions(), "a config that fails to load keeps the running config")
+	p.Reporter.Flush()
+	events := listEvents(t, client)
+	require.Len(t, events, 1)
+	assert.Equal(t, plugin.ReasonConfigLoadFailed, events[0].Reason)
+}
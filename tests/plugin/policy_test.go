@@ -0,0 +1,173 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func TestAllocationPolicies_Select(t *testing.T) {
+	limitOne := func(string) int { return 1 }
+	tests := []struct {
+		name     string
+		policy   plugin.AllocationPolicy
+		ids      []string
+		usage    map[string]int
+		expected []string
+		skipped  []string
+		code     codes.Code
+	}{
+		{
+			name:     "grant-all ignores the requested IDs",
+			policy:   plugin.GrantAllPolicy{},
+			ids:      []string{"dm-3"},
+			usage:    map[string]int{"/dev/dm-4": 1},
+			expected: []string{"/dev/dm-3", "/dev/sda"},
+			skipped:  []string{"/dev/dm-4"},
+		},
+		{
+			name:    "grant-all with every device full",
+			policy:  plugin.GrantAllPolicy{},
+			ids:     []string{"dm-3"},
+			usage:   map[string]int{"/dev/dm-3": 1, "/dev/dm-4": 1, "/dev/sda": 1},
+			skipped: []string{"/dev/dm-3", "/dev/dm-4", "/dev/sda"},
+			code:    codes.ResourceExhausted,
+		},
+		{
+			name:     "requested-ids ignores the upper limit",
+			policy:   plugin.RequestedIDsPolicy{},
+			ids:      []string{"dm-4::0", "dm-4::1", "sda"},
+			usage:    map[string]int{"/dev/dm-4": 5},
+			expected: []string{"/dev/dm-4", "/dev/sda"},
+		},
+		{
+			name:     "upper-limit-shared grants requested devices below their limit",
+			policy:   plugin.UpperLimitSharedPolicy{},
+			ids:      []string{"sda", "dm-3"},
+			usage:    map[string]int{"/dev/dm-4": 1},
+			expected: []string{"/dev/sda", "/dev/dm-3"},
+		},
+		{
+			name:    "upper-limit-shared rejects a container with one full device",
+			policy:  plugin.UpperLimitSharedPolicy{},
+			ids:     []string{"sda", "dm-4"},
+			usage:   map[string]int{"/dev/dm-4": 1},
+			skipped: []string{"/dev/dm-4"},
+			code:    codes.ResourceExhausted,
+		},
+		{
+			name:     "exclusive grants unused devices",
+			policy:   plugin.ExclusivePolicy{},
+			ids:      []string{"dm-3"},
+			usage:    map[string]int{"/dev/dm-4": 1},
+			expected: []string{"/dev/dm-3"},
+		},
+		{
+			name:    "exclusive rejects a device held by another container",
+			policy:  plugin.ExclusivePolicy{},
+			ids:     []string{"dm-3", "dm-4"},
+			usage:   map[string]int{"/dev/dm-4": 1},
+			skipped: []string{"/dev/dm-4"},
+			code:    codes.ResourceExhausted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := tt.policy.Select(plugin.AllocationRequest{
+				RequestedIDs: tt.ids,
+				Devices:      []string{"/dev/dm-3", "/dev/dm-4", "/dev/sda"},
+				Usage:        tt.usage,
+				Limit:        limitOne,
+			})
+			assert.Equal(t, tt.code, status.Code(err))
+			if tt.code == codes.OK {
+				assert.Equal(t, tt.expected, decision.Devices)
+			}
+			assert.ElementsMatch(t, tt.skipped, decision.LimitSkipped)
+		})
+	}
+}
+
+func TestLookupAllocationPolicy(t *testing.T) {
+	assert.Equal(t, plugin.DefaultAllocationPolicy, plugin.LookupAllocationPolicy(nil).Name())
+	assert.Equal(t, plugin.PolicyExclusive, plugin.LookupAllocationPolicy(&api.DevicePluginConfig{AllocationPolicy: "exclusive"}).Name())
+	assert.Equal(t, plugin.DefaultAllocationPolicy, plugin.LookupAllocationPolicy(&api.DevicePluginConfig{AllocationPolicy: "first-fit"}).Name())
+	assert.Subset(t, plugin.AllocationPolicyNames(), []string{"exclusive", "grant-all", "requested-ids", "upper-limit-shared"})
+}
+
+// lastDevicePolicy always hands out the last device, a stand-in for a platform team's own policy
+type lastDevicePolicy struct{}
+
+func (lastDevicePolicy) Name() string { return "last-device" }
+
+func (lastDevicePolicy) Select(req plugin.AllocationRequest) (plugin.AllocationDecision, error) {
+	return plugin.AllocationDecision{Devices: req.Devices[len(req.Devices)-1:]}, nil
+}
+
+func TestAllocate_CustomPolicy(t *testing.T) {
+	plugin.RegisterAllocationPolicy(lastDevicePolicy{})
+
+	config := &api.DevicePluginConfig{AllocationPolicy: "last-device"}
+	scanner := mockScanner{devices: []string{"/dev/dm-3", "/dev/dm-4"}, config: config}
+	p := &plugin.PowerPlugin{
+		Scanner:     scanner,
+		Config:      config,
+		DeviceUsage: map[string]int{},
+	}
+	req := &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIds: []string{"dm-3"}}},
+	}
+
+	resp, err := p.Allocate(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/dm-4", resp.ContainerResponses[0].Devices[0].HostPath)
+	assert.Equal(t, map[string]int{"/dev/dm-4": 1}, p.Usage())
+
+	// a policy set on the plugin wins over the config
+	p.Policy = plugin.RequestedIDsPolicy{}
+	resp, err = p.Allocate(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/dm-3", resp.ContainerResponses[0].Devices[0].HostPath)
+}
+
+func TestGetAllocateFunc_GrantsAll(t *testing.T) {
+	config := &api.DevicePluginConfig{}
+	scanner := mockScanner{devices: []string{"/dev/dm-3", "/dev/dm-4"}, config: config}
+	p := &plugin.PowerPlugin{
+		Scanner:     scanner,
+		Config:      config,
+		DeviceUsage: map[string]int{},
+	}
+
+	resp, err := p.GetAllocateFunc()(&pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIds: []string{"dm-3"}}},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, resp.ContainerResponses[0].Devices, 2)
+	assert.Equal(t, "/dev/dm-3", resp.ContainerResponses[0].Devices[0].HostPath)
+	assert.Equal(t, "/dev/dm-3", resp.ContainerResponses[0].Devices[0].ContainerPath)
+}
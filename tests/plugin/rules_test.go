@@ -0,0 +1,186 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockRuleScanner struct {
+	mockScanner
+	aliases plugin.DeviceAliases
+	attrs   map[string]*plugin.DeviceAttributes
+}
+
+func (m mockRuleScanner) DeviceAliases() (plugin.DeviceAliases, error) {
+	return m.aliases, nil
+}
+
+func (m mockRuleScanner) DeviceAttributes(devices []string) (map[string]*plugin.DeviceAttributes, error) {
+	return m.attrs, nil
+}
+
+func TestDeviceRules_Precedence(t *testing.T) {
+	devices := []string{"/dev/sda", "/dev/sda1", "/dev/dm-3", "/dev/dm-4"}
+	attrs := map[string]*plugin.DeviceAttributes{
+		"sda":  {Vendor: "AIX", Model: "VDASD"},
+		"sda1": {Vendor: "AIX", Model: "VDASD", FSType: "xfs"},
+		"dm-3": {Vendor: "IBM", Model: "2145"},
+		"dm-4": {Vendor: "IBM", Model: "2145", FSType: "ext4"},
+	}
+
+	tests := []struct {
+		name     string
+		rules    []api.DeviceRule
+		expected []string
+	}{
+		{
+			name:     "No rules allow everything",
+			rules:    nil,
+			expected: devices,
+		},
+		{
+			name:     "Only deny rules allow the rest",
+			rules:    []api.DeviceRule{{Action: "deny", Glob: "/dev/sda*"}},
+			expected: []string{"/dev/dm-3", "/dev/dm-4"},
+		},
+		{
+			name:     "An allow rule denies unmatched devices",
+			rules:    []api.DeviceRule{{Action: "allow", Glob: "/dev/dm-*"}},
+			expected: []string{"dm-3", "dm-4"},
+		},
+		{
+			name: "Deny before allow wins",
+			rules: []api.DeviceRule{
+				{Action: "deny", Glob: "/dev/mapper/oradata_02"},
+				{Action: "allow", Glob: "/dev/dm-*"},
+			},
+			expected: []string{"dm-3"},
+		},
+		{
+			name: "Allow before deny wins",
+			rules: []api.DeviceRule{
+				{Action: "allow", Glob: "/dev/dm-*"},
+				{Action: "deny", Glob: "/dev/mapper/oradata_02"},
+			},
+			expected: []string{"dm-3", "dm-4"},
+		},
+		{
+			name: "Catch-all deny after specific allows",
+			rules: []api.DeviceRule{
+				{Comment: "the data LUN", Action: "allow", Regex: "/dev/disk/by-id/wwn-0x6005076810810261f800000000000a1b"},
+				{Comment: "nothing else", Action: "deny"},
+			},
+			expected: []string{"dm-3"},
+		},
+		{
+			name: "Every matcher of a rule must match",
+			rules: []api.DeviceRule{
+				{Action: "allow", Glob: "/dev/dm-*", Selector: &api.DeviceSelector{FSType: "none"}},
+			},
+			expected: []string{"dm-3"},
+		},
+		{
+			name: "Attribute deny ahead of a broad allow",
+			rules: []api.DeviceRule{
+				{Action: "deny", Selector: &api.DeviceSelector{Vendor: "AIX"}},
+				{Action: "allow", Regex: "/dev/(sd|dm-)[a-z0-9]+"},
+			},
+			expected: []string{"dm-3", "dm-4"},
+		},
+		{
+			name: "Regex must match the whole name",
+			rules: []api.DeviceRule{
+				{Action: "allow", Regex: "dm-3"},
+			},
+			expected: []string{},
+		},
+		{
+			name: "Invalid rules are skipped",
+			rules: []api.DeviceRule{
+				{Action: "permit", Glob: "/dev/sda"},
+				{Action: "deny", Regex: "("},
+				{Action: "ALLOW", Glob: "/dev/sda"},
+			},
+			expected: []string{"sda"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := mockRuleScanner{
+				mockScanner: mockScanner{devices: devices, config: &api.DevicePluginConfig{DeviceRules: tt.rules}},
+				aliases:     fakeAliases,
+				attrs:       attrs,
+			}
+			got, err := plugin.ScanRootForDevicesWithDeps(scanner, false)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestDeviceRules_ExcludedDeviceDoesNotReappear(t *testing.T) {
+	// the include pattern globs to the excluded device on the host, it must stay excluded
+	scanner := mockScanner{
+		devices: []string{"/dev/dm-1", "/dev/dm-9"},
+		config: &api.DevicePluginConfig{
+			IncludeDevices: []string{"/dev/dm-*"},
+			ExcludeDevices: []string{"/dev/dm-9"},
+		},
+		findResults: map[string][]string{"/dev/dm-*": {"/dev/dm-1", "/dev/dm-9"}},
+	}
+	got, err := plugin.ScanRootForDevicesWithDeps(scanner, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dm-1"}, got)
+}
+
+func TestLegacyDeviceRules(t *testing.T) {
+	config := &api.DevicePluginConfig{
+		IncludeDevices:   []string{"/dev/dm-*", " "},
+		ExcludeDevices:   []string{"/dev/dm-9", ""},
+		IncludeSelectors: []api.DeviceSelector{{Vendor: "IBM"}},
+		ExcludeSelectors: []api.DeviceSelector{{FSType: "xfs"}},
+	}
+	assert.Equal(t, []api.DeviceRule{
+		{Comment: "exclude-selectors", Action: "deny", Selector: &api.DeviceSelector{FSType: "xfs"}},
+		{Comment: "exclude-devices", Action: "deny", Glob: "/dev/dm-9"},
+		{Comment: "include-devices", Action: "allow", Glob: "/dev/dm-*"},
+		{Comment: "include-selectors", Action: "allow", Selector: &api.DeviceSelector{Vendor: "IBM"}},
+	}, plugin.EffectiveDeviceRules(config))
+
+	config.DeviceRules = []api.DeviceRule{{Action: "deny"}}
+	assert.Equal(t, config.DeviceRules, plugin.EffectiveDeviceRules(config), "device-rules replaces the legacy fields")
+}
+
+func TestDeviceRules_JSON(t *testing.T) {
+	var config api.DevicePluginConfig
+	err := json.Unmarshal([]byte(`{
+		"device-rules": [
+			{"comment": "boot disk", "action": "deny", "glob": "/dev/disk/by-label/boot"},
+			{"action": "allow", "selector": {"vendor": "IBM", "model": "2145"}}
+		]
+	}`), &config)
+	assert.NoError(t, err)
+	assert.Len(t, config.DeviceRules, 2)
+	assert.Equal(t, "boot disk", config.DeviceRules[0].Comment)
+	assert.Equal(t, "2145", config.DeviceRules[1].Selector.Model)
+}
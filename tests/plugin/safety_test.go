@@ -0,0 +1,133 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeHost is a node booted from sda (/boot on sda1, LVM rhel-root and rhel-swap on sda2),
+// with an md0 of sdd+sde mounted at /var/lib/data, a multipath data LUN dm-2 over sdb/sdc and a free sdf
+func fakeHost(t *testing.T) *plugin.SystemDeviceGuard {
+	root := t.TempDir()
+	writeSysfs(t, root, map[string]string{
+		"sys/block/sda/dev":                 "8:0",
+		"sys/block/sda/sda1/dev":            "8:1",
+		"sys/block/sda/sda1/partition":      "1",
+		"sys/block/sda/sda2/dev":            "8:2",
+		"sys/block/sda/sda2/partition":      "2",
+		"sys/block/sda/sda2/holders/dm-0/x": "",
+		"sys/block/sda/sda2/holders/dm-1/x": "",
+		"sys/block/dm-0/dev":                "253:0",
+		"sys/block/dm-0/dm/name":            "rhel-root",
+		"sys/block/dm-0/dm/uuid":            "LVM-root",
+		"sys/block/dm-0/slaves/sda2/x":      "",
+		"sys/block/dm-1/dev":                "253:1",
+		"sys/block/dm-1/dm/name":            "rhel-swap",
+		"sys/block/dm-1/dm/uuid":            "LVM-swap",
+		"sys/block/dm-1/slaves/sda2/x":      "",
+		"sys/block/dm-2/dev":                "253:2",
+		"sys/block/dm-2/dm/name":            "mpatha",
+		"sys/block/dm-2/dm/uuid":            "mpath-3600",
+		"sys/block/dm-2/slaves/sdb/x":       "",
+		"sys/block/dm-2/slaves/sdc/x":       "",
+		"sys/block/sdb/dev":                 "8:16",
+		"sys/block/sdb/holders/dm-2/x":      "",
+		"sys/block/sdc/dev":                 "8:32",
+		"sys/block/sdc/holders/dm-2/x":      "",
+		"sys/block/md0/dev":                 "9:0",
+		"sys/block/md0/slaves/sdd/x":        "",
+		"sys/block/md0/slaves/sde/x":        "",
+		"sys/block/sdd/dev":                 "8:48",
+		"sys/block/sdd/holders/md0/x":       "",
+		"sys/block/sde/dev":                 "8:64",
+		"sys/block/sde/holders/md0/x":       "",
+		"sys/block/sdf/dev":                 "8:80",
+		"proc/swaps":                        "Filename Type Size Used Priority\n/dev/dm-1 partition 4194300 0 -2\n",
+		"proc/mountinfo": "22 1 0:21 / /proc rw,relatime - proc proc rw\n" +
+			"29 1 253:0 / / rw,relatime shared:1 - xfs /dev/mapper/rhel-root rw\n" +
+			"30 29 8:1 / /boot rw,relatime shared:2 - xfs /dev/sda1 rw\n" +
+			"31 29 0:99 / /var/lib/data rw,relatime shared:3 - ext4 /dev/md0 rw\n",
+	})
+	return &plugin.SystemDeviceGuard{SysRoot: filepath.Join(root, "sys"), ProcRoot: filepath.Join(root, "proc")}
+}
+
+type mockGuardedScanner struct {
+	mockScanner
+	protected map[string]string
+}
+
+func (m mockGuardedScanner) ProtectedDevices() (map[string]string, error) {
+	return m.protected, nil
+}
+
+func TestSystemDeviceGuard_ProtectedDevices(t *testing.T) {
+	protected, err := fakeHost(t).ProtectedDevices()
+	assert.NoError(t, err)
+
+	names := []string{}
+	for name := range protected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"dm-0", "dm-1", "md0", "sda", "sda1", "sda2", "sdd", "sde"}, names)
+	assert.Equal(t, "mounted at /", protected["dm-0"])
+	assert.Equal(t, "swap", protected["dm-1"])
+	assert.Equal(t, "mounted at /var/lib/data", protected["md0"], "resolved from the mount source")
+}
+
+func TestApplySystemDeviceGuard(t *testing.T) {
+	protected := map[string]string{"sda": "mounted at /", "sdb": "swap"}
+	devices := []string{"/dev/sda", "sdb", "/dev/sdc"}
+
+	kept, excluded := plugin.ApplySystemDeviceGuard(devices, protected, nil)
+	assert.Equal(t, []string{"/dev/sdc"}, kept)
+	assert.Equal(t, map[string]string{"/dev/sda": "mounted at /", "sdb": "swap"}, excluded)
+
+	kept, excluded = plugin.ApplySystemDeviceGuard(devices, protected, []string{"/dev/sdb"})
+	assert.Equal(t, []string{"sdb", "/dev/sdc"}, kept)
+	assert.Len(t, excluded, 1)
+}
+
+func TestScanRootForDevicesWithDeps_SystemDeviceGuard(t *testing.T) {
+	protected, err := fakeHost(t).ProtectedDevices()
+	assert.NoError(t, err)
+
+	config := &api.DevicePluginConfig{}
+	scanner := mockGuardedScanner{
+		mockScanner: mockScanner{
+			// a broad include like /dev/sd* picks up everything
+			devices: []string{"/dev/sda", "/dev/sda1", "/dev/sda2", "/dev/sdb", "/dev/sdc", "/dev/sdd", "/dev/sdf", "/dev/dm-0", "/dev/dm-2"},
+			config:  config,
+		},
+		protected: protected,
+	}
+	got, err := plugin.ScanRootForDevicesWithDeps(scanner, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/dev/sdb", "/dev/sdc", "/dev/sdf", "/dev/dm-2"}, got)
+
+	config.AllowSystemDevices = []string{"/dev/sdd"}
+	got, err = plugin.ScanRootForDevicesWithDeps(scanner, false)
+	assert.NoError(t, err)
+	assert.Contains(t, got, "/dev/sdd")
+}
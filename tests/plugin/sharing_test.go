@@ -0,0 +1,119 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func healthy(string) string { return pluginapi.Healthy }
+
+func deviceIDs(devices []*pluginapi.Device) []string {
+	ids := []string{}
+	for _, d := range devices {
+		ids = append(ids, d.ID)
+	}
+	return ids
+}
+
+func TestReplicaIDs(t *testing.T) {
+	assert.Equal(t, "dm-3::2", plugin.ReplicaID("/dev/dm-3", 2))
+	assert.Equal(t, "dm-3", plugin.PhysicalDeviceID("dm-3::2"))
+	assert.Equal(t, "dm-3", plugin.PhysicalDeviceID("dm-3"))
+	assert.Equal(t, "crypto/nx-gzip", plugin.PhysicalDeviceID("crypto/nx-gzip::0"))
+	assert.Equal(t, "odd::name", plugin.PhysicalDeviceID("odd::name"), "only a numeric suffix is a replica")
+}
+
+func TestAdvertisedDevices(t *testing.T) {
+	devices := []string{"/dev/dm-3", "/dev/dm-4", "sdb"}
+
+	tests := []struct {
+		name     string
+		config   *api.DevicePluginConfig
+		expected []string
+	}{
+		{
+			name:     "Sharing disabled",
+			config:   &api.DevicePluginConfig{},
+			expected: []string{"dm-3", "dm-4", "sdb"},
+		},
+		{
+			name:     "Pool-wide replicas",
+			config:   &api.DevicePluginConfig{Replicas: 2},
+			expected: []string{"dm-3::0", "dm-3::1", "dm-4::0", "dm-4::1", "sdb::0", "sdb::1"},
+		},
+		{
+			name: "Per-device replicas",
+			config: &api.DevicePluginConfig{
+				ReplicaRules: []api.ReplicaRule{
+					{Glob: "/dev/mapper/oradata_01", Replicas: 3},
+					{Glob: "/dev/sdb", Replicas: 0},
+				},
+			},
+			expected: []string{"dm-3::0", "dm-3::1", "dm-3::2", "dm-4", "sdb"},
+		},
+		{
+			name: "A device opted out of pool-wide sharing",
+			config: &api.DevicePluginConfig{
+				Replicas:     2,
+				ReplicaRules: []api.ReplicaRule{{Regex: "/dev/dm-4", Replicas: 1}},
+			},
+			expected: []string{"dm-3::0", "dm-3::1", "dm-4", "sdb::0", "sdb::1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := mockAliasScanner{aliases: fakeAliases}
+			assert.Equal(t, tt.expected, deviceIDs(plugin.AdvertisedDevices(devices, tt.config, nil, scanner, healthy)))
+		})
+	}
+}
+
+func TestAllocate_Replicas(t *testing.T) {
+	config := &api.DevicePluginConfig{Replicas: 4, AllocationPolicy: plugin.PolicyUpperLimitShared}
+	scanner := mockScanner{devices: []string{"/dev/dm-3", "/dev/dm-4"}, config: config}
+	p := &plugin.PowerPlugin{
+		Scanner:     scanner,
+		Config:      config,
+		DeviceUsage: map[string]int{},
+	}
+
+	resp, err := p.Allocate(context.Background(), &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{
+			{DevicesIds: []string{"dm-3::0", "dm-3::1"}},
+			{DevicesIds: []string{"dm-4::2"}},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, resp.ContainerResponses, 2)
+	assert.Len(t, resp.ContainerResponses[0].Devices, 1, "two replicas of one device are one device node")
+	assert.Equal(t, "/dev/dm-3", resp.ContainerResponses[0].Devices[0].HostPath)
+	assert.Equal(t, "/dev/dm-4", resp.ContainerResponses[1].Devices[0].HostPath)
+	assert.Equal(t, map[string]int{"/dev/dm-3": 1, "/dev/dm-4": 1}, p.Usage())
+
+	_, err = p.Allocate(context.Background(), &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIds: []string{"sdz::0"}}},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	inventoryfake "github.com/ocp-power-demos/power-dev-plugin/pkg/client/clientset/versioned/fake"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// hungScanner is a host whose scans, or the probes of some devices, block until released
+type hungScanner struct {
+	mockScanner
+	lock    sync.Mutex
+	current []string
+	gate    chan struct{}
+	stuck   map[string]chan struct{}
+}
+
+// hang blocks the following scans until release, which then find devices
+func (s *hungScanner) hang(devices []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.current, s.gate = devices, make(chan struct{})
+}
+
+func (s *hungScanner) release() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.gate != nil {
+		close(s.gate)
+		s.gate = nil
+	}
+}
+
+func (s *hungScanner) GetBlockDevices() ([]string, error) {
+	s.lock.Lock()
+	devices, gate := s.current, s.gate
+	s.lock.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	return devices, nil
+}
+
+func (s *hungScanner) StatDevice(path string) error {
+	if stuck, ok := s.stuck[path]; ok {
+		<-stuck
+	}
+	return nil
+}
+
+func newTimeoutPlugin(t *testing.T, scanner *hungScanner) (*plugin.PowerPlugin, *fake.Clientset) {
+	client := fake.NewSimpleClientset(newFakeNode("worker-0"))
+	p := &plugin.PowerPlugin{
+		Scanner:     scanner,
+		Config:      scanner.config,
+		DeviceUsage: map[string]int{},
+		Reporter:    plugin.NewNodeReporter(client, "worker-0", 10, 10),
+		Inventory:   plugin.NewInventoryReporter(inventoryfake.NewSimpleClientset(), "worker-0"),
+	}
+	t.Cleanup(scanner.release)
+	return p, client
+}
+
+func eventReasons(t *testing.T, client *fake.Clientset) []string {
+	reasons := []string{}
+	for _, e := range listEvents(t, client) {
+		reasons = append(reasons, e.Reason)
+	}
+	return reasons
+}
+
+func TestRescan_ServesLastDevicesWhileScanHangs(t *testing.T) {
+	scanner := &hungScanner{mockScanner: mockScanner{config: &api.DevicePluginConfig{ScanTimeout: "50ms"}}, current: []string{"/dev/dm-3"}}
+	p, client := newTimeoutPlugin(t, scanner)
+	timeouts := plugin.ScanTimeouts()
+
+	devices, err := p.Rescan()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dev/dm-3"}, devices)
+
+	scanner.hang([]string{"/dev/dm-3", "/dev/dm-4"})
+	start := time.Now()
+	devices, err = p.Rescan()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dev/dm-3"}, devices, "the last good inventory is served")
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	resp, err := p.Allocate(context.Background(), containerRequests([]string{"dm-3"}))
+	require.NoError(t, err, "Allocate does not wait for the hung scan")
+	assert.Equal(t, "/dev/dm-3", resp.ContainerResponses[0].Devices[0].HostPath)
+
+	// callers joining the hung scan do not report it again
+	_, err = p.Rescan()
+	require.NoError(t, err)
+	p.Reporter.Flush()
+	assert.Equal(t, []string{plugin.ReasonScanTimedOut}, eventReasons(t, client))
+	assert.Equal(t, 1, p.Inventory.Status().ScanTimeouts)
+	assert.Equal(t, timeouts+1, plugin.ScanTimeouts())
+
+	scanner.release()
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"/dev/dm-3", "/dev/dm-4"}, p.Devices())
+	}, 2*time.Second, 10*time.Millisecond, "the slow scan publishes its result when it finishes")
+}
+
+func TestRescan_TimeoutWithoutDevices(t *testing.T) {
+	scanner := &hungScanner{mockScanner: mockScanner{config: &api.DevicePluginConfig{ScanTimeout: "20ms"}}}
+	scanner.hang([]string{"/dev/dm-3"})
+	p, _ := newTimeoutPlugin(t, scanner)
+
+	_, err := p.Rescan()
+	assert.ErrorContains(t, err, "did not finish within 20ms")
+	_, err = p.Allocate(context.Background(), containerRequests([]string{"dm-3"}))
+	assert.Error(t, err, "nothing can be allocated before the first scan")
+
+	scanner.release()
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"/dev/dm-3"}, p.Devices())
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestScan_ProbeTimeout(t *testing.T) {
+	stuck := make(chan struct{})
+	defer close(stuck)
+	scanner := &hungScanner{
+		mockScanner: mockScanner{config: &api.DevicePluginConfig{ProbeTimeout: "20ms"}},
+		current:     []string{"/dev/dm-10", "/dev/dm-11", "/dev/dm-12"},
+		stuck:       map[string]chan struct{}{"/dev/dm-11": stuck},
+	}
+	p, client := newTimeoutPlugin(t, scanner)
+	timeouts := plugin.ProbeTimeouts()
+
+	devices, err := p.Rescan()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dev/dm-10", "/dev/dm-12"}, devices, "the device that does not answer is left out")
+	p.Reporter.Flush()
+	assert.Equal(t, []string{plugin.ReasonProbeTimedOut}, eventReasons(t, client))
+	assert.Equal(t, 1, p.Inventory.Status().ProbeTimeouts)
+	assert.Equal(t, timeouts+1, plugin.ProbeTimeouts())
+
+	devices, err = p.Rescan()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dev/dm-10", "/dev/dm-12"}, devices, "a device is not probed again while its probe hangs")
+}
+
+func TestScanRootForDevicesContext_Cancelled(t *testing.T) {
+	scanner := &hungScanner{}
+	scanner.hang([]string{"/dev/dm-3"})
+	defer scanner.release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := plugin.ScanRootForDevicesContext(ctx, scanner, false)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
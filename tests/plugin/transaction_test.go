@@ -0,0 +1,146 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func containerRequests(ids ...[]string) *pluginapi.AllocateRequest {
+	req := &pluginapi.AllocateRequest{}
+	for _, devicesIDs := range ids {
+		req.ContainerRequests = append(req.ContainerRequests, &pluginapi.ContainerAllocateRequest{DevicesIds: devicesIDs})
+	}
+	return req
+}
+
+func TestAllocate_RollsBackMultiContainerRequests(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       *api.DevicePluginConfig
+		initialUsage map[string]int
+		request      *pluginapi.AllocateRequest
+		code         codes.Code
+	}{
+		{
+			name:    "Third container hits the upper limit",
+			config:  &api.DevicePluginConfig{UpperLimitPerDevice: 1, AllocationPolicy: plugin.PolicyUpperLimitShared},
+			request: containerRequests([]string{"dm-3"}, []string{"dm-4"}, []string{"dm-3"}),
+			code:    codes.ResourceExhausted,
+		},
+		{
+			name:         "Last container hits the upper limit of a used device",
+			config:       &api.DevicePluginConfig{Replicas: 4, UpperLimitPerDevice: 2, AllocationPolicy: plugin.PolicyUpperLimitShared},
+			initialUsage: map[string]int{"/dev/dm-3": 1},
+			request:      containerRequests([]string{"dm-4::0"}, []string{"dm-3::1"}, []string{"dm-3::2"}),
+			code:         codes.ResourceExhausted,
+		},
+		{
+			name:    "Every container takes all devices",
+			config:  &api.DevicePluginConfig{UpperLimitPerDevice: 1, AllocationPolicy: plugin.PolicyGrantAll},
+			request: containerRequests([]string{"dm-3"}, []string{"dm-4"}),
+			code:    codes.ResourceExhausted,
+		},
+		{
+			name:    "A container requests a device that is gone",
+			config:  &api.DevicePluginConfig{Replicas: 2, AllocationPolicy: plugin.PolicyUpperLimitShared},
+			request: containerRequests([]string{"dm-3::0"}, []string{"dm-4::1"}, []string{"sdz::0"}),
+			code:    codes.Unknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := mockScanner{devices: []string{"/dev/dm-3", "/dev/dm-4"}, config: tt.config}
+			p := &plugin.PowerPlugin{
+				Scanner:     scanner,
+				Config:      tt.config,
+				DeviceUsage: map[string]int{},
+			}
+			for dev, count := range tt.initialUsage {
+				p.DeviceUsage[dev] = count
+			}
+			before := map[string]int{}
+			for dev, count := range p.DeviceUsage {
+				before[dev] = count
+			}
+
+			resp, err := p.Allocate(context.Background(), tt.request)
+			assert.Error(t, err)
+			assert.Nil(t, resp)
+			assert.Equal(t, tt.code, status.Code(err))
+			assert.Equal(t, before, p.Usage(), "a rejected request must not take any capacity")
+		})
+	}
+}
+
+func TestAllocate_CommitsWholeRequest(t *testing.T) {
+	config := &api.DevicePluginConfig{Replicas: 2, UpperLimitPerDevice: 2, AllocationPolicy: plugin.PolicyUpperLimitShared}
+	scanner := mockScanner{devices: []string{"/dev/dm-3", "/dev/dm-4"}, config: config}
+	p := &plugin.PowerPlugin{
+		Scanner:     scanner,
+		Config:      config,
+		DeviceUsage: map[string]int{"/dev/dm-4": 1},
+	}
+
+	resp, err := p.Allocate(context.Background(), containerRequests([]string{"dm-3::0"}, []string{"dm-3::1"}, []string{"dm-4::0"}))
+	assert.NoError(t, err)
+	assert.Len(t, resp.ContainerResponses, 3)
+	assert.Equal(t, map[string]int{"/dev/dm-3": 2, "/dev/dm-4": 2}, p.Usage())
+
+	// every device is at its limit now, the next pod is rejected as a whole
+	_, err = p.Allocate(context.Background(), containerRequests([]string{"dm-4::1"}))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, map[string]int{"/dev/dm-3": 2, "/dev/dm-4": 2}, p.Usage())
+}
+
+func TestAllocate_AuditsRolledBackContainers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := plugin.NewAuditLogger(path, 10, 1)
+	assert.NoError(t, err)
+
+	config := &api.DevicePluginConfig{Replicas: 2, UpperLimitPerDevice: 1, AllocationPolicy: plugin.PolicyUpperLimitShared}
+	scanner := mockScanner{devices: []string{"/dev/dm-3", "/dev/dm-4"}, config: config}
+	p := &plugin.PowerPlugin{
+		Scanner:     scanner,
+		Config:      config,
+		DeviceUsage: map[string]int{},
+		Audit:       audit,
+	}
+
+	_, err = p.Allocate(context.Background(), containerRequests([]string{"dm-3::0"}, []string{"dm-3::1"}))
+	assert.Error(t, err)
+	assert.NoError(t, audit.Close())
+
+	records := readAuditRecords(t, path)
+	assert.Len(t, records, 2)
+	assert.Equal(t, plugin.AuditResultRolledBack, records[0].Result)
+	assert.Equal(t, err.Error(), records[0].Error)
+	assert.Len(t, records[0].Devices, 1, "the rolled back container records what it would have got")
+	assert.Equal(t, plugin.AuditResultRejected, records[1].Result)
+	assert.Equal(t, []string{"/dev/dm-3"}, records[1].LimitSkipped)
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	"github.com/ocp-power-demos/power-dev-plugin/api/v1alpha1"
+	inventoryfake "github.com/ocp-power-demos/power-dev-plugin/pkg/client/clientset/versioned/fake"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+// fakeAllocations is the kubelet's view of the containers holding devices
+type fakeAllocations struct {
+	mutex    sync.Mutex
+	assigned [][]string
+	err      error
+	calls    int
+}
+
+func (f *fakeAllocations) set(assigned ...[]string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.assigned = assigned
+}
+
+func (f *fakeAllocations) ListAllocations(ctx context.Context, resourceName string) ([][]string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.calls++
+	return f.assigned, f.err
+}
+
+func (f *fakeAllocations) listed() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.calls
+}
+
+func TestAllocate_ReleasesUsageOfGoneContainers(t *testing.T) {
+	config := &api.DevicePluginConfig{AllocationPolicy: plugin.PolicyExclusive}
+	allocations := &fakeAllocations{}
+	p := &plugin.PowerPlugin{
+		Scanner:     mockScanner{devices: []string{"/dev/dm-3", "/dev/dm-4"}, config: config},
+		Config:      config,
+		DeviceUsage: map[string]int{},
+		Allocations: allocations,
+	}
+
+	_, err := p.Allocate(context.Background(), containerRequests([]string{"dm-3"}))
+	require.NoError(t, err)
+	assert.Zero(t, allocations.listed(), "a granted request is served from the recorded usage")
+	_, err = p.Allocate(context.Background(), containerRequests([]string{"dm-3"}))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "the kubelet reports a container only after Allocate returned")
+	assert.Equal(t, 1, allocations.listed(), "the kubelet is asked once a container is rejected")
+
+	allocations.set([]string{"dm-3"})
+	_, err = p.Allocate(context.Background(), containerRequests([]string{"dm-3"}))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, map[string]int{"/dev/dm-3": 1}, p.Usage())
+
+	allocations.set()
+	_, err = p.Allocate(context.Background(), containerRequests([]string{"dm-3"}))
+	assert.NoError(t, err, "the container holding dm-3 is gone")
+	assert.Equal(t, map[string]int{"/dev/dm-3": 1}, p.Usage())
+}
+
+func TestAllocate_InventoryShowsReleasedDevices(t *testing.T) {
+	config := &api.DevicePluginConfig{ReservedDevices: 1, AllocationPolicy: plugin.PolicyUpperLimitShared}
+	allocations := &fakeAllocations{}
+	p := &plugin.PowerPlugin{
+		Scanner:     mockScanner{devices: []string{"/dev/dm-3", "/dev/dm-4"}, config: config},
+		Config:      config,
+		DeviceUsage: map[string]int{},
+		Allocations: allocations,
+		Inventory:   plugin.NewInventoryReporter(inventoryfake.NewSimpleClientset(), "worker-0"),
+	}
+	statuses := func() map[string]v1alpha1.DeviceStatus {
+		statuses := map[string]v1alpha1.DeviceStatus{}
+		for _, dev := range p.Inventory.Status().Devices {
+			statuses[dev.Name] = dev
+		}
+		return statuses
+	}
+
+	_, err := p.Allocate(context.Background(), containerRequests([]string{"dm-3"}))
+	require.NoError(t, err)
+	assert.Equal(t, 1, statuses()["dm-3"].Allocations)
+	assert.Equal(t, "power-dev-plugin/dev", statuses()["dm-3"].Pool)
+	assert.Equal(t, plugin.PoolReserved, statuses()["dm-4"].Pool, "dm-4 is kept for the node")
+
+	// the controller publishes what the kubelet reports between Allocate calls
+	allocations.set([]string{"dm-3"})
+	p.RefreshUsage()
+	assert.Equal(t, 1, statuses()["dm-3"].Allocations)
+
+	allocations.set()
+	p.RefreshUsage()
+	assert.Equal(t, 0, statuses()["dm-3"].Allocations, "the container holding dm-3 is gone")
+}
+
+func TestAllocate_CountsContainersAllocatedBeforeARestart(t *testing.T) {
+	config := &api.DevicePluginConfig{Replicas: 2, UpperLimitPerDevice: 1, AllocationPolicy: plugin.PolicyUpperLimitShared}
+	allocations := &fakeAllocations{assigned: [][]string{{"dm-4::1"}}}
+	p := &plugin.PowerPlugin{
+		Scanner:     mockScanner{devices: []string{"/dev/dm-3", "/dev/dm-4"}, config: config},
+		Config:      config,
+		DeviceUsage: map[string]int{},
+		Allocations: allocations,
+	}
+
+	// the controller refreshes the usage as the plugin starts serving
+	p.RefreshUsage()
+	_, err := p.Allocate(context.Background(), containerRequests([]string{"dm-4::0"}))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "dm-4 is held by a container the plugin did not allocate")
+	assert.Equal(t, map[string]int{"/dev/dm-4": 1}, p.Usage())
+
+	allocations.err = errors.New("connection refused")
+	_, err = p.Allocate(context.Background(), containerRequests([]string{"dm-3::0"}))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"/dev/dm-3": 1, "/dev/dm-4": 1}, p.Usage(), "the recorded usage is kept without the kubelet")
+}
+
+func TestAllocate_DefaultGrantsAll(t *testing.T) {
+	config := &api.DevicePluginConfig{}
+	p := &plugin.PowerPlugin{
+		Scanner:     mockScanner{devices: []string{"/dev/dm-3", "/dev/dm-4"}, config: config},
+		Config:      config,
+		DeviceUsage: map[string]int{},
+	}
+
+	resp, err := p.Allocate(context.Background(), containerRequests([]string{"dm-3"}))
+	require.NoError(t, err)
+	assert.Len(t, resp.ContainerResponses[0].Devices, 2, "without allocation-policy every device is granted, as before")
+}
+
+func TestAssignedDeviceIDs(t *testing.T) {
+	resp := &podresourcesapi.ListPodResourcesResponse{
+		PodResources: []*podresourcesapi.PodResources{
+			{Name: "db-0", Namespace: "oracle", Containers: []*podresourcesapi.ContainerResources{
+				{Name: "db", Devices: []*podresourcesapi.ContainerDevices{
+					{ResourceName: "power-dev-plugin/dev", DeviceIds: []string{"dm-3::0"}},
+					{ResourceName: "example.com/gpu", DeviceIds: []string{"gpu0"}},
+					{ResourceName: "power-dev-plugin/dev", DeviceIds: []string{"dm-4::1"}},
+				}},
+				{Name: "sidecar"},
+			}},
+		},
+	}
+	assert.Equal(t, [][]string{{"dm-3::0", "dm-4::1"}}, plugin.AssignedDeviceIDs(resp, "power-dev-plugin/dev"))
+}
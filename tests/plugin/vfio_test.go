@@ -0,0 +1,209 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin_test
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/ocp-power-demos/power-dev-plugin/api"
+	"github.com/ocp-power-demos/power-dev-plugin/api/v1alpha1"
+	inventoryfake "github.com/ocp-power-demos/power-dev-plugin/pkg/client/clientset/versioned/fake"
+	"github.com/ocp-power-demos/power-dev-plugin/pkg/plugin"
+	"github.com/ocp-power-demos/power-dev-plugin/tests/fakehost"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// vfioHost is powerHost with PCI devices an admin bound to vfio-pci: an NVMe drive alone in group 12,
+// both functions of a NIC in group 13, a NIC with one function left on its host driver in group 14,
+// an NVMe drive on its host driver in group 15 and a drive sharing group 16 with a PCIe port
+func vfioHost(t *testing.T) *fakehost.Host {
+	return powerHost(t).
+		AddPCIDevice(fakehost.PCIDevice{Address: "0000:01:00.0", Vendor: "0x144d", Device: "0xa808", Driver: "vfio-pci", IOMMUGroup: 12}).
+		AddPCIDevice(fakehost.PCIDevice{Address: "0000:02:00.0", Vendor: "0x15b3", Device: "0x1019", Driver: "vfio-pci", IOMMUGroup: 13}).
+		AddPCIDevice(fakehost.PCIDevice{Address: "0000:02:00.1", Vendor: "0x15b3", Device: "0x1019", Driver: "vfio-pci", IOMMUGroup: 13}).
+		AddPCIDevice(fakehost.PCIDevice{Address: "0000:03:00.0", Vendor: "0x15b3", Device: "0x1019", Driver: "vfio-pci", IOMMUGroup: 14}).
+		AddPCIDevice(fakehost.PCIDevice{Address: "0000:03:00.1", Vendor: "0x15b3", Device: "0x1019", Driver: "mlx5_core", IOMMUGroup: 14}).
+		AddPCIDevice(fakehost.PCIDevice{Address: "0000:04:00.0", Vendor: "0x144d", Device: "0xa808", Driver: "nvme", IOMMUGroup: 15}).
+		AddPCIDevice(fakehost.PCIDevice{Address: "0000:00:1c.0", Vendor: "0x1014", Device: "0x03dc", Driver: "pcieport", IOMMUGroup: 16}).
+		AddPCIDevice(fakehost.PCIDevice{Address: "0000:05:00.0", Vendor: "0x144d", Device: "0xa808", Driver: "vfio-pci", IOMMUGroup: 16})
+}
+
+func TestReadVFIOGroups(t *testing.T) {
+	groups, err := vfioHost(t).Scanner().VFIOGroups()
+	require.NoError(t, err)
+
+	viable := map[string]error{}
+	addresses := map[string][]string{}
+	for _, g := range groups {
+		viable[g.Group] = g.Viable()
+		addresses[g.Group] = g.Addresses()
+	}
+	assert.Equal(t, map[string][]string{
+		"12": {"0000:01:00.0"},
+		"13": {"0000:02:00.0", "0000:02:00.1"},
+		"14": {"0000:03:00.0", "0000:03:00.1"},
+		"16": {"0000:00:1c.0", "0000:05:00.0"},
+	}, addresses, "group 15 has nothing bound to vfio-pci")
+	assert.NoError(t, viable["12"])
+	assert.NoError(t, viable["13"])
+	assert.EqualError(t, viable["14"], "IOMMU group 14 is not viable: 0000:03:00.1 is bound to mlx5_core")
+	assert.NoError(t, viable["16"], "a PCIe port does not keep a group from being opened")
+	assert.Equal(t, plugin.VFIODevice{Address: "0000:01:00.0", Driver: "vfio-pci", Vendor: "0x144d", Device: "0xa808"}, groups[0].Devices[0])
+
+	groups, err = powerHost(t).Scanner().VFIOGroups()
+	assert.NoError(t, err)
+	assert.Empty(t, groups, "nothing is bound when vfio-pci is not loaded")
+}
+
+func TestScanRootForDevices_VFIO(t *testing.T) {
+	tests := []struct {
+		name     string
+		host     func(t *testing.T) *fakehost.Host
+		classes  []api.DeviceClass
+		expected []string
+	}{
+		{"viable groups", vfioHost, []api.DeviceClass{{Name: "passthrough", Kind: "vfio"}},
+			[]string{"dm-0", "/dev/vfio/12", "/dev/vfio/13", "/dev/vfio/16"}},
+		{"narrowed by glob", vfioHost, []api.DeviceClass{{Name: "passthrough", Kind: "vfio", Glob: "/dev/vfio/1[23]"}},
+			[]string{"dm-0", "/dev/vfio/12", "/dev/vfio/13"}},
+		{"unknown kind", vfioHost, []api.DeviceClass{{Name: "passthrough", Kind: "mdev"}},
+			[]string{"dm-0"}},
+		{"vfio-pci not loaded", powerHost, []api.DeviceClass{{Name: "passthrough", Kind: "vfio"}},
+			[]string{"dm-0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &api.DevicePluginConfig{IncludeDevices: []string{"/dev/dm-0"}, DeviceClasses: tt.classes}
+			scanner := hostConfigScanner{HostScanner: tt.host(t).Scanner(), config: config}
+			devices, err := plugin.ScanRootForDevicesWithDeps(scanner, false)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, devices)
+		})
+	}
+}
+
+func TestAllocate_VFIOGroups(t *testing.T) {
+	config := &api.DevicePluginConfig{
+		Permissions:      "r",
+		Replicas:         2,
+		IncludeDevices:   []string{"/dev/dm-0"},
+		DeviceClasses:    []api.DeviceClass{{Name: "passthrough", Kind: "vfio", Permissions: "rw", Replicas: 4}},
+		AllocationPolicy: plugin.PolicyUpperLimitShared,
+	}
+	scanner := hostConfigScanner{HostScanner: vfioHost(t).Scanner(), config: config}
+	p := &plugin.PowerPlugin{
+		Scanner:     scanner,
+		Config:      config,
+		DeviceUsage: map[string]int{},
+		Inventory:   plugin.NewInventoryReporter(inventoryfake.NewSimpleClientset(), "worker-0"),
+	}
+	devices, err := p.Rescan()
+	require.NoError(t, err)
+	members := map[string]string{"vfio/12": "passthrough", "vfio/13": "passthrough", "vfio/16": "passthrough"}
+	assert.Equal(t, []string{"dm-0::0", "dm-0::1", "vfio/12", "vfio/13", "vfio/16"},
+		deviceIDs(plugin.AdvertisedDevices(devices, config, members, scanner, healthy)), "one ID per group, never shared")
+
+	resp, err := p.Allocate(context.Background(), containerRequests([]string{"vfio/12", "vfio/13"}))
+	require.NoError(t, err)
+	paths := map[string]string{}
+	for _, spec := range resp.ContainerResponses[0].Devices {
+		paths[spec.HostPath] = spec.Permissions
+		assert.Equal(t, spec.HostPath, spec.ContainerPath)
+	}
+	assert.Equal(t, map[string]string{"/dev/vfio/12": "rw", "/dev/vfio/13": "rw", "/dev/vfio/vfio": "rw"}, paths,
+		"the container node is granted once with the groups")
+
+	_, err = p.Allocate(context.Background(), containerRequests([]string{"vfio/12"}))
+	assert.Error(t, err, "a group is held by one container")
+
+	inventory := map[string]v1alpha1.DeviceStatus{}
+	for _, dev := range p.Inventory.Status().Devices {
+		inventory[dev.Name] = dev
+	}
+	require.Contains(t, inventory, "vfio/13")
+	assert.Equal(t, "/dev/vfio/13", inventory["vfio/13"].Path)
+	assert.Equal(t, "passthrough", inventory["vfio/13"].Class)
+	assert.Equal(t, map[string]string{"pci-devices": "0000:02:00.0,0000:02:00.1"}, inventory["vfio/13"].Annotations)
+}
+
+func TestAllocate_VFIOGroupsDefaultPolicy(t *testing.T) {
+	config := &api.DevicePluginConfig{
+		IncludeDevices: []string{"/dev/dm-0"},
+		DeviceClasses:  []api.DeviceClass{{Name: "passthrough", Kind: "vfio"}},
+	}
+	p := &plugin.PowerPlugin{
+		Scanner:     hostConfigScanner{HostScanner: vfioHost(t).Scanner(), config: config},
+		Config:      config,
+		DeviceUsage: map[string]int{},
+	}
+
+	hostPaths := func(resp *pluginapi.AllocateResponse) []string {
+		paths := []string{}
+		for _, spec := range resp.ContainerResponses[0].Devices {
+			paths = append(paths, spec.HostPath)
+		}
+		return paths
+	}
+	resp, err := p.Allocate(context.Background(), containerRequests([]string{"vfio/12"}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dev/vfio/12", "/dev/vfio/vfio"}, hostPaths(resp), "grant-all only hands out the requested groups")
+
+	resp, err = p.Allocate(context.Background(), containerRequests([]string{"vfio/13"}))
+	require.NoError(t, err, "the first container did not take every group")
+	assert.Equal(t, []string{"/dev/vfio/13", "/dev/vfio/vfio"}, hostPaths(resp))
+
+	_, err = p.Allocate(context.Background(), containerRequests([]string{"vfio/12"}))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "a group is held by one container")
+
+	resp, err = p.Allocate(context.Background(), containerRequests([]string{"dm-0"}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dev/dm-0"}, hostPaths(resp), "a block device request gets no groups")
+	assert.Equal(t, map[string]int{"/dev/dm-0": 1, "/dev/vfio/12": 1, "/dev/vfio/13": 1}, p.Usage())
+}
+
+func TestAllocate_VFIOGroupReleased(t *testing.T) {
+	config := &api.DevicePluginConfig{
+		IncludeDevices:   []string{"/dev/dm-0"},
+		DeviceClasses:    []api.DeviceClass{{Name: "passthrough", Kind: "vfio"}},
+		AllocationPolicy: plugin.PolicyUpperLimitShared,
+	}
+	allocations := &fakeAllocations{}
+	p := &plugin.PowerPlugin{
+		Scanner:     hostConfigScanner{HostScanner: vfioHost(t).Scanner(), config: config},
+		Config:      config,
+		DeviceUsage: map[string]int{},
+		Allocations: allocations,
+	}
+
+	_, err := p.Allocate(context.Background(), containerRequests([]string{"vfio/12"}))
+	require.NoError(t, err)
+
+	allocations.set([]string{"vfio/12"})
+	_, err = p.Allocate(context.Background(), containerRequests([]string{"vfio/12"}))
+	assert.Error(t, err, "the pod holding group 12 is running")
+
+	allocations.set()
+	_, err = p.Allocate(context.Background(), containerRequests([]string{"vfio/12"}))
+	assert.NoError(t, err, "the pod holding group 12 is gone")
+	assert.Equal(t, map[string]int{"/dev/vfio/12": 1}, p.Usage())
+}